@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// command is a gobig subcommand with its own flags and help text
+type command struct {
+	Name     string
+	Summary  string // One line description for the command list
+	Usage    string // Usage lines and description, printed before the options
+	Examples string // Examples printed after the options, if any
+	// Setup defines the command's flags on fs and returns the function that
+	// runs the command once they are parsed. It has no other effects, so
+	// that help and completion can list the flags.
+	Setup func(fs *flag.FlagSet) func() error
+}
+
+// commands lists the subcommands in the order help shows them. It is set in
+// init, since the help and completion commands refer back to it.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		buildCommand,
+		serveCommand,
+		initCommand,
+		lintCommand,
+		exportCommand,
+		completionCommand,
+		helpCommand,
+		versionCommand,
+	}
+}
+
+// lookupCommand returns the command with the given name, or nil
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// flagSet returns the command's flags and the function that runs it
+func (c *command) flagSet(errorHandling flag.ErrorHandling) (*flag.FlagSet, func() error) {
+	fs := flag.NewFlagSet("gobig "+c.Name, errorHandling)
+	run := c.Setup(fs)
+	fs.Usage = func() { c.printUsage(fs) }
+	return fs, run
+}
+
+// run parses the command's flags from args and runs it
+func (c *command) run(args []string) error {
+	fs, run := c.flagSet(flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return run()
+}
+
+// printUsage prints the command's help text and options
+func (c *command) printUsage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprint(out, c.Usage)
+	if hasFlags(fs) {
+		fmt.Fprint(out, "\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	if c.Examples != "" {
+		fmt.Fprint(out, "\nExamples:\n"+c.Examples)
+	}
+}
+
+// hasFlags reports whether fs defines any flags
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
+// commandFlags returns the flags of c, for listing them
+func commandFlags(c *command) *flag.FlagSet {
+	fs, _ := c.flagSet(flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// settingCommands are the commands whose flags configuration files can set.
+// The flags of other commands, such as init's -force, only make sense for
+// a single run.
+var settingCommands = []string{"build", "export"}
+
+// isSetting reports whether name is a flag of a command in settingCommands,
+// and so a valid configuration setting
+func isSetting(name string) bool {
+	if name == "help" || name == "version" {
+		return false
+	}
+	for _, c := range commands {
+		if slices.Contains(settingCommands, c.Name) && commandFlags(c).Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// helpCommand prints the overview or the help of a command
+var helpCommand = &command{
+	Name:    "help",
+	Summary: "Show help for gobig or one of its commands",
+	Usage: `Usage:
+  gobig help [command]
+`,
+	Setup: func(fs *flag.FlagSet) func() error {
+		return func() error {
+			if fs.NArg() == 0 {
+				usage()
+				return nil
+			}
+			c := lookupCommand(fs.Arg(0))
+			if c == nil {
+				return fmt.Errorf("unknown command %q: run gobig help for the list of commands", fs.Arg(0))
+			}
+			cfs, _ := c.flagSet(flag.ContinueOnError)
+			cfs.Usage()
+			return nil
+		}
+	},
+}
+
+// versionCommand prints the version of gobig
+var versionCommand = &command{
+	Name:    "version",
+	Summary: "Show version information",
+	Usage: `Usage:
+  gobig version
+`,
+	Setup: func(fs *flag.FlagSet) func() error {
+		return func() error {
+			printVersion()
+			return nil
+		}
+	},
+}
+
+// printVersion prints the version of gobig
+func printVersion() {
+	fmt.Printf("gobig version %s\n", version)
+}
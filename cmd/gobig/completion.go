@@ -0,0 +1,382 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gobig/internal/assets"
+	"gobig/internal/generator"
+	"gobig/internal/parser"
+)
+
+// completionCommand prints shell completion scripts
+var completionCommand = &command{
+	Name:    "completion",
+	Summary: "Print a shell completion script for bash, zsh or fish",
+	Usage: `Usage:
+  gobig completion bash|zsh|fish
+
+Prints a script that completes gobig's commands and flags, the built-in
+themes, layouts and formats, and markdown files.
+`,
+	Examples: `  source <(gobig completion bash)
+  gobig completion zsh > "${fpath[1]}/_gobig"
+  gobig completion fish > ~/.config/fish/completions/gobig.fish
+`,
+	Setup: func(fs *flag.FlagSet) func() error {
+		return func() error {
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return fmt.Errorf("expected one shell: bash, zsh or fish")
+			}
+			switch fs.Arg(0) {
+			case "bash":
+				writeBashCompletion(os.Stdout)
+			case "zsh":
+				writeZshCompletion(os.Stdout)
+			case "fish":
+				writeFishCompletion(os.Stdout)
+			default:
+				return fmt.Errorf("unknown shell %q: use bash, zsh or fish", fs.Arg(0))
+			}
+			return nil
+		}
+	},
+}
+
+// shells are the shells completion scripts are available for
+var shells = []string{"bash", "zsh", "fish"}
+
+// completion is what to complete for a flag value or argument
+type completion struct {
+	Words []string // Fixed values
+	Files bool     // Complete file names
+	Dirs  bool     // Complete directory names
+	Glob  string   // Pattern of the file names to complete, if not all
+}
+
+// completionFlag is a flag of a command, as completed by the shell
+type completionFlag struct {
+	Name  string
+	Usage string
+	Bool  bool       // The flag takes no value
+	Value completion // Completion of the value
+}
+
+// completionFlags returns the flags of c, sorted by name
+func completionFlags(c *command) []completionFlag {
+	var flags []completionFlag
+	commandFlags(c).VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			Name:  f.Name,
+			Usage: f.Usage,
+			Bool:  ok && b.IsBoolFlag(),
+			Value: flagCompletion(c, f.Name),
+		})
+	})
+	return flags
+}
+
+// flagCompletion returns the completion of the value of a flag of c
+func flagCompletion(c *command, name string) completion {
+	switch name {
+	case "theme":
+		return completion{Words: assets.ThemeNames(), Files: true}
+	case "layout":
+		return completion{Words: parser.KnownLayouts}
+	case "format":
+		return completion{Words: commandFormats(c)}
+	case "o":
+		return completion{Files: true}
+	case "out-dir", "theme-path":
+		return completion{Dirs: true}
+	}
+	return completion{}
+}
+
+// argCompletion returns the completion of the arguments of c
+func argCompletion(c *command) completion {
+	switch c.Name {
+	case "init":
+		return completion{Dirs: true}
+	case "completion":
+		return completion{Words: shells}
+	case "help":
+		return completion{Words: commandNames()}
+	case "version":
+		return completion{}
+	}
+	return completion{Files: true, Glob: "*.md"}
+}
+
+// commandFormats returns the -format values c accepts: serve serves HTML,
+// export writes documents
+func commandFormats(c *command) []string {
+	var formats []string
+	for _, name := range generator.BackendNames() {
+		backend, _ := generator.LookupBackend(name)
+		html := strings.HasPrefix(backend.MediaType(), "text/html")
+		if (c.Name == "serve" && !html) || (c.Name == "export" && html) {
+			continue
+		}
+		formats = append(formats, name)
+	}
+	return formats
+}
+
+// commandNames returns the names of the commands
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// writeBashCompletion writes the bash completion script. Words are
+// completed by the case of the command and the previous word.
+func writeBashCompletion(w io.Writer) {
+	names := strings.Join(commandNames(), "|")
+
+	fmt.Fprintf(w, `# bash completion for gobig, generated by gobig completion bash
+_gobig() {
+    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+    local cmd=build
+    case ${COMP_WORDS[1]} in
+        %s) [[ $COMP_CWORD -gt 1 ]] && cmd=${COMP_WORDS[1]} ;;
+    esac
+    prev=${prev/#--/-}
+
+    case "$cmd $prev" in
+`, names)
+	for _, c := range commands {
+		for _, f := range completionFlags(c) {
+			if !f.Bool {
+				fmt.Fprintf(w, "        %q) %s; return ;;\n", c.Name+" -"+f.Name, bashReply(f.Value))
+			}
+		}
+	}
+	fmt.Fprint(w, `    esac
+
+    if [[ $cur == -* ]]; then
+        case $cmd in
+`)
+	for _, c := range commands {
+		var flags []string
+		for _, f := range completionFlags(c) {
+			flags = append(flags, "-"+f.Name)
+		}
+		if len(flags) > 0 {
+			fmt.Fprintf(w, "            %s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", c.Name, strings.Join(flags, " "))
+		}
+	}
+	fmt.Fprintf(w, `        esac
+        return
+    fi
+
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W %q -- "$cur"))
+    fi
+    case $cmd in
+`, strings.Join(commandNames(), " "))
+	for _, c := range commands {
+		fmt.Fprintf(w, "        %s) COMPREPLY+=(%s) ;;\n", c.Name, bashWords(argCompletion(c)))
+	}
+	fmt.Fprint(w, `    esac
+}
+complete -o filenames -F _gobig gobig
+`)
+}
+
+// bashReply returns the bash statement setting COMPREPLY to a completion
+func bashReply(value completion) string {
+	words := bashWords(value)
+	if words == "" {
+		return "COMPREPLY=()"
+	}
+	return "COMPREPLY=(" + words + ")"
+}
+
+// bashWords returns the compgen calls listing the words of a completion
+func bashWords(value completion) string {
+	var parts []string
+	if len(value.Words) > 0 {
+		parts = append(parts, fmt.Sprintf(`$(compgen -W %q -- "$cur")`, strings.Join(value.Words, " ")))
+	}
+	switch {
+	case value.Files && value.Glob != "":
+		parts = append(parts, fmt.Sprintf(`$(compgen -f -X '!%s' -- "$cur")`, value.Glob), `$(compgen -d -- "$cur")`)
+	case value.Files:
+		parts = append(parts, `$(compgen -f -- "$cur")`)
+	case value.Dirs:
+		parts = append(parts, `$(compgen -d -- "$cur")`)
+	}
+	return strings.Join(parts, " ")
+}
+
+// writeZshCompletion writes the zsh completion script, which describes the
+// flags of each command to _arguments
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprint(w, `#compdef gobig
+# zsh completion for gobig, generated by gobig completion zsh
+
+_gobig() {
+    local -a commands=(
+`)
+	for _, c := range commands {
+		fmt.Fprintf(w, "        %s\n", zshQuote(c.Name+":"+c.Summary))
+	}
+	fmt.Fprintf(w, `    )
+    local -a names=(%s)
+
+    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then
+        _describe -t commands 'gobig command' commands
+        _files -g '*.md'
+        return
+    fi
+
+    local cmd=build
+    if (( ${names[(Ie)$words[2]]} )); then
+        cmd=$words[2]
+        shift words
+        (( CURRENT-- ))
+    fi
+
+    case $cmd in
+`, strings.Join(commandNames(), " "))
+	for _, c := range commands {
+		var specs []string
+		for _, f := range completionFlags(c) {
+			spec := "-" + f.Name + "[" + zshDescription(f.Usage) + "]"
+			if !f.Bool {
+				spec += ":" + f.Name + ":" + zshAction(f.Value)
+			}
+			specs = append(specs, zshQuote(spec))
+		}
+		if args := argCompletion(c); args.Files || args.Dirs || len(args.Words) > 0 {
+			specs = append(specs, zshQuote("*:argument:"+zshAction(args)))
+		}
+
+		fmt.Fprintf(w, "        %s)\n", c.Name)
+		if len(specs) > 0 {
+			fmt.Fprintf(w, "            _arguments -S \\\n                %s\n", strings.Join(specs, " \\\n                "))
+		}
+		fmt.Fprint(w, "            ;;\n")
+	}
+	fmt.Fprint(w, `    esac
+}
+
+if [[ $funcstack[1] == _gobig ]]; then
+    _gobig "$@"
+else
+    compdef _gobig gobig
+fi
+`)
+}
+
+// zshAction returns the _arguments action completing a value
+func zshAction(value completion) string {
+	var files string
+	switch {
+	case value.Files && value.Glob != "":
+		files = "_files -g " + zshQuote(value.Glob)
+	case value.Files:
+		files = "_files"
+	case value.Dirs:
+		files = "_files -/"
+	}
+	switch {
+	case len(value.Words) > 0 && files != "":
+		return "{compadd -- " + strings.Join(value.Words, " ") + "; " + files + "}"
+	case len(value.Words) > 0:
+		return "(" + strings.Join(value.Words, " ") + ")"
+	}
+	return files
+}
+
+// zshDescription escapes a flag description for an _arguments option spec
+func zshDescription(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(s)
+}
+
+// zshQuote quotes s for zsh in single quotes
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeFishCompletion writes the fish completion script, one complete
+// command per subcommand, flag and argument
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintf(w, `# fish completion for gobig, generated by gobig completion fish
+function __gobig_command
+    set -l words (commandline -opc)
+    if set -q words[2]; and contains -- $words[2] %s
+        echo $words[2]
+    else
+        echo build
+    end
+end
+
+function __gobig_using
+    contains -- (__gobig_command) $argv
+end
+
+complete -c gobig -f
+`, strings.Join(commandNames(), " "))
+	for _, c := range commands {
+		fmt.Fprintf(w, "complete -c gobig -n __fish_use_subcommand -a %s -d %s\n", c.Name, fishQuote(c.Summary))
+	}
+	for _, c := range commands {
+		condition := fishQuote("__gobig_using " + c.Name)
+		for _, f := range completionFlags(c) {
+			fmt.Fprintf(w, "complete -c gobig -n %s -o %s%s -d %s\n", condition, f.Name, fishValue(f), fishQuote(f.Usage))
+		}
+		if args := fishArgs(argCompletion(c)); args != "" {
+			fmt.Fprintf(w, "complete -c gobig -n %s%s\n", condition, args)
+		}
+	}
+}
+
+// fishValue returns the options of a fish complete command that complete
+// the value of a flag
+func fishValue(f completionFlag) string {
+	if f.Bool {
+		return ""
+	}
+	args := fishArgs(f.Value)
+	if f.Value.Files {
+		return " -r" + args
+	}
+	return " -x" + args
+}
+
+// fishArgs returns the options of a fish complete command that complete
+// the values of a completion
+func fishArgs(value completion) string {
+	var words []string
+	words = append(words, value.Words...)
+	switch {
+	case value.Files && value.Glob != "":
+		words = append(words, "(__fish_complete_suffix "+strings.TrimPrefix(value.Glob, "*")+")")
+	case value.Dirs:
+		words = append(words, "(__fish_complete_directories)")
+	}
+
+	var args string
+	if len(words) > 0 {
+		args = " -a " + fishQuote(strings.Join(words, " "))
+	}
+	if value.Files && value.Glob == "" {
+		args += " -F"
+	}
+	return args
+}
+
+// fishQuote quotes s for fish in single quotes
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
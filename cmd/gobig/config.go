@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"gobig/internal/config"
+)
+
+// outputSettings are the settings that choose the output of gobig build.
+// Other commands have flags of the same names that mean something else,
+// e.g. export's -o names the PDF, so they only apply to build.
+var outputSettings = []string{"o", "out-dir", "format"}
+
+// applyConfig sets the flags of fs that were not given on the command line
+// from the configuration files that apply to inputFile, the nearest file
+// taking precedence. Output settings are only applied if output is set. It
+// returns the names of the flags given on the command line and the targets
+// of the nearest file that has any.
+func applyConfig(fs *flag.FlagSet, inputFile string, output bool) (map[string]bool, []config.Target, error) {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	files, err := config.Find(filepath.Dir(inputFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find configuration: %w", err)
+	}
+
+	var targets []config.Target
+	for _, file := range files {
+		c, err := config.Load(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read configuration: %w", err)
+		}
+
+		names := make([]string, 0, len(c.Settings))
+		for name := range c.Settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			switch {
+			case !isSetting(name):
+				fmt.Fprintf(os.Stderr, "%s: warning: unknown setting %q\n", c.Path, name)
+			case explicit[name]:
+				continue
+			case !output && slices.Contains(outputSettings, name):
+				continue
+			case fs.Lookup(name) != nil:
+				if err := fs.Set(name, c.Settings[name]); err != nil {
+					return nil, nil, fmt.Errorf("%s: %s: %w", c.Path, name, err)
+				}
+			}
+			// Settings the command has no flag for are skipped
+		}
+
+		if len(c.Targets) > 0 {
+			targets = c.Targets
+		}
+	}
+	return explicit, targets, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gobig/internal/config"
+	"gobig/internal/generator"
+)
+
+// exportCommand writes presentations as PDF or PowerPoint documents
+var exportCommand = &command{
+	Name:    "export",
+	Summary: "Export a presentation to PDF or PowerPoint",
+	Usage: `Usage:
+  gobig export [options] <input.md>...
+
+Exports the presentation to a PDF or PowerPoint document, named after the
+first input file unless -o is given. Use -o - to write it to stdout.
+`,
+	Examples: `  gobig export talk.md
+  gobig export -pdf-notes -o handout.pdf talk.md
+  gobig export -format pptx talk.md
+`,
+	Setup: setupExport,
+}
+
+// setupExport defines the flags of the export command
+func setupExport(fs *flag.FlagSet) func() error {
+	deck := addDeckFlags(fs)
+	outputFile := fs.String("o", "", "Output file, or - for stdout (default: the input file with the format's extension)")
+	format := fs.String("format", "pdf", "Output format: pdf or pptx")
+	pdfNotes := fs.Bool("pdf-notes", false, "Follow each slide with a page of its speaker notes in PDF output")
+
+	return func() error {
+		if fs.NArg() == 0 {
+			fs.Usage()
+			return fmt.Errorf("at least one input file required")
+		}
+		explicit, _, err := applyConfig(fs, fs.Arg(0), false)
+		if err != nil {
+			return err
+		}
+		if backend, ok := generator.LookupBackend(*format); ok && strings.HasPrefix(backend.MediaType(), "text/html") {
+			return fmt.Errorf("cannot export %s output: use pdf or pptx, or gobig build", *format)
+		}
+
+		output := *outputFile
+		switch output {
+		case "":
+			input := fs.Arg(0)
+			output = strings.TrimSuffix(input, filepath.Ext(input)) + "." + *format
+		case "-":
+			output = ""
+		}
+
+		settings := deck.settings()
+		settings.PDFNotes = *pdfNotes
+		settings.Flags = explicit
+		return runTarget(fs.Args(), config.Target{Format: *format, Output: output}, settings)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gobig/internal/assets"
+	"gobig/internal/parser"
+)
+
+// initCommand creates a starter presentation
+var initCommand = &command{
+	Name:    "init",
+	Summary: "Create a starter presentation and configuration file",
+	Usage: `Usage:
+  gobig init [options] [directory]
+
+Creates slides.md, a starter presentation showing slides, a layout and
+speaker notes, and gobig.yaml, a configuration file building it to
+dist/slides.html, in the directory (default: the current one).
+`,
+	Examples: `  gobig init talk
+  gobig init -theme light -layout grid-3x2 talk
+`,
+	Setup: setupInit,
+}
+
+// setupInit defines the flags of the init command
+func setupInit(fs *flag.FlagSet) func() error {
+	theme := fs.String("theme", "dark", "Theme of the presentation: dark, light, white, a CSS file, or a theme directory")
+	layout := fs.String("layout", "50-50", "Layout of the example layout slide")
+	force := fs.Bool("force", false, "Overwrite existing files")
+
+	return func() error {
+		if fs.NArg() > 1 {
+			fs.Usage()
+			return fmt.Errorf("at most one directory expected")
+		}
+		dir := "."
+		if fs.NArg() == 1 {
+			dir = fs.Arg(0)
+		}
+		if !parser.IsValidLayout(*layout) {
+			return fmt.Errorf("unknown layout %q", *layout)
+		}
+
+		files := []struct {
+			name    string
+			content string
+		}{
+			{"slides.md", starterSlides(*layout)},
+			{"gobig.yaml", starterConfig(*theme)},
+		}
+		if !*force {
+			for _, file := range files {
+				path := filepath.Join(dir, file.name)
+				if _, err := os.Stat(path); err == nil {
+					return fmt.Errorf("%s already exists: use -force to overwrite it", path)
+				}
+			}
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		for _, file := range files {
+			path := filepath.Join(dir, file.name)
+			if err := os.WriteFile(path, []byte(file.content), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", path, err)
+			}
+			fmt.Fprintf(os.Stderr, "Created %s\n", path)
+		}
+		fmt.Fprintf(os.Stderr, "Run gobig serve %s to preview the presentation\n", filepath.Join(dir, "slides.md"))
+		return nil
+	}
+}
+
+// starterSlides returns the markdown of a starter presentation whose layout
+// slide uses the given layout
+func starterSlides(layout string) string {
+	cells := []string{"Each paragraph of a layout slide fills one cell", "like this one"}
+	var columns, rows int
+	if _, err := fmt.Sscanf(layout, "grid-%dx%d", &columns, &rows); err == nil {
+		for i := len(cells); i < columns*rows; i++ {
+			cells = append(cells, fmt.Sprintf("Cell %d", i+1))
+		}
+	}
+
+	return fmt.Sprintf(`<!-- presentation
+title: My Presentation
+-->
+
+# My Presentation
+
+Your Name
+
+<!-- notes
+Speaker notes are Markdown. Press **s** while presenting to see them in the
+presenter view, next to the next slide and a timer.
+-->
+
+---
+
+## Agenda
+
+- Slides are separated by ---
+- Each slide is scaled to fill the screen
+- Press the arrow keys to move between them
+
+---
+
+<!-- slide
+layout: %s
+-->
+
+%s
+
+---
+
+## Thank You!
+`, yamlString(layout), strings.Join(cells, "\n\n"))
+}
+
+// starterConfig returns a configuration file for a starter presentation
+func starterConfig(theme string) string {
+	return fmt.Sprintf(`# gobig configuration: settings are named like the command-line flags,
+# and relative paths are relative to this file
+theme: %s
+presenter: true
+targets:
+  - output: dist/{name}.html
+`, yamlString(theme))
+}
+
+// yamlString returns s as a YAML scalar, quoted unless it is a built-in
+// theme or layout name
+func yamlString(s string) string {
+	if slices.Contains(assets.ThemeNames(), s) || slices.Contains(parser.KnownLayouts, s) {
+		return s
+	}
+	return fmt.Sprintf("%q", s)
+}
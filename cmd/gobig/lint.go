@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// lintCommand checks presentations without writing any output
+var lintCommand = &command{
+	Name:    "lint",
+	Summary: "Check presentations for problems without writing output",
+	Usage: `Usage:
+  gobig lint [options] <input.md>...
+
+Parses and generates the presentation, reporting the problems a build would
+report without writing anything. Exits with status 1 if there are errors,
+or with -fail-on-warning if there are warnings.
+`,
+	Examples: `  gobig lint talk.md
+  gobig lint -strict -safe -fail-on-warning submissions/*.md
+  gobig lint -format pdf talk.md
+`,
+	Setup: setupLint,
+}
+
+// setupLint defines the flags of the lint command
+func setupLint(fs *flag.FlagSet) func() error {
+	deck := addDeckFlags(fs)
+	format := fs.String("format", "html", "Output format to check: html (big.js), reveal (reveal.js), pdf or pptx")
+	failOnWarning := fs.Bool("fail-on-warning", false, "Exit with status 1 if there are warnings")
+
+	return func() error {
+		if fs.NArg() == 0 {
+			fs.Usage()
+			return fmt.Errorf("at least one input file required")
+		}
+		explicit, _, err := applyConfig(fs, fs.Arg(0), false)
+		if err != nil {
+			return err
+		}
+
+		settings := deck.settings()
+		settings.Format = *format
+		settings.Flags = explicit
+		result, err := build(fs.Args(), settings)
+		if result == nil {
+			return err
+		}
+
+		files := strings.Join(fs.Args(), ", ")
+		errors := countErrors(result.Diagnostics)
+		warnings := len(result.Diagnostics) - errors
+		switch {
+		case errors > 0:
+			return fmt.Errorf("%d error(s) and %d warning(s) found in %s", errors, warnings, files)
+		case err != nil:
+			return err
+		case warnings == 0:
+			fmt.Fprintf(os.Stderr, "No problems found in %s\n", files)
+		case *failOnWarning:
+			return fmt.Errorf("%d warning(s) found in %s", warnings, files)
+		default:
+			fmt.Fprintf(os.Stderr, "%d warning(s) found in %s\n", warnings, files)
+		}
+		return nil
+	}
+}
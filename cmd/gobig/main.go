@@ -5,130 +5,466 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gobig/internal/assets"
+	"gobig/internal/config"
 	"gobig/internal/generator"
 	"gobig/internal/parser"
 )
 
 const version = "1.0.0"
 
-var (
-	outputFile  = flag.String("o", "", "Output HTML file (default: stdout)")
-	theme       = flag.String("theme", "dark", "Theme: dark, light, or white")
-	aspectRatio = flag.String("aspect-ratio", "1.6", "Aspect ratio (e.g., 1.6, 2, false)")
-	title       = flag.String("title", "", "Presentation title (default: from first slide)")
-	showVersion = flag.Bool("version", false, "Show version information")
-	showHelp    = flag.Bool("help", false, "Show help message")
-)
+// deckFlags are the flags of every command that builds a deck
+type deckFlags struct {
+	theme       *string
+	themePath   *string
+	aspectRatio *string
+	title       *string
+	strict      *bool
+	safe        *bool
+	presenter   *bool
+	plainNotes  *bool
+	subsetFonts *bool
+	highlight   *string
+}
 
-func main() {
-	flag.Usage = usage
-	flag.Parse()
+// addDeckFlags defines the flags shared by the commands that build a deck
+func addDeckFlags(fs *flag.FlagSet) *deckFlags {
+	return &deckFlags{
+		theme:       fs.String("theme", "dark", "Theme: dark, light, white, a CSS file, or a theme directory"),
+		themePath:   fs.String("theme-path", "", "Directories to search for themes, separated by the OS path list separator"),
+		aspectRatio: fs.String("aspect-ratio", "1.6", "Aspect ratio (e.g., 1.6, 2, 16:9, false)"),
+		title:       fs.String("title", "", "Presentation title (default: from first slide)"),
+		strict:      fs.Bool("strict", false, "Fail on unknown or invalid slide and presentation metadata, math and diagrams"),
+		safe:        fs.Bool("safe", false, "Sanitize raw HTML and remove javascript: and other unsafe URLs, for untrusted Markdown"),
+		presenter:   fs.Bool("presenter", false, "Include the presenter view (press s while presenting)"),
+		plainNotes:  fs.Bool("plain-notes", false, "Keep speaker notes as plain text instead of rendering Markdown"),
+		subsetFonts: fs.Bool("subset-fonts", false, "Reduce embedded fonts to the glyphs used in the deck"),
+		highlight:   fs.String("highlight-style", "", "Syntax highlighting style for code blocks, or none (default: matches the theme)"),
+	}
+}
 
-	// Handle version flag
-	if *showVersion {
-		fmt.Printf("gobig version %s\n", version)
-		os.Exit(0)
+// settings returns the build settings selected by the flags
+func (f *deckFlags) settings() buildSettings {
+	return buildSettings{
+		Theme:       *f.theme,
+		ThemePaths:  splitThemePath(*f.themePath),
+		AspectRatio: *f.aspectRatio,
+		Title:       *f.title,
+		Strict:      *f.strict,
+		Safe:        *f.safe,
+		Presenter:   *f.presenter,
+		PlainNotes:  *f.plainNotes,
+		SubsetFonts: *f.subsetFonts,
+		Highlight:   *f.highlight,
 	}
+}
 
-	// Handle help flag
-	if *showHelp {
+// buildSettings holds the options shared by every command that builds a deck
+type buildSettings struct {
+	Theme       string
+	ThemePaths  []string
+	AspectRatio string
+	Title       string
+	Strict      bool
+	Safe        bool // Sanitize raw HTML and unsafe URLs
+	CSP         bool // Add a Content-Security-Policy and integrity attributes
+	Presenter   bool
+	PlainNotes  bool
+	SubsetFonts bool
+	Highlight   string
+	Format      string // "html" (default), "reveal", "pdf" or "pptx"
+	PDFNotes    bool
+	RevealURL   string
+	Directory   bool // Reference images, CSS and JS as assets instead of inlining them
+	InlineLimit int
+	Optimize    bool // Optimize local images
+	ImageWidth  int
+	Quality     int
+	Srcset      bool
+	Flags       map[string]bool // Settings given on the command line, which presentation metadata does not override
+}
+
+// buildResult is a generated presentation and the files it was built from
+type buildResult struct {
+	HTML        string
+	Document    []byte              // Binary output of formats other than HTML
+	Assets      []generator.Asset   // Files to write next to the HTML in directory output
+	Files       []string            // Input and included markdown followed by referenced local files
+	Diagnostics []parser.Diagnostic // Warnings and errors reported by the parser and the generator
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage()
+		os.Exit(1)
+	}
+	if args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
 		usage()
 		os.Exit(0)
 	}
 
-	// Get input file
-	args := flag.Args()
-	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "Error: exactly one input file required")
-		usage()
+	// Anything but a command name is a shorthand for build
+	cmd := buildCommand
+	if c := lookupCommand(args[0]); c != nil {
+		cmd, args = c, args[1:]
+	}
+	if err := cmd.run(args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	inputFile := args[0]
+// buildCommand generates presentations, and is what gobig runs when it is
+// not given a command
+var buildCommand = &command{
+	Name:    "build",
+	Summary: "Generate a presentation (the default command)",
+	Usage: `Usage:
+  gobig build [options] <input.md>...
+  gobig [options] <input.md>...
 
-	// Validate theme
-	if !assets.ValidateTheme(*theme) {
-		fmt.Fprintf(os.Stderr, "Error: invalid theme '%s'. Valid themes: dark, light, white\n", *theme)
-		os.Exit(1)
+Generates a big.js presentation, or with -format a reveal.js, PDF or
+PowerPoint one. Several input files are concatenated in order, each starting
+a new slide. Without -o, -out-dir or -format, the targets of the
+configuration file are built, or the presentation is written to stdout.
+`,
+	Examples: `  gobig -o index.html presentation.md
+  gobig -theme light -o output.html slides.md
+  gobig -theme ./brand/company.css -o talk.html talk.md
+  gobig -aspect-ratio 2 -title "My Talk" -o slides.html talk.md
+  gobig -o workshop.html intro.md part1.md part2.md
+  gobig -out-dir site/talk -inline-limit 8192 talk.md
+  gobig -out-dir site/talk -optimize-images -srcset talk.md
+  gobig -format reveal -o talk.html talk.md
+  gobig -safe -o submission.html submission.md
+  gobig -safe -csp -out-dir site/talk talk.md
+`,
+	Setup: setupBuild,
+}
+
+// setupBuild defines the flags of the build command
+func setupBuild(fs *flag.FlagSet) func() error {
+	deck := addDeckFlags(fs)
+	outputFile := fs.String("o", "", "Output file (default: stdout)")
+	outputDir := fs.String("out-dir", "", "Write index.html and an assets directory with hashed images, CSS and JS to this directory")
+	inlineLimit := fs.Int("inline-limit", 0, "With -out-dir, inline images of at most this many bytes as data URIs")
+	optimize := fs.Bool("optimize-images", false, "Downscale and re-encode local JPEG and PNG images, removing EXIF and GPS metadata")
+	imageWidth := fs.Int("image-width", 1920, "Screen width in pixels that optimized images are scaled for")
+	quality := fs.Int("image-quality", 85, "JPEG quality of optimized images, from 1 to 100")
+	srcset := fs.Bool("srcset", false, "With -out-dir and -optimize-images, add half and quarter width image variants")
+	format := fs.String("format", "html", "Output format: html (big.js), reveal (reveal.js), pdf or pptx")
+	csp := fs.Bool("csp", false, "Add a Content-Security-Policy allowing only the deck's own scripts and styles, and integrity attributes with -out-dir")
+	pdfNotes := fs.Bool("pdf-notes", false, "Follow each slide with a page of its speaker notes in PDF output")
+	revealURL := fs.String("reveal-url", "", "Base URL of the reveal.js package for reveal output (default: jsDelivr CDN)")
+	showVersion := fs.Bool("version", false, "Show version information")
+
+	return func() error {
+		if *showVersion {
+			printVersion()
+			return nil
+		}
+		inputFiles := fs.Args()
+		if len(inputFiles) == 0 {
+			fs.Usage()
+			return fmt.Errorf("at least one input file required")
+		}
+
+		explicit, targets, err := applyConfig(fs, inputFiles[0], true)
+		if err != nil {
+			return err
+		}
+
+		settings := deck.settings()
+		settings.CSP = *csp
+		settings.PDFNotes = *pdfNotes
+		settings.RevealURL = *revealURL
+		settings.InlineLimit = *inlineLimit
+		settings.Optimize = *optimize
+		settings.ImageWidth = *imageWidth
+		settings.Quality = *quality
+		settings.Srcset = *srcset
+		settings.Flags = explicit
+
+		// Output flags replace the configured targets
+		if len(targets) == 0 || explicit["o"] || explicit["out-dir"] || explicit["format"] {
+			targets = []config.Target{{Output: *outputFile, OutDir: *outputDir}}
+		}
+
+		// Targets may name their output after the first input file
+		name := strings.TrimSuffix(filepath.Base(inputFiles[0]), filepath.Ext(inputFiles[0]))
+		for _, target := range targets {
+			if target.Format == "" {
+				target.Format = *format
+			}
+			target.Output = strings.ReplaceAll(target.Output, "{name}", name)
+			target.OutDir = strings.ReplaceAll(target.OutDir, "{name}", name)
+			if err := runTarget(inputFiles, target, settings); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
+}
 
-	// Run the conversion
-	if err := run(inputFile); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+// runTarget builds the presentation for one output target
+func runTarget(inputFiles []string, target config.Target, settings buildSettings) error {
+	if target.OutDir != "" && target.Output != "" {
+		return fmt.Errorf("use either -o or -out-dir, not both")
+	}
+	if settings.Srcset && (target.OutDir == "" || !settings.Optimize) {
+		return fmt.Errorf("-srcset needs -out-dir and -optimize-images")
 	}
+
+	settings.Format = target.Format
+	settings.Directory = target.OutDir != ""
+	result, err := build(inputFiles, settings)
+	if err != nil {
+		return err
+	}
+
+	if target.OutDir != "" {
+		return writeDirectory(target.OutDir, result)
+	}
+
+	output := []byte(result.HTML)
+	if result.Document != nil {
+		output = result.Document
+	}
+
+	// Output the presentation
+	if target.Output != "" {
+		// Write to file
+		if err := os.MkdirAll(filepath.Dir(target.Output), 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		if err := os.WriteFile(target.Output, output, 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Presentation generated: %s\n", target.Output)
+	} else {
+		// Write to stdout
+		os.Stdout.Write(output)
+	}
+
+	return nil
 }
 
-func run(inputFile string) error {
-	// Parse markdown file
-	p := parser.NewParser()
-	if err := p.ParseFile(inputFile); err != nil {
-		return fmt.Errorf("failed to parse file: %w", err)
+// writeDirectory writes the presentation as index.html in dir, next to
+// its assets. Assets of earlier builds are kept, so that pages cached with
+// them keep working.
+func writeDirectory(dir string, result *buildResult) error {
+	files := append([]generator.Asset{{Path: "index.html", Data: []byte(result.HTML)}}, result.Assets...)
+	for _, file := range files {
+		path := filepath.Join(dir, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		if err := os.WriteFile(path, file.Data, 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Presentation generated: %s (%d assets)\n", filepath.Join(dir, "index.html"), len(result.Assets))
+	return nil
+}
+
+// build parses the input files, concatenated in order, and generates the
+// presentation HTML, printing any diagnostics to stderr. On a parse error
+// the result still lists the files that were read.
+func build(inputFiles []string, settings buildSettings) (*buildResult, error) {
+	backend, ok := generator.LookupBackend(settings.Format)
+	if !ok {
+		names := generator.BackendNames()
+		return nil, fmt.Errorf("unknown format %q: use %s or %s", settings.Format, strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+	}
+	if settings.Directory && !strings.HasPrefix(backend.MediaType(), "text/html") {
+		return nil, fmt.Errorf("directory output is only available for html and reveal formats")
+	}
+
+	// Parse markdown files
+	p := parser.NewParserWithOptions(parser.Options{Strict: settings.Strict, Safe: settings.Safe})
+	var err error
+	for _, inputFile := range inputFiles {
+		if err = p.ParseFile(inputFile); err != nil {
+			err = fmt.Errorf("failed to parse %s: %w", inputFile, err)
+			break
+		}
+	}
+	printDiagnostics(p.GetDiagnostics())
+	if err != nil {
+		return &buildResult{Files: p.GetFiles(), Diagnostics: p.GetDiagnostics()}, err
+	}
+	if p.HasErrors() {
+		return &buildResult{Files: p.GetFiles(), Diagnostics: p.GetDiagnostics()}, fmt.Errorf("failed to parse input: %d problem(s) found", countErrors(p.GetDiagnostics()))
 	}
 
 	slides := p.GetSlides()
 	presentationMetadata := p.GetPresentationMetadata()
 
 	// Get base path for resolving relative image paths
-	basePath, err := filepath.Abs(filepath.Dir(inputFile))
+	basePath, err := filepath.Abs(filepath.Dir(inputFiles[0]))
 	if err != nil {
-		basePath = filepath.Dir(inputFile)
+		basePath = filepath.Dir(inputFiles[0])
+	}
+
+	// Theme directories named in the presentation metadata are relative to
+	// the presentation, and in safe mode must be inside its directory
+	var metadataThemePaths []string
+	for _, dir := range presentationMetadata.Themes {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(basePath, dir)
+		}
+		if settings.Safe && !assets.WithinDir(basePath, dir) {
+			return &buildResult{Files: p.GetFiles(), Diagnostics: p.GetDiagnostics()}, fmt.Errorf("cannot use theme directory %s: safe mode only allows directories in the presentation's directory", dir)
+		}
+		metadataThemePaths = append(metadataThemePaths, dir)
+	}
+	settings.applyMetadata(&presentationMetadata)
+
+	// Search the theme directories in order of precedence: the flag's before
+	// the metadata's before the configuration's. In safe mode the
+	// presentation's come last, so that it cannot replace the chosen theme.
+	themePaths := append(append([]string{}, metadataThemePaths...), settings.ThemePaths...)
+	if settings.Flags["theme-path"] || settings.Safe {
+		themePaths = append(append([]string{}, settings.ThemePaths...), metadataThemePaths...)
 	}
 
 	// Generate HTML
 	opts := generator.Options{
-		Theme:                *theme,
-		Title:                *title,
-		AspectRatio:          *aspectRatio,
+		Theme:                settings.Theme,
+		ThemePaths:           themePaths,
+		Title:                settings.Title,
+		AspectRatio:          settings.AspectRatio,
 		BasePath:             basePath,
+		Presenter:            settings.Presenter,
+		PlainNotes:           settings.PlainNotes,
+		SubsetFonts:          settings.SubsetFonts,
+		HighlightStyle:       settings.Highlight,
+		NotesPages:           settings.PDFNotes,
+		RevealURL:            settings.RevealURL,
+		Directory:            settings.Directory,
+		InlineLimit:          settings.InlineLimit,
+		OptimizeImages:       settings.Optimize,
+		ImageWidth:           settings.ImageWidth,
+		ImageQuality:         settings.Quality,
+		ImageVariants:        settings.Srcset,
+		Strict:               settings.Strict,
+		Safe:                 settings.Safe,
+		CSP:                  settings.CSP,
 		PresentationMetadata: presentationMetadata,
 	}
 
 	gen := generator.NewGenerator(opts)
-	html, err := gen.Generate(slides)
+	document, err := backend.Generate(gen, slides)
+	printDiagnostics(gen.Diagnostics())
+	result := &buildResult{
+		Files:       append(p.GetFiles(), gen.Dependencies()...),
+		Diagnostics: append(p.GetDiagnostics(), gen.Diagnostics()...),
+	}
 	if err != nil {
-		return fmt.Errorf("failed to generate HTML: %w", err)
+		return result, fmt.Errorf("failed to generate %s output: %w", backend.Name(), err)
 	}
 
-	// Output HTML
-	if *outputFile != "" {
-		// Write to file
-		if err := os.WriteFile(*outputFile, []byte(html), 0644); err != nil {
-			return fmt.Errorf("failed to write output file: %w", err)
-		}
-		fmt.Fprintf(os.Stderr, "Presentation generated: %s\n", *outputFile)
+	if strings.HasPrefix(backend.MediaType(), "text/html") {
+		result.HTML = string(document)
+		result.Assets = gen.Assets()
 	} else {
-		// Write to stdout
-		fmt.Print(html)
+		result.Document = document
 	}
+	return result, nil
+}
 
-	return nil
+// applyMetadata applies the settings of the presentation metadata that
+// flags and configuration files can also make. Configuration files set
+// defaults, which presentation metadata overrides, which flags given on
+// the command line override in turn. The applied settings are cleared from
+// the metadata, so that the generator uses the resolved ones.
+func (s *buildSettings) applyMetadata(metadata *parser.PresentationMetadata) {
+	if metadata.Title != "" && !s.Flags["title"] {
+		s.Title = metadata.Title
+	}
+	if metadata.IsSet("presenter") && !s.Flags["presenter"] {
+		s.Presenter = metadata.Presenter
+	}
+	if metadata.IsSet("subset-fonts") && !s.Flags["subset-fonts"] {
+		s.SubsetFonts = metadata.SubsetFonts
+	}
+	if metadata.HighlightStyle != "" && !s.Flags["highlight-style"] {
+		s.Highlight = metadata.HighlightStyle
+	}
+	metadata.Title, metadata.Presenter, metadata.SubsetFonts, metadata.HighlightStyle = "", false, false, ""
+}
+
+// splitThemePath splits a -theme-path value into directories
+func splitThemePath(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return filepath.SplitList(value)
 }
 
+// printDiagnostics writes parser diagnostics to stderr, one per line
+func printDiagnostics(diagnostics []parser.Diagnostic) {
+	for _, d := range diagnostics {
+		fmt.Fprintln(os.Stderr, d)
+	}
+}
+
+// countErrors returns the number of error-severity diagnostics
+func countErrors(diagnostics []parser.Diagnostic) int {
+	count := 0
+	for _, d := range diagnostics {
+		if d.Severity == parser.SeverityError {
+			count++
+		}
+	}
+	return count
+}
+
+// usage prints the overview of gobig and its commands
 func usage() {
 	fmt.Fprintf(os.Stderr, `gobig - Generate big.js presentations from Markdown
 
 Usage:
-  gobig [options] <input.md>
+  gobig <command> [options] [arguments]
+  gobig [options] <input.md>...     (shorthand for gobig build)
 
-Options:
-  -o <file>              Output HTML file (default: stdout)
-  -theme <name>          Theme: dark, light, or white (default: dark)
-  -aspect-ratio <ratio>  Aspect ratio: number or "false" to disable (default: 1.6)
-  -title <title>         Presentation title (default: from first slide)
-  -version               Show version information
-  -help                  Show this help message
+Commands:
+`)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.Name, c.Summary)
+	}
+	fmt.Fprintf(os.Stderr, `
+Run gobig help <command> for the options of a command.
 
 Examples:
-  gobig -o index.html presentation.md
-  gobig -theme light -o output.html slides.md
-  gobig -aspect-ratio 2 -title "My Talk" -o slides.html talk.md
+  gobig init talk
+  gobig serve -theme light talk/slides.md
+  gobig lint -strict talk/slides.md
+  gobig -o talk.html talk/slides.md
+  gobig export -format pdf -pdf-notes talk/slides.md
+  source <(gobig completion bash)
+
+Configuration:
+  Defaults for the flags are read from gobig.yaml, .gobig.yaml, gobig.toml
+  or .gobig.toml next to the first input file and in its parent directories
+  up to the repository root, the nearest file winning. Settings are named
+  like the flags; targets lists outputs to build. Presentation metadata
+  overrides configuration files, and flags override both.
 
 Markdown Syntax:
   Slides:      Separate with --- (horizontal rule)
-  Notes:       Use HTML comments: <!-- speaker notes here -->
+  Includes:    <!-- include: modules/intro.md --> on its own line inserts
+               another file, resolved relative to the including file
+  Code:        Fenced code blocks are highlighted; add {3-5} after the
+               language to highlight lines, {1-3|5} to step through groups
+               of lines, and showLineNumbers to number them
+  Diagrams:    Fenced dot, flowchart and sequence blocks become inline SVG
+  Math:        $...$ inline and $$...$$ display TeX math, rendered as MathML
+  Notes:       Use <!-- notes ... --> or end the slide with a ???, Note:
+               or Notes: line; bare HTML comments are notes by default
   Metadata:    Use YAML frontmatter in comments:
                <!-- slide
                layout: 50-50
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gobig/internal/generator"
+)
+
+// reloadPath is the Server-Sent Events endpoint the browser listens on
+const reloadPath = "/__gobig/reload"
+
+// reloadScript is injected into served pages. It reloads the page when the
+// server reports a rebuild; big.js and reveal.js restore the current slide
+// from the hash.
+const reloadScript = `<script>
+  new EventSource("` + reloadPath + `").addEventListener("reload", () => location.reload());
+</script>
+`
+
+// server serves the latest build of a presentation and notifies browsers
+// when it changes
+type server struct {
+	inputFiles []string
+	settings   buildSettings
+
+	mu      sync.RWMutex
+	page    string               // Latest page, with the reload script injected
+	files   map[string]fileStamp // Watched files and their last seen state
+	clients map[chan struct{}]bool
+}
+
+// fileStamp records enough about a file to notice that it changed
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+// serveCommand serves a presentation with live reload
+var serveCommand = &command{
+	Name:    "serve",
+	Summary: "Serve a presentation locally and reload the browser when files change",
+	Usage: `Usage:
+  gobig serve [options] <input.md>...
+
+Serves the presentation over HTTP, rebuilding it and reloading the browser
+whenever the markdown or a referenced local file changes.
+`,
+	Examples: `  gobig serve talk.md
+  gobig serve -addr :8080 -format reveal talk.md
+`,
+	Setup: setupServe,
+}
+
+// setupServe defines the flags of the serve command
+func setupServe(fs *flag.FlagSet) func() error {
+	deck := addDeckFlags(fs)
+	addr := fs.String("addr", "localhost:8000", "Address to listen on")
+	interval := fs.Duration("interval", 500*time.Millisecond, "How often to check files for changes")
+	format := fs.String("format", "html", "Output format: html (big.js) or reveal (reveal.js)")
+	revealURL := fs.String("reveal-url", "", "Base URL of the reveal.js package for reveal output (default: jsDelivr CDN)")
+
+	return func() error {
+		if fs.NArg() == 0 {
+			fs.Usage()
+			return fmt.Errorf("at least one input file required")
+		}
+		explicit, _, err := applyConfig(fs, fs.Arg(0), false)
+		if err != nil {
+			return err
+		}
+		if backend, ok := generator.LookupBackend(*format); ok && !strings.HasPrefix(backend.MediaType(), "text/html") {
+			return fmt.Errorf("cannot serve %s output: use html or reveal", *format)
+		}
+
+		settings := deck.settings()
+		settings.Format = *format
+		settings.RevealURL = *revealURL
+		settings.Flags = explicit
+
+		s := &server{
+			inputFiles: fs.Args(),
+			settings:   settings,
+			clients:    make(map[chan struct{}]bool),
+		}
+		s.rebuild()
+
+		go s.watch(*interval)
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", s.handlePage)
+		mux.HandleFunc(reloadPath, s.handleReload)
+
+		fmt.Fprintf(os.Stderr, "Serving %s at http://%s/ (Ctrl+C to stop)\n", strings.Join(s.inputFiles, ", "), *addr)
+		return http.ListenAndServe(*addr, mux)
+	}
+}
+
+// rebuild regenerates the page and records the files it depends on. Build
+// errors are shown in the browser instead of stopping the server.
+func (s *server) rebuild() {
+	files := s.inputFiles
+
+	var page string
+	result, err := build(s.inputFiles, s.settings)
+	if result != nil {
+		files = result.Files
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		page = errorPage(err)
+	} else {
+		page = injectBeforeBodyEnd(result.HTML, reloadScript)
+		fmt.Fprintf(os.Stderr, "Rebuilt %s\n", strings.Join(s.inputFiles, ", "))
+	}
+
+	stamps := make(map[string]fileStamp, len(files))
+	for _, file := range files {
+		stamps[file] = stat(file)
+	}
+
+	s.mu.Lock()
+	s.page = page
+	s.files = stamps
+	s.mu.Unlock()
+}
+
+// watch polls the watched files and rebuilds when any of them change
+func (s *server) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !s.changed() {
+			continue
+		}
+		s.rebuild()
+		s.notify()
+	}
+}
+
+// changed reports whether any watched file differs from its recorded state
+func (s *server) changed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for file, stamp := range s.files {
+		if stat(file) != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// notify tells every connected browser to reload
+func (s *server) notify() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for client := range s.clients {
+		select {
+		case client <- struct{}{}:
+		default:
+			// A reload is already pending for this client
+		}
+	}
+}
+
+// handlePage serves the latest build of the presentation
+func (s *server) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" && r.URL.Path != "/index.html" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	page := s.page
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, page)
+}
+
+// handleReload streams reload events to a browser until it disconnects
+func (s *server) handleReload(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	client := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.clients[client] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, client)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client:
+			fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// stat returns the current state of a file
+func stat(file string) fileStamp {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size(), exists: true}
+}
+
+// injectBeforeBodyEnd inserts snippet before the closing body tag
+func injectBeforeBodyEnd(page, snippet string) string {
+	i := strings.LastIndex(page, "</body>")
+	if i < 0 {
+		return page + snippet
+	}
+	return page[:i] + snippet + page[i:]
+}
+
+// errorPage renders a build error so it is visible in the browser
+func errorPage(err error) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Build failed</title>
+</head>
+<body style="font-family: monospace; padding: 2em;">
+  <h1>Build failed</h1>
+  <pre>%s</pre>
+  <p>See the terminal for diagnostics. The page reloads when the file changes.</p>
+%s</body>
+</html>`, html.EscapeString(err.Error()), reloadScript)
+}
@@ -3,6 +3,12 @@ module gobig
 go 1.24
 
 require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/alecthomas/chroma/v2 v2.20.0
+	github.com/go-pdf/fpdf v0.9.0
 	github.com/yuin/goldmark v1.7.13
+	golang.org/x/net v0.43.0
 	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/dlclark/regexp2 v1.11.5 // indirect
@@ -3,9 +3,11 @@ package assets
 import (
 	"embed"
 	"fmt"
+	"path"
+	"strings"
 )
 
-//go:embed embed/big.js embed/big.css embed/themes/*.css
+//go:embed embed/big.js embed/big.css embed/presenter.js embed/themes/*.css
 var files embed.FS
 
 // GetBigJS returns the big.js JavaScript content
@@ -26,6 +28,15 @@ func GetBigCSS() (string, error) {
 	return string(content), nil
 }
 
+// GetPresenterJS returns the presenter view script that runs alongside big.js
+func GetPresenterJS() (string, error) {
+	content, err := files.ReadFile("embed/presenter.js")
+	if err != nil {
+		return "", fmt.Errorf("failed to read presenter.js: %w", err)
+	}
+	return string(content), nil
+}
+
 // GetTheme returns the theme CSS content for the specified theme
 // Valid themes: "dark", "light", "white"
 func GetTheme(theme string) (string, error) {
@@ -37,12 +48,27 @@ func GetTheme(theme string) (string, error) {
 	return string(content), nil
 }
 
+// ThemeNames returns the names of the built-in themes, sorted
+func ThemeNames() []string {
+	entries, err := files.ReadDir("embed/themes")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if path.Ext(entry.Name()) == ".css" {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".css"))
+		}
+	}
+	return names
+}
+
 // ValidateTheme checks if a theme name is valid
 func ValidateTheme(theme string) bool {
-	validThemes := map[string]bool{
-		"dark":  true,
-		"light": true,
-		"white": true,
+	for _, name := range ThemeNames() {
+		if name == theme {
+			return true
+		}
 	}
-	return validThemes[theme]
+	return false
 }
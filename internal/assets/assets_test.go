@@ -1,6 +1,13 @@
 package assets
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -41,6 +48,22 @@ func TestGetBigCSS(t *testing.T) {
 	}
 }
 
+func TestGetPresenterJS(t *testing.T) {
+	content, err := GetPresenterJS()
+	if err != nil {
+		t.Fatalf("GetPresenterJS() failed: %v", err)
+	}
+
+	if !strings.Contains(content, "GOBIG_PRESENTER_DURATION") {
+		t.Error("presenter.js does not read the presenter duration")
+	}
+
+	// The script is inlined into a <script> element, so it must not close it
+	if strings.Contains(strings.ToLower(content), "</script") {
+		t.Error("presenter.js contains a literal closing script tag")
+	}
+}
+
 func TestGetTheme(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -118,3 +141,342 @@ func TestValidateTheme(t *testing.T) {
 		})
 	}
 }
+
+func TestThemeNames(t *testing.T) {
+	got := strings.Join(ThemeNames(), " ")
+	if got != "dark light white" {
+		t.Errorf("ThemeNames() = %q, want %q", got, "dark light white")
+	}
+}
+
+func TestLoadThemeBuiltIn(t *testing.T) {
+	theme, err := LoadTheme("light", nil)
+	if err != nil {
+		t.Fatalf("LoadTheme() failed: %v", err)
+	}
+
+	if theme.Name != "light" {
+		t.Errorf("Name = %q, want %q", theme.Name, "light")
+	}
+	if len(theme.Files) != 0 {
+		t.Errorf("Built-in theme should have no files, got %v", theme.Files)
+	}
+}
+
+func TestLoadThemeFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "company brand.css")
+	writeFile(t, path, "body { background: #123; }")
+
+	theme, err := LoadTheme(path, nil)
+	if err != nil {
+		t.Fatalf("LoadTheme() failed: %v", err)
+	}
+
+	if theme.Name != "company-brand" {
+		t.Errorf("Name = %q, want %q", theme.Name, "company-brand")
+	}
+	if !strings.Contains(theme.CSS, "#123") {
+		t.Error("Theme CSS should be read from the file")
+	}
+}
+
+func TestLoadThemeDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "brand")
+	writeFile(t, filepath.Join(dir, "theme.css"), `@font-face { font-family: Brand; src: url("fonts/brand.woff2") format("woff2"); }
+body { background: url(logo.png) no-repeat, url(https://example.com/bg.png); }
+/* url(ignored.png) */`)
+	writeFile(t, filepath.Join(dir, "fonts", "brand.woff2"), "font")
+	writeFile(t, filepath.Join(dir, "logo.png"), "png")
+
+	theme, err := LoadTheme(dir, nil)
+	if err != nil {
+		t.Fatalf("LoadTheme() failed: %v", err)
+	}
+
+	if theme.Name != "brand" {
+		t.Errorf("Name = %q, want %q", theme.Name, "brand")
+	}
+	if !strings.Contains(theme.CSS, `url("data:font/woff2;base64,Zm9udA==")`) {
+		t.Error("Font should be inlined as a data URI")
+	}
+	if !strings.Contains(theme.CSS, `url("data:image/png;base64,cG5n")`) {
+		t.Error("Image should be inlined as a data URI")
+	}
+	if !strings.Contains(theme.CSS, "url(https://example.com/bg.png)") {
+		t.Error("Remote URLs should be left alone")
+	}
+	if len(theme.Files) != 3 {
+		t.Errorf("Files = %v, want the stylesheet and its two references", theme.Files)
+	}
+}
+
+func TestLoadThemeConfine(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "themes", "brand")
+	writeFile(t, filepath.Join(root, "secret.txt"), "secret")
+	writeFile(t, filepath.Join(dir, "logo.png"), "png")
+	writeFile(t, filepath.Join(dir, "theme.css"), `body { background: url(logo.png), url("../../secret.txt"); }`)
+
+	if _, err := LoadThemeWithOptions(dir, ThemeOptions{}); err != nil {
+		t.Fatalf("LoadThemeWithOptions() failed: %v", err)
+	}
+
+	theme, err := LoadThemeWithOptions(dir, ThemeOptions{Confine: true})
+	if err == nil || !strings.Contains(err.Error(), "url(../../secret.txt) refers to a file outside the theme's directory") {
+		t.Fatalf("LoadThemeWithOptions() error = %v, want the reference outside the theme refused", err)
+	}
+	if strings.Contains(theme.CSS, "c2VjcmV0") {
+		t.Error("A file outside the theme's directory should not be inlined")
+	}
+}
+
+func TestWithinDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "talk")
+	writeFile(t, filepath.Join(dir, "talk.md"), "# Talk")
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{dir, true},
+		{filepath.Join(dir, "talk.md"), true},
+		{filepath.Join(dir, "images", "missing.png"), true},
+		{filepath.Join(dir, "..", "secret.txt"), false},
+		{filepath.Join(dir, "images", "..", "..", "secret.txt"), false},
+		{dir + "-other", false},
+	}
+	for _, tt := range tests {
+		if got := WithinDir(dir, tt.path); got != tt.want {
+			t.Errorf("WithinDir(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLoadThemeSearchPath(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "acme.css"), "body { color: red; }")
+	writeFile(t, filepath.Join(dir, "globex", "theme.css"), "body { color: blue; }")
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"acme", "red"},
+		{"globex", "blue"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			theme, err := LoadTheme(tt.name, []string{filepath.Join(dir, "missing"), dir})
+			if err != nil {
+				t.Fatalf("LoadTheme() failed: %v", err)
+			}
+			if !strings.Contains(theme.CSS, tt.want) {
+				t.Errorf("CSS = %q, want it to contain %q", theme.CSS, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadTheme("initech", []string{dir}); err == nil {
+		t.Error("LoadTheme() should fail for a theme not in the search path")
+	}
+}
+
+func TestLoadThemeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		css  string
+		want string
+	}{
+		{"missing file", "body { background: url(missing.png); }", "missing file"},
+		{"unbalanced", "body { color: red;", "unbalanced braces"},
+		{"extra brace", "body { color: red; } }", "unexpected }"},
+		{"closes style", "body { content: '</style>'; }", "</style"},
+		{"unterminated comment", "/* body { }", "unterminated comment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "theme.css")
+			writeFile(t, path, tt.css)
+
+			theme, err := LoadTheme(path, nil)
+			if err == nil {
+				t.Fatal("LoadTheme() should fail")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.want)
+			}
+			if theme == nil || len(theme.Files) == 0 || theme.Files[0] != path {
+				t.Error("Invalid theme should still report its files")
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubsetFont(t *testing.T) {
+	font := testFont()
+
+	subset, err := SubsetFont(font, "Ω")
+	if err != nil {
+		t.Fatalf("SubsetFont() failed: %v", err)
+	}
+
+	tables, err := readSFNT(subset)
+	if err != nil {
+		t.Fatalf("subset font is not readable: %v", err)
+	}
+	if tables["GSUB"] != nil {
+		t.Error("Glyph substitutions should be dropped")
+	}
+	if fontChecksum(subset) != 0xB1B0AFBA {
+		t.Error("Font checksum adjustment should be updated")
+	}
+
+	offsets, err := readLoca(tables["loca"], 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lengths := make([]uint32, 4)
+	for i := range lengths {
+		lengths[i] = offsets[i+1] - offsets[i]
+	}
+	// é is unused; Ω is a composite of ß, which must be kept
+	want := []uint32{12, 0, 12, 16}
+	for i := range want {
+		if lengths[i] != want[i] {
+			t.Errorf("glyph lengths = %v, want %v", lengths, want)
+			break
+		}
+	}
+}
+
+func TestSubsetFontWOFF(t *testing.T) {
+	subset, err := SubsetFont(testWOFF(t, testFont()), "é")
+	if err != nil {
+		t.Fatalf("SubsetFont() failed: %v", err)
+	}
+	if string(subset[:4]) != "\x00\x01\x00\x00" {
+		t.Error("WOFF fonts should be unwrapped to TrueType")
+	}
+}
+
+func TestSubsetFontWOFFTruncatedTable(t *testing.T) {
+	font := testFont()
+	tables, err := readSFNT(font)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables["head"] = tables["head"][:8]
+	woff := testWOFF(t, writeSFNT(0x00010000, tables))
+
+	if _, err := SubsetFont(woff, "é"); err == nil || !strings.Contains(err.Error(), "truncated head table") {
+		t.Errorf("SubsetFont() error = %v, want a truncated head table error", err)
+	}
+}
+
+func TestSubsetFontUnsupported(t *testing.T) {
+	for _, data := range [][]byte{
+		append([]byte("OTTO"), make([]byte, 8)...),
+		append([]byte("wOF2"), make([]byte, 44)...),
+	} {
+		if _, err := SubsetFont(data, "a"); !errors.Is(err, ErrSubsetUnsupported) {
+			t.Errorf("SubsetFont(%q) error = %v, want ErrSubsetUnsupported", data[:4], err)
+		}
+	}
+}
+
+// testFont builds a minimal TrueType font mapping é, ß and Ω to glyphs 1 to
+// 3, where Ω is a composite glyph made of ß
+func testFont() []byte {
+	head := make([]byte, 54) // indexToLocFormat 0: short offsets
+	maxp := []byte{0, 0, 0x50, 0, 0, 4}
+
+	simple := []byte{0, 1, 0, 0, 0, 0, 0, 10, 0, 10, 0, 0}
+	composite := []byte{0xff, 0xff, 0, 0, 0, 0, 0, 10, 0, 10, 0, 0, 0, 2, 0, 0}
+	glyf := append(append(append(append([]byte{}, simple...), simple...), simple...), composite...)
+	loca := writeLoca([]uint32{0, 12, 24, 36, 52}, false)
+
+	// cmap with a single format 4 subtable, one segment per character
+	chars := []uint16{0xdf, 0xe9, 0x3a9, 0xffff}
+	gids := []uint16{2, 1, 3, 0}
+	segCount := len(chars)
+	sub := []byte{0, 4, 0, 0, 0, 0, 0, byte(segCount * 2), 0, 0, 0, 0, 0, 0}
+	appendU16 := func(b []byte, v uint16) []byte { return append(b, byte(v>>8), byte(v)) }
+	for _, c := range chars {
+		sub = appendU16(sub, c)
+	}
+	sub = appendU16(sub, 0)
+	for _, c := range chars {
+		sub = appendU16(sub, c)
+	}
+	for i, c := range chars {
+		sub = appendU16(sub, gids[i]-c)
+	}
+	for range chars {
+		sub = appendU16(sub, 0)
+	}
+	cmap := append([]byte{0, 0, 0, 1, 0, 3, 0, 1, 0, 0, 0, 12}, sub...)
+
+	return writeSFNT(0x00010000, map[string][]byte{
+		"head": head,
+		"maxp": maxp,
+		"cmap": cmap,
+		"loca": loca,
+		"glyf": glyf,
+		"GSUB": {0, 1, 0, 0},
+	})
+}
+
+// testWOFF wraps a TrueType font in WOFF, compressing its glyf table
+func testWOFF(t *testing.T, font []byte) []byte {
+	t.Helper()
+	tables, err := readSFNT(font)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tags []string
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	header := make([]byte, 44+20*len(tags))
+	copy(header, "wOFF")
+	binary.BigEndian.PutUint32(header[4:], 0x00010000)
+	binary.BigEndian.PutUint16(header[12:], uint16(len(tags)))
+
+	var body bytes.Buffer
+	for i, tag := range tags {
+		table := tables[tag]
+		if tag == "glyf" {
+			var compressed bytes.Buffer
+			w := zlib.NewWriter(&compressed)
+			w.Write(table)
+			w.Close()
+			if compressed.Len() < len(table) {
+				table = compressed.Bytes()
+			}
+		}
+
+		record := header[44+20*i:]
+		copy(record, tag)
+		binary.BigEndian.PutUint32(record[4:], uint32(len(header)+body.Len()))
+		binary.BigEndian.PutUint32(record[8:], uint32(len(table)))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(tables[tag])))
+		body.Write(table)
+	}
+	return append(header, body.Bytes()...)
+}
@@ -0,0 +1,193 @@
+// gobig presenter view
+//
+// Press "s" during a talk to open a presenter window showing the current
+// slide, a preview of the next slide, speaker notes, a timer and a slide
+// counter. The presenter window is the deck itself opened with ?presenter,
+// so it runs the deck's own scripts and also works under its Content
+// Security Policy. The windows stay in sync through a BroadcastChannel,
+// which finds the other window after either is reloaded or when the
+// presenter view is opened by hand, and through postMessage between the
+// deck and the window it opened, which also works when the deck is opened
+// straight from disk.
+(() => {
+  const PREVIEW_NAME = "gobig-preview";
+  const PRESENTER_NAME = "gobig-presenter";
+  const DURATION = window.GOBIG_PRESENTER_DURATION || 0; // seconds, 0 = no target
+
+  const STYLE = `
+    .presentation-container { display: none !important; }
+    #gobig-presenter { position: fixed; inset: 0; z-index: 2147483647; display: grid; grid-template-columns: 3fr 2fr; grid-template-rows: auto 1fr 1fr; gap: 12px; padding: 12px; box-sizing: border-box; background: #111; color: #eee; font: 16px -apple-system, "Helvetica Neue", Helvetica, Arial, sans-serif; text-align: left; }
+    #gobig-presenter header { grid-column: 1 / 3; display: flex; justify-content: space-between; align-items: baseline; font-size: 28px; font-variant-numeric: tabular-nums; }
+    #gobig-presenter .frame { position: relative; background: #000; border: 1px solid #333; }
+    #gobig-presenter .frame iframe { position: absolute; inset: 0; width: 100%; height: 100%; border: 0; pointer-events: none; }
+    #gobig-presenter .label { position: absolute; top: 4px; left: 8px; z-index: 1; font-size: 12px; color: #888; text-transform: uppercase; }
+    #gobig-presenter .current { grid-row: 2 / 4; }
+    #gobig-presenter .notes { overflow: auto; font-size: 22px; line-height: 1.4; padding: 0 8px; white-space: pre-wrap; }
+    #gobig-presenter .remaining.over { color: #f55; }
+    #gobig-presenter button { font: inherit; font-size: 14px; background: #333; color: #eee; border: 0; padding: 4px 10px; margin-left: 8px; cursor: pointer; }`;
+
+  const VIEW = `
+  <header>
+    <span class="counter">-</span>
+    <span><span class="elapsed">00:00</span> <span class="remaining"></span><button class="reset">Reset</button></span>
+  </header>
+  <div class="frame current"><span class="label">Current</span><iframe name="${PREVIEW_NAME}"></iframe></div>
+  <div class="frame next"><span class="label">Next</span><iframe name="${PREVIEW_NAME}"></iframe></div>
+  <div class="notes"></div>`;
+
+  const presenting = window.name === PRESENTER_NAME || new URLSearchParams(location.search).has("presenter");
+
+  if (window.name === PREVIEW_NAME || presenting) {
+    // Previews follow the presenter and the presenter view follows the
+    // deck, so neither auto-advances on its own
+    addEventListener("DOMContentLoaded", () => {
+      for (let slide of document.querySelectorAll("body > div")) delete slide.dataset.timeToNext;
+    });
+  }
+  if (window.name === PREVIEW_NAME) return;
+
+  // deck is the address of the deck, without a slide number or ?presenter
+  const deck = (() => {
+    let url = new URL(location.href);
+    url.hash = "";
+    url.searchParams.delete("presenter");
+    return url.href;
+  })();
+
+  // Messages are idempotent, since they may arrive over both transports
+  const channel = "BroadcastChannel" in window ? new BroadcastChannel("gobig-presenter " + deck) : null;
+  let peer = presenting ? window.opener : null; // The window at the other end of postMessage
+
+  function post(msg) {
+    if (channel) channel.postMessage(msg);
+    if (peer && !peer.closed) peer.postMessage(msg, "*");
+  }
+
+  function listen(handle) {
+    if (channel) channel.addEventListener("message", e => handle(e.data || {}));
+    addEventListener("message", e => {
+      let msg = e.data || {};
+      if (typeof msg.type !== "string" || !msg.type.startsWith("gobig-")) return;
+      if (e.source && e.source !== window) peer = e.source;
+      handle(msg);
+    });
+  }
+
+  if (presenting) {
+    addEventListener("load", presenterView);
+  } else {
+    addEventListener("load", audienceView);
+  }
+
+  // audienceView reports the current slide to the presenter view and takes
+  // its commands
+  function audienceView() {
+    const send = () => post({ type: "gobig-state", current: window.big.current, length: window.big.length });
+
+    listen(msg => {
+      if (msg.type === "gobig-ready") send();
+      else if (msg.type === "gobig-go" && window.big.mode === "talk") window.big.go(msg.current);
+    });
+
+    addEventListener("hashchange", send);
+    document.addEventListener("keydown", e => {
+      if (e.key === "s" && window.big.mode === "talk") openPresenter();
+    });
+    send();
+    console.log("Press s to open the presenter view.");
+  }
+
+  function openPresenter() {
+    if (peer && !peer.closed) return peer.focus();
+    let url = new URL(deck);
+    url.searchParams.set("presenter", "");
+    peer = window.open(url.href, PRESENTER_NAME, "width=1100,height=700");
+    if (!peer) console.warn("gobig: allow pop-ups for this page to open the presenter view");
+  }
+
+  // presenterView replaces the deck with the presenter view, once big.js
+  // has set it up and collected the notes of every slide
+  function presenterView() {
+    const slideContainers = Array.from(document.querySelectorAll(".slide-container"));
+    const root = document.body.appendChild(document.createElement("div"));
+    root.id = "gobig-presenter";
+    root.innerHTML = VIEW;
+    const $ = name => root.querySelector("." + name);
+
+    // Constructed stylesheets are not inline styles as far as CSP is concerned
+    let sheet = new CSSStyleSheet();
+    sheet.replaceSync(STYLE);
+    document.adoptedStyleSheets = [...document.adoptedStyleSheets, sheet];
+    document.title = "Presenter view";
+
+    let state = null,
+      start = Date.now();
+
+    function show(frame, n, length) {
+      let iframe = frame.querySelector("iframe");
+      frame.style.visibility = n < length ? "" : "hidden";
+      if (n >= length || iframe.dataset.n === String(n)) return;
+      iframe.dataset.n = n;
+      iframe.src = deck + "#" + n;
+    }
+
+    function update(msg) {
+      if (state && state.current === msg.current && state.length === msg.length) return;
+      state = msg;
+      $("counter").textContent = (msg.current + 1) + " / " + msg.length;
+      show($("current"), msg.current, msg.length);
+      show($("next"), msg.current + 1, msg.length);
+      let notes = slideContainers[msg.current] ? slideContainers[msg.current]._notes.join("\n\n") : "";
+      // Markdown notes are HTML; plain text notes keep their line breaks
+      $("notes").style.whiteSpace = /^\s*</.test(notes) ? "normal" : "pre-wrap";
+      $("notes").innerHTML = notes;
+    }
+
+    function clock(seconds) {
+      let s = Math.abs(Math.round(seconds));
+      return (seconds < 0 ? "-" : "") + String(Math.floor(s / 60)).padStart(2, "0") + ":" + String(s % 60).padStart(2, "0");
+    }
+
+    function tick() {
+      let elapsed = (Date.now() - start) / 1000;
+      $("elapsed").textContent = clock(elapsed);
+      if (DURATION > 0) {
+        $("remaining").textContent = "(" + clock(DURATION - elapsed) + " left)";
+        $("remaining").classList.toggle("over", elapsed > DURATION);
+      }
+      // Ask again every second, so that a reloaded deck is found again
+      post({ type: "gobig-ready" });
+    }
+
+    function reset() {
+      start = Date.now();
+      tick();
+    }
+
+    // Listen before big.js, which would otherwise move the hidden deck
+    addEventListener("keydown", e => {
+      e.stopImmediatePropagation();
+      let step = {
+        ArrowRight: 1, ArrowDown: 1, PageDown: 1, " ": 1,
+        ArrowLeft: -1, ArrowUp: -1, PageUp: -1
+      }[e.key];
+      if (step) {
+        e.preventDefault();
+        if (state) post({ type: "gobig-go", current: Math.max(0, Math.min(state.length - 1, state.current + step)) });
+      } else if (e.key === "r") {
+        reset();
+      }
+    }, true);
+    addEventListener("click", e => {
+      e.stopImmediatePropagation();
+      if (e.target.closest(".reset")) reset();
+    }, true);
+    addEventListener("touchstart", e => e.stopImmediatePropagation(), true);
+
+    listen(msg => {
+      if (msg.type === "gobig-state") update(msg);
+    });
+    setInterval(tick, 1000);
+    tick();
+  }
+})();
@@ -0,0 +1,458 @@
+package assets
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrSubsetUnsupported is returned by SubsetFont for fonts it cannot subset,
+// such as WOFF2, CFF-based OpenType and variable fonts. Such fonts can still
+// be embedded whole.
+var ErrSubsetUnsupported = errors.New("subsetting is only supported for TrueType fonts (ttf, or woff wrapping ttf)")
+
+// Tables dropped from subset fonts: glyph substitutions could point at
+// removed glyphs, and a digital signature no longer matches
+var droppedFontTables = map[string]bool{
+	"GSUB": true,
+	"morx": true,
+	"mort": true,
+	"DSIG": true,
+}
+
+// IsFontFile reports whether filename has a font file extension
+func IsFontFile(filename string) bool {
+	return strings.HasPrefix(contentType(filename), "font/")
+}
+
+// FontDataURI encodes a font file as a data URI
+func FontDataURI(filename string, data []byte) string {
+	return dataURI(filename, data)
+}
+
+// SubsetFont reduces a TrueType font to the glyphs needed to render text.
+// Glyphs keep their IDs, so that metrics, kerning and character maps stay
+// valid; the outlines of unused glyphs are removed, as are glyph
+// substitution tables such as ligatures. WOFF input is unwrapped and the
+// result is always a TrueType font.
+func SubsetFont(data []byte, text string) ([]byte, error) {
+	if bytes.HasPrefix(data, []byte("wOFF")) {
+		sfnt, err := decodeWOFF(data)
+		if err != nil {
+			return nil, err
+		}
+		data = sfnt
+	}
+
+	tables, err := readSFNT(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range []string{"head", "maxp", "cmap", "loca", "glyf"} {
+		if tables[tag] == nil {
+			return nil, ErrSubsetUnsupported
+		}
+	}
+	if tables["gvar"] != nil {
+		return nil, ErrSubsetUnsupported
+	}
+
+	head := tables["head"]
+	if len(head) < 54 || len(tables["maxp"]) < 6 {
+		return nil, fmt.Errorf("invalid font: truncated head or maxp table")
+	}
+	longLoca := binary.BigEndian.Uint16(head[50:]) == 1
+	numGlyphs := int(binary.BigEndian.Uint16(tables["maxp"][4:]))
+
+	offsets, err := readLoca(tables["loca"], numGlyphs, longLoca)
+	if err != nil {
+		return nil, err
+	}
+	glyf := tables["glyf"]
+	glyph := func(gid int) []byte {
+		start, end := offsets[gid], offsets[gid+1]
+		if start > end || end > uint32(len(glyf)) {
+			return nil
+		}
+		return glyf[start:end]
+	}
+
+	// Keep .notdef, the glyphs of every character used, and the components
+	// of composite glyphs
+	keep := map[int]bool{0: true}
+	var pending []int
+	for _, gid := range cmapGlyphs(tables["cmap"], glyphRunes(text)) {
+		if gid < numGlyphs && !keep[gid] {
+			keep[gid] = true
+			pending = append(pending, gid)
+		}
+	}
+	for len(pending) > 0 {
+		gid := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, component := range glyphComponents(glyph(gid)) {
+			if component < numGlyphs && !keep[component] {
+				keep[component] = true
+				pending = append(pending, component)
+			}
+		}
+	}
+
+	var newGlyf bytes.Buffer
+	newOffsets := make([]uint32, numGlyphs+1)
+	for gid := 0; gid < numGlyphs; gid++ {
+		newOffsets[gid] = uint32(newGlyf.Len())
+		if keep[gid] {
+			newGlyf.Write(glyph(gid))
+			// Short loca offsets are stored divided by two
+			if !longLoca && newGlyf.Len()%2 != 0 {
+				newGlyf.WriteByte(0)
+			}
+		}
+	}
+	newOffsets[numGlyphs] = uint32(newGlyf.Len())
+
+	tables["glyf"] = newGlyf.Bytes()
+	tables["loca"] = writeLoca(newOffsets, longLoca)
+	for tag := range droppedFontTables {
+		delete(tables, tag)
+	}
+
+	return writeSFNT(binary.BigEndian.Uint32(data), tables), nil
+}
+
+// glyphRunes returns the characters whose glyphs are kept when subsetting
+// for text: the text itself in every case, so that CSS text-transform still
+// works, plus printable ASCII
+func glyphRunes(text string) []rune {
+	seen := map[rune]bool{}
+	for r := rune(0x20); r < 0x7f; r++ {
+		seen[r] = true
+	}
+	for _, r := range text {
+		seen[r] = true
+		seen[unicode.ToUpper(r)] = true
+		seen[unicode.ToLower(r)] = true
+	}
+
+	runes := make([]rune, 0, len(seen))
+	for r := range seen {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return runes
+}
+
+// readSFNT splits a TrueType font into its tables
+func readSFNT(data []byte) (map[string][]byte, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("invalid font: file too short")
+	}
+	switch string(data[:4]) {
+	case "\x00\x01\x00\x00", "true":
+	case "OTTO", "ttcf", "wOF2":
+		return nil, ErrSubsetUnsupported
+	default:
+		return nil, fmt.Errorf("invalid font: unknown format")
+	}
+
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+16*numTables {
+		return nil, fmt.Errorf("invalid font: truncated table directory")
+	}
+
+	tables := make(map[string][]byte, numTables)
+	for i := 0; i < numTables; i++ {
+		record := data[12+16*i:]
+		tag := string(record[:4])
+		offset := binary.BigEndian.Uint32(record[8:])
+		length := binary.BigEndian.Uint32(record[12:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid font: table %s out of bounds", tag)
+		}
+		tables[tag] = data[offset : offset+length]
+	}
+	return tables, nil
+}
+
+// writeSFNT assembles tables into a font file with the given version,
+// updating table and font checksums
+func writeSFNT(version uint32, tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	numTables := len(tags)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	header := make([]byte, 12+16*numTables)
+	binary.BigEndian.PutUint32(header[0:], version)
+	binary.BigEndian.PutUint16(header[4:], uint16(numTables))
+	binary.BigEndian.PutUint16(header[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(header[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(header[10:], uint16(numTables*16-searchRange))
+
+	var body bytes.Buffer
+	headOffset := -1
+	for i, tag := range tags {
+		table := tables[tag]
+		if tag == "head" && len(table) >= 12 {
+			// The font checksum adjustment is computed over a zeroed field
+			table = append([]byte{}, table...)
+			binary.BigEndian.PutUint32(table[8:], 0)
+			headOffset = len(header) + body.Len()
+		}
+
+		record := header[12+16*i:]
+		copy(record, tag)
+		binary.BigEndian.PutUint32(record[4:], fontChecksum(table))
+		binary.BigEndian.PutUint32(record[8:], uint32(len(header)+body.Len()))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(table)))
+
+		body.Write(table)
+		for body.Len()%4 != 0 {
+			body.WriteByte(0)
+		}
+	}
+
+	font := append(header, body.Bytes()...)
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(font[headOffset+8:], 0xB1B0AFBA-fontChecksum(font))
+	}
+	return font
+}
+
+// fontChecksum sums data as big-endian uint32 words, zero padded
+func fontChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// readLoca returns the glyf offsets of numGlyphs glyphs plus the end offset
+func readLoca(loca []byte, numGlyphs int, long bool) ([]uint32, error) {
+	size := 2
+	if long {
+		size = 4
+	}
+	if len(loca) < size*(numGlyphs+1) {
+		return nil, fmt.Errorf("invalid font: truncated loca table")
+	}
+
+	offsets := make([]uint32, numGlyphs+1)
+	for i := range offsets {
+		if long {
+			offsets[i] = binary.BigEndian.Uint32(loca[4*i:])
+		} else {
+			offsets[i] = uint32(binary.BigEndian.Uint16(loca[2*i:])) * 2
+		}
+	}
+	return offsets, nil
+}
+
+// writeLoca encodes glyf offsets in the short or long loca format
+func writeLoca(offsets []uint32, long bool) []byte {
+	if long {
+		loca := make([]byte, 4*len(offsets))
+		for i, offset := range offsets {
+			binary.BigEndian.PutUint32(loca[4*i:], offset)
+		}
+		return loca
+	}
+
+	loca := make([]byte, 2*len(offsets))
+	for i, offset := range offsets {
+		binary.BigEndian.PutUint16(loca[2*i:], uint16(offset/2))
+	}
+	return loca
+}
+
+// glyphComponents returns the glyph IDs a composite glyph is built from
+func glyphComponents(glyph []byte) []int {
+	if len(glyph) < 10 || int16(binary.BigEndian.Uint16(glyph)) >= 0 {
+		return nil
+	}
+
+	const (
+		argsAreWords   = 0x0001
+		haveScale      = 0x0008
+		moreComponents = 0x0020
+		haveXYScale    = 0x0040
+		haveTwoByTwo   = 0x0080
+	)
+
+	var components []int
+	for pos := 10; pos+4 <= len(glyph); {
+		flags := binary.BigEndian.Uint16(glyph[pos:])
+		components = append(components, int(binary.BigEndian.Uint16(glyph[pos+2:])))
+		pos += 4
+
+		if flags&argsAreWords != 0 {
+			pos += 4
+		} else {
+			pos += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			pos += 2
+		case flags&haveXYScale != 0:
+			pos += 4
+		case flags&haveTwoByTwo != 0:
+			pos += 8
+		}
+
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+	return components
+}
+
+// cmapGlyphs maps characters to glyph IDs using every Unicode subtable of
+// format 4 or 12 in a cmap table
+func cmapGlyphs(cmap []byte, runes []rune) []int {
+	if len(cmap) < 4 {
+		return nil
+	}
+
+	var glyphs []int
+	numTables := int(binary.BigEndian.Uint16(cmap[2:]))
+	for i := 0; i < numTables && 4+8*i+8 <= len(cmap); i++ {
+		record := cmap[4+8*i:]
+		platform := binary.BigEndian.Uint16(record)
+		offset := binary.BigEndian.Uint32(record[4:])
+		if (platform != 0 && platform != 3) || uint64(offset)+4 > uint64(len(cmap)) {
+			continue
+		}
+
+		subtable := cmap[offset:]
+		for _, r := range runes {
+			if gid := cmapLookup(subtable, r); gid > 0 {
+				glyphs = append(glyphs, gid)
+			}
+		}
+	}
+	return glyphs
+}
+
+// cmapLookup returns the glyph ID for r in a cmap subtable, or 0
+func cmapLookup(subtable []byte, r rune) int {
+	u16 := func(pos int) int {
+		if pos < 0 || pos+2 > len(subtable) {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(subtable[pos:]))
+	}
+	u32 := func(pos int) int64 {
+		if pos < 0 || pos+4 > len(subtable) {
+			return 0
+		}
+		return int64(binary.BigEndian.Uint32(subtable[pos:]))
+	}
+
+	switch u16(0) {
+	case 4:
+		if r > 0xFFFF {
+			return 0
+		}
+		c := int(r)
+		segCount := u16(6) / 2
+		endCodes, startCodes := 14, 16+2*segCount
+		idDeltas, idRangeOffsets := startCodes+2*segCount, startCodes+4*segCount
+		for i := 0; i < segCount; i++ {
+			if u16(endCodes+2*i) < c {
+				continue
+			}
+			start := u16(startCodes + 2*i)
+			if start > c {
+				return 0
+			}
+			delta := u16(idDeltas + 2*i)
+			rangeOffset := u16(idRangeOffsets + 2*i)
+			if rangeOffset == 0 {
+				return (c + delta) & 0xFFFF
+			}
+			gid := u16(idRangeOffsets + 2*i + rangeOffset + 2*(c-start))
+			if gid == 0 {
+				return 0
+			}
+			return (gid + delta) & 0xFFFF
+		}
+
+	case 12:
+		groups := int(u32(12))
+		for i := 0; i < groups; i++ {
+			group := 16 + 12*i
+			start, end := u32(group), u32(group+4)
+			if int64(r) >= start && int64(r) <= end {
+				return int(u32(group+8) + int64(r) - start)
+			}
+		}
+	}
+	return 0
+}
+
+// decodeWOFF unwraps a WOFF 1.0 font into the font file it compresses
+func decodeWOFF(data []byte) ([]byte, error) {
+	if len(data) < 44 {
+		return nil, fmt.Errorf("invalid woff font: file too short")
+	}
+	flavor := binary.BigEndian.Uint32(data[4:])
+	if flavor != 0x00010000 && string(data[4:8]) != "true" {
+		return nil, ErrSubsetUnsupported
+	}
+
+	numTables := int(binary.BigEndian.Uint16(data[12:]))
+	if len(data) < 44+20*numTables {
+		return nil, fmt.Errorf("invalid woff font: truncated table directory")
+	}
+
+	tables := make(map[string][]byte, numTables)
+	for i := 0; i < numTables; i++ {
+		record := data[44+20*i:]
+		tag := string(record[:4])
+		offset := binary.BigEndian.Uint32(record[4:])
+		compLength := binary.BigEndian.Uint32(record[8:])
+		origLength := binary.BigEndian.Uint32(record[12:])
+		if uint64(offset)+uint64(compLength) > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid woff font: table %s out of bounds", tag)
+		}
+
+		table := data[offset : offset+compLength]
+		if compLength < origLength {
+			r, err := zlib.NewReader(bytes.NewReader(table))
+			if err != nil {
+				return nil, fmt.Errorf("invalid woff font: table %s: %w", tag, err)
+			}
+			table, err = io.ReadAll(io.LimitReader(r, int64(origLength)))
+			if err != nil {
+				return nil, fmt.Errorf("invalid woff font: table %s: %w", tag, err)
+			}
+		}
+		if uint32(len(table)) != origLength {
+			return nil, fmt.Errorf("invalid woff font: table %s has the wrong length", tag)
+		}
+		if tag == "head" && len(table) < 54 {
+			return nil, fmt.Errorf("invalid woff font: truncated head table")
+		}
+		tables[tag] = table
+	}
+
+	return writeSFNT(flavor, tables), nil
+}
@@ -0,0 +1,270 @@
+package assets
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Regex to match url() references in CSS, quoted or not, along with comments
+// so that references inside them can be skipped
+var cssURLRegex = regexp.MustCompile(`(?s)/\*.*?\*/|url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)`)
+
+// Regex to match characters that cannot appear in a body class name
+var classUnsafeRegex = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Theme is a loaded theme, ready to be inlined into a presentation
+type Theme struct {
+	Name     string   // Theme name, used as the body class
+	CSS      string   // Stylesheet with local url() references inlined as data URIs
+	Files    []string // Local files the theme was built from, empty for built-in themes
+	Warnings []string // Problems that did not prevent loading, such as fonts that could not be subset
+}
+
+// ThemeOptions contains configuration for loading a theme
+type ThemeOptions struct {
+	SearchPaths []string // Directories searched for themes given by name
+	SubsetFonts bool     // Subset inlined fonts to the glyphs of SubsetText
+	SubsetText  string   // Text the theme's fonts must be able to render
+	Confine     bool     // Refuse url() references to files outside the theme's directory, for safe mode
+}
+
+// LoadTheme loads a theme by name or path. name may be a built-in theme
+// ("dark", "light", "white"), a path to a CSS file, a path to a theme
+// directory containing theme.css, or the name of a theme found in one of
+// the search paths as <name>.css or <name>/theme.css. If a theme file is
+// found but invalid, the returned theme still lists its Files alongside the
+// error so callers can watch them for a fix.
+func LoadTheme(name string, searchPaths []string) (*Theme, error) {
+	return LoadThemeWithOptions(name, ThemeOptions{SearchPaths: searchPaths})
+}
+
+// LoadThemeWithOptions loads a theme like LoadTheme, with the given options
+func LoadThemeWithOptions(name string, opts ThemeOptions) (*Theme, error) {
+	if ValidateTheme(name) {
+		css, err := GetTheme(name)
+		if err != nil {
+			return nil, err
+		}
+		return &Theme{Name: name, CSS: css}, nil
+	}
+
+	if isThemePath(name) {
+		return loadThemePath(name, opts)
+	}
+
+	for _, dir := range opts.SearchPaths {
+		for _, candidate := range []string{
+			filepath.Join(dir, name+".css"),
+			filepath.Join(dir, name),
+		} {
+			if _, err := os.Stat(candidate); err == nil {
+				return loadThemePath(candidate, opts)
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("unknown theme '%s'. Valid themes: dark, light, white, a CSS file, or a theme directory", name)
+}
+
+// isThemePath reports whether a theme name refers to a file or directory
+// rather than a theme name
+func isThemePath(name string) bool {
+	return strings.ContainsAny(name, `/\`) ||
+		strings.HasPrefix(name, ".") ||
+		strings.EqualFold(filepath.Ext(name), ".css")
+}
+
+// loadThemePath loads a theme from a CSS file or a theme directory
+func loadThemePath(path string, opts ThemeOptions) (*Theme, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read theme %s: %w", path, err)
+	}
+
+	cssPath, themeDir := path, filepath.Dir(path)
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if info.IsDir() {
+		themeDir = path
+		name = filepath.Base(filepath.Clean(path))
+		cssPath = filepath.Join(path, "theme.css")
+		if _, err := os.Stat(cssPath); err != nil {
+			cssPath = filepath.Join(path, name+".css")
+		}
+	}
+
+	content, err := os.ReadFile(cssPath)
+	if err != nil {
+		return &Theme{Files: []string{cssPath}}, fmt.Errorf("failed to read theme %s: %w", path, err)
+	}
+
+	theme := &Theme{
+		Name:  classUnsafeRegex.ReplaceAllString(name, "-"),
+		Files: []string{cssPath},
+	}
+
+	problems := validateCSS(string(content))
+
+	// Inline local url() references relative to the stylesheet
+	baseDir := filepath.Dir(cssPath)
+	theme.CSS = cssURLRegex.ReplaceAllStringFunc(string(content), func(match string) string {
+		m := cssURLRegex.FindStringSubmatch(match)
+		ref := m[1] + m[2] + m[3]
+		if strings.HasPrefix(match, "/*") || !isLocalRef(ref) {
+			return match
+		}
+
+		file := ref
+		if i := strings.IndexAny(file, "?#"); i >= 0 {
+			file = file[:i]
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(baseDir, file)
+		}
+		if opts.Confine && !WithinDir(themeDir, file) {
+			problems = append(problems, fmt.Sprintf("url(%s) refers to a file outside the theme's directory", ref))
+			return match
+		}
+		theme.Files = append(theme.Files, file)
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("missing file %s referenced by url(%s)", file, ref))
+			return match
+		}
+		if opts.SubsetFonts && IsFontFile(file) {
+			subset, err := SubsetFont(data, opts.SubsetText)
+			if err != nil {
+				theme.Warnings = append(theme.Warnings, fmt.Sprintf("font %s embedded without subsetting: %v", file, err))
+			} else {
+				// Subset fonts are always TrueType
+				return fmt.Sprintf(`url("%s")`, dataURI(".ttf", subset))
+			}
+		}
+		return fmt.Sprintf(`url("%s")`, dataURI(file, data))
+	})
+
+	if len(problems) > 0 {
+		return &Theme{Name: theme.Name, Files: theme.Files}, fmt.Errorf("invalid theme %s:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+
+	return theme, nil
+}
+
+// WithinDir reports whether path is dir or a file below it, once both are
+// made absolute and symbolic links resolved, so that neither ../ nor a link
+// leads out of dir
+func WithinDir(dir, path string) bool {
+	dir, errDir := resolvePath(dir)
+	path, errPath := resolvePath(path)
+	if errDir != nil || errPath != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolvePath returns the absolute path with symbolic links resolved, or
+// just the absolute path if it does not exist
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved, nil
+	}
+	return path, nil
+}
+
+// isLocalRef reports whether a url() reference points to a local file
+func isLocalRef(ref string) bool {
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "//") {
+		return false
+	}
+	lower := strings.ToLower(ref)
+	for _, scheme := range []string{"data:", "http:", "https:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateCSS checks that a stylesheet can be safely inlined into a <style>
+// element and that its braces balance, ignoring comments and strings
+func validateCSS(css string) []string {
+	var problems []string
+
+	if strings.Contains(strings.ToLower(css), "</style") {
+		problems = append(problems, "stylesheet must not contain </style")
+	}
+
+	depth := 0
+	for i := 0; i < len(css); i++ {
+		switch c := css[i]; {
+		case c == '/' && i+1 < len(css) && css[i+1] == '*':
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				return append(problems, "unterminated comment")
+			}
+			i += end + 3
+		case c == '"' || c == '\'':
+			for i++; i < len(css) && css[i] != c; i++ {
+				if css[i] == '\\' {
+					i++
+				}
+			}
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth < 0 {
+				return append(problems, "unexpected }")
+			}
+		}
+	}
+	if depth != 0 {
+		problems = append(problems, "unbalanced braces: missing }")
+	}
+
+	return problems
+}
+
+// dataURI encodes a file's content as a base64 data URI, using its
+// extension to pick the MIME type
+func dataURI(filename string, data []byte) string {
+	return fmt.Sprintf("data:%s;base64,%s", contentType(filename), base64.StdEncoding.EncodeToString(data))
+}
+
+// contentType returns the MIME type of an image or font file based on its
+// extension
+func contentType(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".svg":
+		return "image/svg+xml"
+	case ".webp":
+		return "image/webp"
+	case ".woff2":
+		return "font/woff2"
+	case ".woff":
+		return "font/woff"
+	case ".ttf":
+		return "font/ttf"
+	case ".otf":
+		return "font/otf"
+	case ".css":
+		return "text/css"
+	default:
+		return "application/octet-stream"
+	}
+}
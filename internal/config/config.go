@@ -0,0 +1,204 @@
+// Package config reads gobig project configuration files, which hold the
+// defaults for the presentations in a directory tree
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are the names of configuration files, in the order they are
+// looked for in each directory
+var FileNames = []string{"gobig.yaml", ".gobig.yaml", "gobig.toml", ".gobig.toml"}
+
+// Config is a configuration file. Its settings are named like the
+// command-line flags they provide defaults for, e.g. "theme" or
+// "aspect-ratio", and targets list the outputs to build.
+type Config struct {
+	Path     string            // File the configuration was read from
+	Settings map[string]string // Setting values as flag values, with relative paths resolved against the file's directory
+	Targets  []Target          // Outputs to build, empty for the default
+}
+
+// Target is an output built from the presentation
+type Target struct {
+	Format string `yaml:"format"`  // Output format, empty for the default
+	Output string `yaml:"output"`  // Output file, empty for stdout
+	OutDir string `yaml:"out-dir"` // Output directory for directory output
+}
+
+// Find returns the configuration files that apply to presentations in dir:
+// the first of FileNames in dir and each of its parents, up to the root of
+// the repository (the first directory holding .git) or of the file system.
+// The nearest file comes last, so that it can override the others.
+func Find(dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for {
+		for _, name := range FileNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				files = append(files, path)
+				break
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	slices.Reverse(files)
+	return files, nil
+}
+
+// Load reads a YAML or, for files ending in .toml, TOML configuration file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]any
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(data, &values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	c := &Config{Path: path, Settings: make(map[string]string)}
+	dir := filepath.Dir(path)
+
+	// Sorted, so that errors do not depend on map order
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := values[key]
+		if key == "plugins" {
+			return nil, fmt.Errorf("%s: plugins: gobig does not support plugins", path)
+		}
+		if key == "targets" {
+			if c.Targets, err = targets(value, dir); err != nil {
+				return nil, fmt.Errorf("%s: targets: %w", path, err)
+			}
+			continue
+		}
+
+		s, err := settingValue(key, value, dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		c.Settings[key] = s
+	}
+	return c, nil
+}
+
+// settingValue converts a setting to a flag value. Paths are relative to
+// the configuration file; a theme is a path only if it exists there.
+func settingValue(key string, value any, dir string) (string, error) {
+	if key == "theme-path" {
+		// A list of directories, or a single one
+		var dirs []string
+		switch value := value.(type) {
+		case []any:
+			for _, item := range value {
+				s, ok := item.(string)
+				if !ok {
+					return "", fmt.Errorf("expected a list of directories")
+				}
+				dirs = append(dirs, resolve(dir, s))
+			}
+		case string:
+			dirs = []string{resolve(dir, value)}
+		default:
+			return "", fmt.Errorf("expected a list of directories")
+		}
+		return strings.Join(dirs, string(filepath.ListSeparator)), nil
+	}
+
+	var s string
+	switch value := value.(type) {
+	case string:
+		s = value
+	case bool:
+		s = strconv.FormatBool(value)
+	case int:
+		s = strconv.Itoa(value)
+	case int64:
+		s = strconv.FormatInt(value, 10)
+	case float64:
+		s = strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return "", fmt.Errorf("expected a string, number or boolean")
+	}
+
+	switch key {
+	case "o", "out-dir":
+		s = resolve(dir, s)
+	case "theme":
+		if _, err := os.Stat(filepath.Join(dir, s)); err == nil && !filepath.IsAbs(s) {
+			s = filepath.Join(dir, s)
+		}
+	}
+	return s, nil
+}
+
+// targets converts the targets setting, a list of tables
+func targets(value any, dir string) ([]Target, error) {
+	// Round-trip through YAML to decode the tables into Targets, which works
+	// for values read from TOML as well
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var targets []Target
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&targets); err != nil {
+		return nil, err
+	}
+	for i := range targets {
+		if targets[i].Output != "" && targets[i].OutDir != "" {
+			return nil, fmt.Errorf("use either output or out-dir, not both")
+		}
+		if targets[i].Output != "" {
+			targets[i].Output = resolve(dir, targets[i].Output)
+		}
+		if targets[i].OutDir != "" {
+			targets[i].OutDir = resolve(dir, targets[i].OutDir)
+		}
+	}
+	return targets, nil
+}
+
+// resolve returns path relative to dir unless it is absolute
+func resolve(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
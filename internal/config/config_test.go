@@ -0,0 +1,146 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFile creates a file and its directory under dir
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	outside := writeFile(t, root, "gobig.yaml", "theme: dark\n")
+	repo := filepath.Join(root, "repo")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	team := writeFile(t, repo, ".gobig.toml", "theme = \"light\"\n")
+	talk := writeFile(t, repo, "talks/intro/gobig.yaml", "title: Intro\n")
+	writeFile(t, repo, "talks/intro/.gobig.toml", "title = \"Ignored\"\n")
+
+	files, err := Find(filepath.Join(repo, "talks", "intro"))
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if want := []string{team, talk}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Find() = %v, want %v", files, want)
+	}
+
+	files, err = Find(filepath.Join(repo, "talks"))
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if want := []string{team}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Find() = %v, want %v; the walk should stop at the repository root", files, want)
+	}
+
+	files, err = Find(root)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(files) == 0 || files[len(files)-1] != outside {
+		t.Errorf("Find() = %v, want %s last", files, outside)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "brand/theme.css", "body {}")
+
+	for _, tt := range []struct {
+		name    string
+		content string
+	}{
+		{"gobig.yaml", `theme: brand/theme.css
+theme-path: [themes, /shared/themes]
+aspect-ratio: 2
+presenter: true
+image-quality: 70
+highlight-style: monokai
+targets:
+  - output: dist/{name}.html
+  - format: pdf
+    output: dist/{name}.pdf
+  - out-dir: site
+`},
+		{".gobig.toml", `theme = "brand/theme.css"
+theme-path = ["themes", "/shared/themes"]
+aspect-ratio = 2
+presenter = true
+image-quality = 70
+highlight-style = "monokai"
+
+[[targets]]
+output = "dist/{name}.html"
+
+[[targets]]
+format = "pdf"
+output = "dist/{name}.pdf"
+
+[[targets]]
+out-dir = "site"
+`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Load(writeFile(t, dir, tt.name, tt.content))
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			want := map[string]string{
+				"theme":           filepath.Join(dir, "brand/theme.css"),
+				"theme-path":      filepath.Join(dir, "themes") + string(filepath.ListSeparator) + "/shared/themes",
+				"aspect-ratio":    "2",
+				"presenter":       "true",
+				"image-quality":   "70",
+				"highlight-style": "monokai",
+			}
+			if !reflect.DeepEqual(c.Settings, want) {
+				t.Errorf("Settings = %v, want %v", c.Settings, want)
+			}
+
+			targets := []Target{
+				{Output: filepath.Join(dir, "dist/{name}.html")},
+				{Format: "pdf", Output: filepath.Join(dir, "dist/{name}.pdf")},
+				{OutDir: filepath.Join(dir, "site")},
+			}
+			if !reflect.DeepEqual(c.Targets, targets) {
+				t.Errorf("Targets = %v, want %v", c.Targets, targets)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		content string
+		want    string
+	}{
+		{"theme: [dark, light]\n", "theme: expected a string, number or boolean"},
+		{"theme-path: 3\n", "theme-path: expected a list of directories"},
+		{"targets:\n  - output: a.html\n    out-dir: site\n", "targets: use either output or out-dir, not both"},
+		{"targets:\n  - ouput: a.html\n", "targets: yaml: unmarshal errors"},
+		{"theme: [\n", "yaml:"},
+		{"plugins: [notes]\n", "plugins: gobig does not support plugins"},
+	} {
+		_, err := Load(writeFile(t, dir, "gobig.yaml", tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Load(%q) error = %v, want %q", tt.content, err, tt.want)
+		}
+	}
+}
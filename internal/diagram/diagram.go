@@ -0,0 +1,156 @@
+// Package diagram renders diagrams written as text to inline SVG. It
+// supports a subset of the Graphviz DOT language, mermaid-style flowcharts
+// and sequence diagrams, laid out without external programs.
+package diagram
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSS styles rendered diagrams. Diagrams are drawn in the text color of the
+// slide, so they match the theme they are shown in.
+const CSS = `.diagram { display: block; margin: 0 auto; max-width: 100%; height: auto; overflow: visible; }
+.diagram text { fill: currentColor; stroke: none; font-size: 14px; font-family: inherit; }
+.diagram .node { fill: currentColor; fill-opacity: 0.08; stroke: currentColor; stroke-width: 1.5; }
+.diagram .plain { fill: none; stroke: none; }
+.diagram .edge { fill: none; stroke: currentColor; stroke-width: 1.5; }
+.diagram .dashed { stroke-dasharray: 6 4; }
+.diagram .dotted { stroke-dasharray: 2 3; }
+.diagram .bold { stroke-width: 3; }
+.diagram .arrow { fill: currentColor; stroke: none; }
+.diagram .open-arrow { fill: none; stroke: currentColor; stroke-width: 1.5; }
+.diagram .lifeline { stroke: currentColor; stroke-opacity: 0.5; stroke-dasharray: 4 4; }
+.diagram .note { fill: currentColor; fill-opacity: 0.2; stroke: currentColor; stroke-opacity: 0.6; }
+`
+
+// Text metrics used to size shapes around labels
+const (
+	fontSize   = 14.0
+	charWidth  = 8.0 // Average width of a character
+	lineHeight = 18.0
+	margin     = 8.0
+)
+
+// renderers maps the languages of diagram code blocks to their renderers
+var renderers = map[string]func(string) (string, error){
+	"dot":       renderDOT,
+	"graphviz":  renderDOT,
+	"flowchart": renderFlowchart,
+	"sequence":  renderSequence,
+}
+
+// IsDiagram reports whether code blocks in language are diagrams
+func IsDiagram(language string) bool {
+	_, ok := renderers[language]
+	return ok
+}
+
+// Render renders the diagram source of a code block in language as SVG
+func Render(language, source string) (string, error) {
+	render, ok := renderers[language]
+	if !ok {
+		return "", fmt.Errorf("unknown diagram language %q", language)
+	}
+	return render(source)
+}
+
+// labelLines splits a label into lines on newlines and \n escapes, as
+// Graphviz does
+func labelLines(label string) []string {
+	label = strings.ReplaceAll(label, `\n`, "\n")
+	return strings.Split(label, "\n")
+}
+
+// textSize returns the size of a label
+func textSize(label string) (width, height float64) {
+	lines := labelLines(label)
+	for _, line := range lines {
+		width = math.Max(width, float64(utf8.RuneCountInString(line))*charWidth)
+	}
+	return width, float64(len(lines)) * lineHeight
+}
+
+// svg accumulates the elements of a diagram
+type svg struct {
+	sb strings.Builder
+}
+
+// num formats a coordinate
+func num(f float64) string {
+	return strconv.FormatFloat(math.Round(f*10)/10, 'f', -1, 64)
+}
+
+// element writes an element with the given attributes, which alternate
+// between names and values
+func (s *svg) element(name string, attrs ...string) {
+	s.sb.WriteString("<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		fmt.Fprintf(&s.sb, ` %s="%s"`, attrs[i], html.EscapeString(attrs[i+1]))
+	}
+	s.sb.WriteString("/>")
+}
+
+// text writes a label centered on x and y, one tspan per line. anchor is
+// the text-anchor: start, middle or end.
+func (s *svg) text(x, y float64, label, anchor string) {
+	lines := labelLines(label)
+	top := y - float64(len(lines)-1)*lineHeight/2
+	fmt.Fprintf(&s.sb, `<text x="%s" y="%s" text-anchor="%s" dominant-baseline="central">`, num(x), num(top), anchor)
+	for i, line := range lines {
+		if i == 0 {
+			s.sb.WriteString("<tspan>")
+		} else {
+			fmt.Fprintf(&s.sb, `<tspan x="%s" dy="%s">`, num(x), num(lineHeight))
+		}
+		s.sb.WriteString(html.EscapeString(line) + "</tspan>")
+	}
+	s.sb.WriteString("</text>")
+}
+
+// line writes a polyline through points
+func (s *svg) line(class string, points []point) {
+	var sb strings.Builder
+	for i, p := range points {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(num(p.x) + "," + num(p.y))
+	}
+	s.element("polyline", "class", class, "points", sb.String())
+}
+
+// arrow writes an arrowhead pointing at to, coming from from
+func (s *svg) arrow(from, to point, open bool) {
+	const length, halfWidth = 10.0, 5.0
+	dx, dy := to.x-from.x, to.y-from.y
+	d := math.Hypot(dx, dy)
+	if d == 0 {
+		return
+	}
+	dx, dy = dx/d, dy/d
+	bx, by := to.x-dx*length, to.y-dy*length
+	points := fmt.Sprintf("%s,%s %s,%s %s,%s",
+		num(bx-dy*halfWidth), num(by+dx*halfWidth), num(to.x), num(to.y), num(bx+dy*halfWidth), num(by-dx*halfWidth))
+	if open {
+		s.element("polyline", "class", "open-arrow", "points", points)
+	} else {
+		s.element("polygon", "class", "arrow", "points", points)
+	}
+}
+
+// document wraps the elements in an svg element of the given size. The
+// size is given in em so diagrams scale with the text of the slide.
+func (s *svg) document(width, height float64) string {
+	return fmt.Sprintf(`<svg class="diagram" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %s %s" width="%sem" height="%sem" role="img">%s</svg>`,
+		num(width), num(height), num(width/16), num(height/16), s.sb.String())
+}
+
+// point is a position in a diagram
+type point struct {
+	x, y float64
+}
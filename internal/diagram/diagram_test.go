@@ -0,0 +1,167 @@
+package diagram
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestIsDiagram(t *testing.T) {
+	for _, language := range []string{"dot", "graphviz", "flowchart", "sequence"} {
+		if !IsDiagram(language) {
+			t.Errorf("IsDiagram(%q) = false, want true", language)
+		}
+	}
+	if IsDiagram("go") {
+		t.Error(`IsDiagram("go") = true, want false`)
+	}
+}
+
+func TestRenderDOT(t *testing.T) {
+	svg, err := Render("dot", `digraph G {
+  // Build pipeline
+  rankdir=LR;
+  node [shape=box];
+  lint -> test -> "deploy it" [label="ok"];
+  test -> test;
+  deploy [shape=diamond, label="Ship?"];
+  "deploy it" -> deploy [style=dashed];
+}`)
+	if err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+
+	checks := []string{
+		`<svg class="diagram" xmlns="http://www.w3.org/2000/svg"`,
+		"<tspan>lint</tspan>",
+		"<tspan>deploy it</tspan>",
+		"<tspan>Ship?</tspan>",
+		"<tspan>ok</tspan>",
+		`<polyline class="edge dashed"`,
+		`<polygon class="arrow"`,
+		`<polygon class="node"`,
+		`<rect class="node"`,
+	}
+	for _, check := range checks {
+		if !strings.Contains(svg, check) {
+			t.Errorf("Render() output missing %q:\n%s", check, svg)
+		}
+	}
+
+	// Left to right: lint is left of test
+	lint := nodeX(t, svg, "lint")
+	test := nodeX(t, svg, "test")
+	if lint >= test {
+		t.Errorf("Expected lint (x=%v) left of test (x=%v) with rankdir=LR", lint, test)
+	}
+}
+
+func TestRenderDOTUndirected(t *testing.T) {
+	svg, err := Render("graphviz", "graph { a -- {b c}; b -- c }")
+	if err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+	if got := strings.Count(svg, `<polyline class="edge"`); got != 3 {
+		t.Errorf("Expected 3 edges, got %d:\n%s", got, svg)
+	}
+	if strings.Contains(svg, `class="arrow"`) {
+		t.Error("Undirected graphs should not have arrowheads")
+	}
+}
+
+func TestRenderFlowchart(t *testing.T) {
+	svg, err := Render("flowchart", `flowchart TD
+    A[Start] --> B{Ready?}
+    B -->|yes| C((Go))
+    B -- not yet --> D(Wait) -.-> B
+    %% A comment`)
+	if err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+
+	checks := []string{
+		"<tspan>Start</tspan>",
+		"<tspan>Ready?</tspan>",
+		"<tspan>yes</tspan>",
+		"<tspan>not yet</tspan>",
+		`<polyline class="edge dotted"`,
+		`<ellipse class="node"`,
+		`rx="12"`,
+	}
+	for _, check := range checks {
+		if !strings.Contains(svg, check) {
+			t.Errorf("Render() output missing %q:\n%s", check, svg)
+		}
+	}
+}
+
+func TestRenderSequence(t *testing.T) {
+	svg, err := Render("sequence", `title: Login
+participant B as Browser
+B->Server: POST /login
+Server->Server: check password
+Server-->B: 200 OK
+Note over B,Server: Session started`)
+	if err != nil {
+		t.Fatalf("Render() failed: %v", err)
+	}
+
+	checks := []string{
+		"<tspan>Login</tspan>",
+		"<tspan>Browser</tspan>",
+		"<tspan>POST /login</tspan>",
+		`<polyline class="edge dashed"`,
+		`<rect class="note"`,
+		`<line class="lifeline"`,
+	}
+	for _, check := range checks {
+		if !strings.Contains(svg, check) {
+			t.Errorf("Render() output missing %q:\n%s", check, svg)
+		}
+	}
+	if got := strings.Count(svg, "<tspan>Server</tspan>"); got != 2 {
+		t.Errorf("Expected participant boxes at the top and bottom, got %d", got)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	tests := []struct {
+		language, source, want string
+	}{
+		{"dot", "digraph { a -> }", "line 1: expected a name"},
+		{"dot", "digraph {\n a -- b\n}", "line 2: use -> in a digraph"},
+		{"dot", "digraph { a -> b", "expected }"},
+		{"dot", "digraph {}", "diagram has no nodes"},
+		{"dot", "strict graph { a [label=<b>x</b>] }", "HTML labels are not supported"},
+		{"flowchart", "flowchart XY\nA --> B", "line 1: unknown direction"},
+		{"flowchart", "A --> B\nA ~~> C", "line 2: expected a link"},
+		{"sequence", "Alice->Bob: hi\nwhat is this", `line 2: cannot parse "what is this"`},
+		{"mermaid", "A --> B", "unknown diagram language"},
+	}
+
+	for _, tt := range tests {
+		_, err := Render(tt.language, tt.source)
+		if err == nil {
+			t.Errorf("Render(%q, %q) succeeded, want an error", tt.language, tt.source)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Render(%q, %q) error = %q, want it to contain %q", tt.language, tt.source, err, tt.want)
+		}
+	}
+}
+
+// nodeX returns the x coordinate of the label of a node
+func nodeX(t *testing.T, svg, label string) float64 {
+	t.Helper()
+	m := regexp.MustCompile(`<text x="([\d.]+)"[^>]*><tspan>` + regexp.QuoteMeta(label) + `</tspan>`).FindStringSubmatch(svg)
+	if m == nil {
+		t.Fatalf("No label %q in:\n%s", label, svg)
+	}
+	x, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x
+}
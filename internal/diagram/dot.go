@@ -0,0 +1,444 @@
+package diagram
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// dotShapes maps Graphviz node shapes to the shapes drawn for them. Other
+// shapes are drawn as boxes.
+var dotShapes = map[string]string{
+	"box": shapeBox, "rect": shapeBox, "rectangle": shapeBox, "square": shapeBox,
+	"record": shapeBox, "mrecord": shapeRounded, "ellipse": shapeEllipse,
+	"oval": shapeEllipse, "circle": shapeCircle, "doublecircle": shapeCircle,
+	"point": shapeCircle, "diamond": shapeDiamond, "plaintext": shapePlain,
+	"plain": shapePlain, "none": shapePlain,
+}
+
+// dotToken is a token of the DOT language
+type dotToken struct {
+	text   string
+	quoted bool // A quoted string, never a keyword or punctuation
+	line   int
+}
+
+// dotParser parses a subset of the DOT language: node, edge and attribute
+// statements, with subgraphs flattened into the graph
+type dotParser struct {
+	tokens    []dotToken
+	pos       int
+	graph     *graph
+	mentioned []*node // Nodes in the order statements mention them
+}
+
+// renderDOT renders a Graphviz DOT graph
+func renderDOT(source string) (string, error) {
+	tokens, err := tokenizeDOT(source)
+	if err != nil {
+		return "", err
+	}
+	p := &dotParser{tokens: tokens}
+	if err := p.parseGraph(); err != nil {
+		return "", err
+	}
+	return p.graph.render()
+}
+
+// tokenizeDOT splits DOT source into tokens, dropping comments
+func tokenizeDOT(source string) ([]dotToken, error) {
+	var tokens []dotToken
+	src := []rune(source)
+	line := 1
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(c):
+			i++
+		case c == '#' && (i == 0 || src[i-1] == '\n'), c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			start := line
+			i += 2
+			for i+1 < len(src) && !(src[i] == '*' && src[i+1] == '/') {
+				if src[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i+1 >= len(src) {
+				return nil, fmt.Errorf("line %d: unterminated comment", start)
+			}
+			i += 2
+		case c == '"':
+			start := line
+			var sb strings.Builder
+			for i++; i < len(src) && src[i] != '"'; i++ {
+				if src[i] == '\\' && i+1 < len(src) && src[i+1] == '"' {
+					i++
+				} else if src[i] == '\\' && i+1 < len(src) && src[i+1] == '\n' {
+					// Line continuation
+					i++
+					line++
+					continue
+				}
+				if src[i] == '\n' {
+					line++
+				}
+				sb.WriteRune(src[i])
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("line %d: unterminated string", start)
+			}
+			i++
+			tokens = append(tokens, dotToken{text: sb.String(), quoted: true, line: start})
+		case c == '<':
+			return nil, fmt.Errorf("line %d: HTML labels are not supported", line)
+		case c == '-' && i+1 < len(src) && (src[i+1] == '>' || src[i+1] == '-'):
+			tokens = append(tokens, dotToken{text: string(src[i : i+2]), line: line})
+			i += 2
+		case strings.ContainsRune("{}[];,=:", c):
+			tokens = append(tokens, dotToken{text: string(c), line: line})
+			i++
+		case c == '_' || c == '.' || c == '-' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] == '.' || unicode.IsLetter(src[i]) || unicode.IsDigit(src[i]) ||
+				(src[i] == '-' && i == start)) {
+				i++
+			}
+			tokens = append(tokens, dotToken{text: string(src[start:i]), line: line})
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", line, c)
+		}
+	}
+	return tokens, nil
+}
+
+// peek returns the next token without consuming it, or an empty token at
+// the end of the input
+func (p *dotParser) peek() dotToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	line := 1
+	if len(p.tokens) > 0 {
+		line = p.tokens[len(p.tokens)-1].line
+	}
+	return dotToken{line: line}
+}
+
+// is reports whether the next token is the given punctuation or keyword
+func (p *dotParser) is(text string) bool {
+	t := p.peek()
+	return !t.quoted && strings.EqualFold(t.text, text) && p.pos < len(p.tokens)
+}
+
+// expect consumes the given punctuation or keyword
+func (p *dotParser) expect(text string) error {
+	if !p.is(text) {
+		return p.errorf("expected %s", text)
+	}
+	p.pos++
+	return nil
+}
+
+// errorf returns an error for the next token
+func (p *dotParser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	found := "end of input"
+	if p.pos < len(p.tokens) {
+		found = fmt.Sprintf("%q", t.text)
+	}
+	return fmt.Errorf("line %d: %s, found %s", t.line, fmt.Sprintf(format, args...), found)
+}
+
+// id consumes an identifier, number or quoted string
+func (p *dotParser) id() (string, error) {
+	t := p.peek()
+	punctuation := len(t.text) == 1 && strings.Contains("{}[];,=:", t.text) || t.text == "->" || t.text == "--"
+	if p.pos >= len(p.tokens) || punctuation && !t.quoted {
+		return "", p.errorf("expected a name")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+// parseGraph parses [strict] (graph|digraph) [name] { statements }
+func (p *dotParser) parseGraph() error {
+	if p.is("strict") {
+		p.pos++
+	}
+	switch {
+	case p.is("digraph"):
+		p.graph = newGraph(true)
+	case p.is("graph"):
+		p.graph = newGraph(false)
+	default:
+		return p.errorf("expected graph or digraph")
+	}
+	p.pos++
+	if !p.is("{") {
+		if _, err := p.id(); err != nil {
+			return err
+		}
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	if err := p.parseStatements(map[string]string{}, map[string]string{}); err != nil {
+		return err
+	}
+	if p.pos < len(p.tokens) {
+		return p.errorf("expected end of graph")
+	}
+	return nil
+}
+
+// parseStatements parses statements up to and including the closing brace.
+// nodeAttrs and edgeAttrs are the defaults set by node and edge statements.
+func (p *dotParser) parseStatements(nodeAttrs, edgeAttrs map[string]string) error {
+	for {
+		switch {
+		case p.pos >= len(p.tokens):
+			return p.errorf("expected }")
+		case p.is("}"):
+			p.pos++
+			return nil
+		case p.is(";"), p.is(","):
+			p.pos++
+		case p.is("graph"):
+			p.pos++
+			attrs, err := p.parseAttrs()
+			if err != nil {
+				return err
+			}
+			p.setGraphAttrs(attrs)
+		case p.is("node"), p.is("edge"):
+			target := nodeAttrs
+			if p.is("edge") {
+				target = edgeAttrs
+			}
+			p.pos++
+			attrs, err := p.parseAttrs()
+			if err != nil {
+				return err
+			}
+			for k, v := range attrs {
+				target[k] = v
+			}
+		default:
+			if err := p.parseStatement(nodeAttrs, edgeAttrs); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseStatement parses a node or edge statement, a graph attribute or a
+// subgraph
+func (p *dotParser) parseStatement(nodeAttrs, edgeAttrs map[string]string) error {
+	start := p.pos
+	if !p.is("{") && !p.is("subgraph") {
+		name, err := p.id()
+		if err != nil {
+			return err
+		}
+		if p.is("=") {
+			p.pos++
+			value, err := p.id()
+			if err != nil {
+				return err
+			}
+			p.setGraphAttrs(map[string]string{name: value})
+			return nil
+		}
+		p.pos = start
+	}
+
+	// Edge statement: endpoints separated by -> or --
+	var ends [][]*node
+	for {
+		nodes, err := p.parseEndpoint(nodeAttrs, edgeAttrs)
+		if err != nil {
+			return err
+		}
+		ends = append(ends, nodes)
+		if !p.is("->") && !p.is("--") {
+			break
+		}
+		if p.is("->") != p.graph.directed {
+			return p.errorf("use -> in a digraph and -- in a graph")
+		}
+		p.pos++
+	}
+
+	attrs, err := p.parseAttrs()
+	if err != nil {
+		return err
+	}
+	if len(ends) == 1 {
+		if len(ends[0]) == 1 {
+			applyNodeAttrs(ends[0][0], attrs)
+		}
+		return nil
+	}
+
+	merged := make(map[string]string, len(edgeAttrs)+len(attrs))
+	for k, v := range edgeAttrs {
+		merged[k] = v
+	}
+	for k, v := range attrs {
+		merged[k] = v
+	}
+	for i := 1; i < len(ends); i++ {
+		for _, from := range ends[i-1] {
+			for _, to := range ends[i] {
+				p.graph.edges = append(p.graph.edges, newDOTEdge(from, to, p.graph.directed, merged))
+			}
+		}
+	}
+	return nil
+}
+
+// parseEndpoint parses a node id, with an optional port that is ignored, or
+// a subgraph, and returns the nodes it stands for
+func (p *dotParser) parseEndpoint(nodeAttrs, edgeAttrs map[string]string) ([]*node, error) {
+	if p.is("subgraph") || p.is("{") {
+		if p.is("subgraph") {
+			p.pos++
+			if !p.is("{") {
+				if _, err := p.id(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+
+		// The subgraph stands for the nodes its statements mention. Defaults
+		// set inside it end with it.
+		start := len(p.mentioned)
+		if err := p.parseStatements(copyAttrs(nodeAttrs), copyAttrs(edgeAttrs)); err != nil {
+			return nil, err
+		}
+		var nodes []*node
+		seen := make(map[*node]bool)
+		for _, n := range p.mentioned[start:] {
+			if !seen[n] {
+				seen[n] = true
+				nodes = append(nodes, n)
+			}
+		}
+		return nodes, nil
+	}
+
+	id, err := p.id()
+	if err != nil {
+		return nil, err
+	}
+	if p.is(":") {
+		p.pos++
+		if _, err := p.id(); err != nil {
+			return nil, err
+		}
+		if p.is(":") {
+			p.pos++
+			if _, err := p.id(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	n, ok := p.graph.byID[id]
+	if !ok {
+		n = p.graph.node(id)
+		applyNodeAttrs(n, nodeAttrs)
+	}
+	p.mentioned = append(p.mentioned, n)
+	return []*node{n}, nil
+}
+
+// parseAttrs parses any number of [name=value, ...] lists
+func (p *dotParser) parseAttrs() (map[string]string, error) {
+	attrs := make(map[string]string)
+	for p.is("[") {
+		p.pos++
+		for !p.is("]") {
+			name, err := p.id()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			value, err := p.id()
+			if err != nil {
+				return nil, err
+			}
+			attrs[strings.ToLower(name)] = value
+			if p.is(",") || p.is(";") {
+				p.pos++
+			}
+		}
+		p.pos++
+	}
+	return attrs, nil
+}
+
+// setGraphAttrs applies graph attributes that affect the layout
+func (p *dotParser) setGraphAttrs(attrs map[string]string) {
+	if dir, ok := attrs["rankdir"]; ok {
+		p.graph.rankdir = strings.ToUpper(dir)
+	}
+}
+
+// applyNodeAttrs applies the attributes of a node that affect its drawing
+func applyNodeAttrs(n *node, attrs map[string]string) {
+	if label, ok := attrs["label"]; ok {
+		n.label = label
+	}
+	if shape, ok := attrs["shape"]; ok {
+		n.shape = shapeBox
+		if s, ok := dotShapes[strings.ToLower(shape)]; ok {
+			n.shape = s
+		}
+	}
+	if n.shape == shapeBox && strings.Contains(attrs["style"], "rounded") {
+		n.shape = shapeRounded
+	}
+}
+
+// newDOTEdge returns an edge with the given attributes
+func newDOTEdge(from, to *node, directed bool, attrs map[string]string) *edge {
+	e := &edge{from: from, to: to, label: attrs["label"], arrow: directed}
+	for _, style := range []string{"dashed", "dotted", "bold"} {
+		if strings.Contains(attrs["style"], style) {
+			e.style = style
+		}
+	}
+	switch attrs["dir"] {
+	case "none":
+		e.arrow = false
+	case "forward":
+		e.arrow = true
+	case "back":
+		e.from, e.to, e.arrow = to, from, true
+	}
+	return e
+}
+
+// copyAttrs returns a copy of attributes
+func copyAttrs(attrs map[string]string) map[string]string {
+	c := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,146 @@
+package diagram
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Regexes for mermaid-style flowcharts
+var (
+	// flowchartHeaderRegex matches the optional first line, such as
+	// "flowchart LR" or "graph TD"
+	flowchartHeaderRegex = regexp.MustCompile(`^(?:flowchart|graph)(?:\s+(\w+))?$`)
+
+	// flowchartNodeRegex matches a node id and its optional shape and label
+	flowchartNodeRegex = regexp.MustCompile(`^([\w.]+)\s*(\(\(.*?\)\)|\(\[.*?\]\)|\[\[.*?\]\]|\[.*?\]|\(.*?\)|\{.*?\})?`)
+
+	// flowchartLinkRegex matches a link with an optional |label|
+	flowchartLinkRegex = regexp.MustCompile(`^(-->|---|-\.->|-\.-|==>|===)\s*(?:\|([^|]*)\|)?`)
+
+	// flowchartTextLinkRegex matches a link with its label inside: -- label -->
+	flowchartTextLinkRegex = regexp.MustCompile(`^(--|-\.|==)\s+(.+?)\s+(-->|---|\.->|\.-|==>|===)`)
+)
+
+// flowchartLinks maps link arrows to their style and whether they have an
+// arrowhead
+var flowchartLinks = map[string]struct {
+	style string
+	arrow bool
+}{
+	"-->": {"", true}, "---": {"", false},
+	"-.->": {"dotted", true}, "-.-": {"dotted", false}, ".->": {"dotted", true}, ".-": {"dotted", false},
+	"==>": {"bold", true}, "===": {"bold", false},
+}
+
+// flowchartDirections maps flowchart directions to layout directions
+var flowchartDirections = map[string]string{
+	"TB": "TB", "TD": "TB", "BT": "BT", "LR": "LR", "RL": "RL",
+}
+
+// renderFlowchart renders a mermaid-style flowchart: lines of nodes joined
+// by links, such as "A[Start] --> B{Ready?}" and "B -->|yes| C(Go)"
+func renderFlowchart(source string) (string, error) {
+	g := newGraph(true)
+
+	first := true
+	for i, line := range strings.Split(source, "\n") {
+		for _, statement := range strings.Split(line, ";") {
+			statement = strings.TrimSpace(statement)
+			if statement == "" || strings.HasPrefix(statement, "%%") {
+				continue
+			}
+			if first {
+				first = false
+				if m := flowchartHeaderRegex.FindStringSubmatch(statement); m != nil {
+					if m[1] != "" {
+						dir, ok := flowchartDirections[strings.ToUpper(m[1])]
+						if !ok {
+							return "", fmt.Errorf("line %d: unknown direction %q", i+1, m[1])
+						}
+						g.rankdir = dir
+					}
+					continue
+				}
+			}
+			if err := parseFlowchartStatement(g, statement); err != nil {
+				return "", fmt.Errorf("line %d: %v", i+1, err)
+			}
+		}
+	}
+
+	return g.render()
+}
+
+// parseFlowchartStatement parses a chain of nodes joined by links
+func parseFlowchartStatement(g *graph, statement string) error {
+	rest := statement
+	var prev *node
+	var link *edge
+
+	for {
+		m := flowchartNodeRegex.FindStringSubmatch(rest)
+		if m == nil {
+			return fmt.Errorf("expected a node at %q", rest)
+		}
+		n := g.node(m[1])
+		if n.shape == shapeEllipse && n.label == n.id {
+			// Nodes without a shape are boxes, as in mermaid
+			n.shape = shapeBox
+		}
+		if m[2] != "" {
+			n.shape, n.label = flowchartShape(m[2])
+		}
+		if link != nil {
+			link.from, link.to = prev, n
+			g.edges = append(g.edges, link)
+		}
+		prev = n
+		rest = strings.TrimSpace(rest[len(m[0]):])
+		if rest == "" {
+			return nil
+		}
+
+		link = &edge{}
+		var arrow string
+		if m := flowchartLinkRegex.FindStringSubmatch(rest); m != nil {
+			arrow, link.label = m[1], strings.TrimSpace(m[2])
+			rest = strings.TrimSpace(rest[len(m[0]):])
+		} else if m := flowchartTextLinkRegex.FindStringSubmatch(rest); m != nil {
+			arrow, link.label = m[3], m[2]
+			rest = strings.TrimSpace(rest[len(m[0]):])
+		} else {
+			return fmt.Errorf("expected a link such as --> at %q", rest)
+		}
+		link.style, link.arrow = flowchartLinks[arrow].style, flowchartLinks[arrow].arrow
+		link.label = unquote(link.label)
+	}
+}
+
+// flowchartShape returns the shape and label of a node's bracketed label
+func flowchartShape(s string) (shape, label string) {
+	switch {
+	case strings.HasPrefix(s, "(("):
+		shape, label = shapeCircle, s[2:len(s)-2]
+	case strings.HasPrefix(s, "(["), strings.HasPrefix(s, "[["):
+		shape, label = shapeRounded, s[2:len(s)-2]
+		if s[0] == '[' {
+			shape = shapeBox
+		}
+	case s[0] == '(':
+		shape, label = shapeRounded, s[1:len(s)-1]
+	case s[0] == '{':
+		shape, label = shapeDiamond, s[1:len(s)-1]
+	default:
+		shape, label = shapeBox, s[1:len(s)-1]
+	}
+	return shape, unquote(strings.TrimSpace(label))
+}
+
+// unquote removes the quotes around a label
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
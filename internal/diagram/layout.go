@@ -0,0 +1,550 @@
+package diagram
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Node shapes
+const (
+	shapeBox     = "box"
+	shapeRounded = "rounded"
+	shapeEllipse = "ellipse"
+	shapeCircle  = "circle"
+	shapeDiamond = "diamond"
+	shapePlain   = "plain"
+)
+
+// Spacing of the layered layout
+const (
+	nodeSep   = 30.0 // Between nodes of a rank
+	rankSep   = 50.0 // Between ranks
+	loopWidth = 30.0 // Of self loops, beside their node
+)
+
+// graph is a directed or undirected graph drawn by layering its nodes
+type graph struct {
+	directed bool
+	rankdir  string // TB, LR, BT or RL
+	nodes    []*node
+	byID     map[string]*node
+	edges    []*edge
+}
+
+// node is a node of a graph. Dummy nodes route edges across ranks.
+type node struct {
+	id, label, shape string
+	x, y, w, h       float64 // Center and size
+	rank, order      int
+	dummy            bool
+}
+
+// edge is an edge of a graph
+type edge struct {
+	from, to *node
+	label    string
+	style    string // "", dashed, dotted or bold
+	arrow    bool
+	reversed bool    // Reversed to break a cycle
+	chain    []*node // Nodes the edge passes through, by increasing rank
+	points   []point
+}
+
+// newGraph returns an empty graph
+func newGraph(directed bool) *graph {
+	return &graph{directed: directed, rankdir: "TB", byID: make(map[string]*node)}
+}
+
+// node returns the node with the given id, adding it if needed
+func (g *graph) node(id string) *node {
+	if n, ok := g.byID[id]; ok {
+		return n
+	}
+	n := &node{id: id, label: id, shape: shapeEllipse}
+	g.byID[id] = n
+	g.nodes = append(g.nodes, n)
+	return n
+}
+
+// render lays out the graph and draws it
+func (g *graph) render() (string, error) {
+	if len(g.nodes) == 0 {
+		return "", fmt.Errorf("diagram has no nodes")
+	}
+	switch g.rankdir {
+	case "TB", "LR", "BT", "RL":
+	default:
+		return "", fmt.Errorf("unknown direction %q", g.rankdir)
+	}
+
+	g.layout()
+	return g.draw(), nil
+}
+
+// layout positions the nodes of the graph in ranks and routes its edges
+func (g *graph) layout() {
+	horizontal := g.rankdir == "LR" || g.rankdir == "RL"
+	for _, n := range g.nodes {
+		n.w, n.h = nodeSize(n)
+		if horizontal {
+			n.w, n.h = n.h, n.w
+		}
+	}
+
+	g.rank()
+	ranks := g.order()
+	g.position(ranks, horizontal)
+
+	// Lay out top to bottom, then turn the drawing to the direction asked for
+	for _, n := range g.allNodes(ranks) {
+		switch g.rankdir {
+		case "LR":
+			n.x, n.y, n.w, n.h = n.y, n.x, n.h, n.w
+		case "BT":
+			n.y = -n.y
+		case "RL":
+			n.x, n.y, n.w, n.h = -n.y, n.x, n.h, n.w
+		}
+	}
+
+	for _, e := range g.edges {
+		g.route(e)
+	}
+	g.separateParallel()
+}
+
+// separateParallel bends edges between the same two nodes apart, so edges
+// in both directions do not overlap
+func (g *graph) separateParallel() {
+	type pair struct{ a, b *node }
+	groups := make(map[pair][]*edge)
+	for _, e := range g.edges {
+		if e.from == e.to || len(e.points) != 2 {
+			continue
+		}
+		key := pair{e.from, e.to}
+		if e.reversed {
+			key = pair{e.to, e.from}
+		}
+		groups[key] = append(groups[key], e)
+	}
+
+	for _, edges := range groups {
+		if len(edges) < 2 {
+			continue
+		}
+		for i, e := range edges {
+			// Offset the middle of each edge perpendicular to the line
+			// between the nodes, the same way for both directions
+			a, b := e.points[0], e.points[1]
+			if e.from != edges[0].from {
+				a, b = b, a
+			}
+			dx, dy := b.x-a.x, b.y-a.y
+			d := math.Hypot(dx, dy)
+			if d == 0 {
+				continue
+			}
+			offset := (float64(i) - float64(len(edges)-1)/2) * 20
+			mid := point{(a.x+b.x)/2 - dy/d*offset, (a.y+b.y)/2 + dx/d*offset}
+			e.points = []point{clip(e.from, mid), mid, clip(e.to, mid)}
+		}
+	}
+}
+
+// nodeSize returns the size of a node's shape around its label
+func nodeSize(n *node) (float64, float64) {
+	w, h := textSize(n.label)
+	switch n.shape {
+	case shapePlain:
+		return w + 4, h + 4
+	case shapeEllipse:
+		return math.Max(w*1.25+24, 60), h*1.25 + 14
+	case shapeCircle:
+		d := math.Max(math.Hypot(w, h)+12, 40)
+		return d, d
+	case shapeDiamond:
+		return w*1.6 + 30, h*1.6 + 20
+	}
+	return math.Max(w+24, 40), h + 18
+}
+
+// rank assigns each node its longest path from a source, reversing edges
+// that close cycles
+func (g *graph) rank() {
+	// Depth-first search marks edges back to a node on the stack
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make(map[*node]int)
+	outgoing := make(map[*node][]*edge)
+	for _, e := range g.edges {
+		outgoing[e.from] = append(outgoing[e.from], e)
+	}
+	var visit func(n *node)
+	visit = func(n *node) {
+		state[n] = active
+		for _, e := range outgoing[n] {
+			switch state[e.to] {
+			case unvisited:
+				visit(e.to)
+			case active:
+				e.reversed = true
+			}
+		}
+		state[n] = done
+	}
+	for _, n := range g.nodes {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+
+	// Longest path ranking over the acyclic edges
+	indegree := make(map[*node]int)
+	next := make(map[*node][]*node)
+	for _, e := range g.edges {
+		if e.from == e.to {
+			continue
+		}
+		from, to := e.ends()
+		next[from] = append(next[from], to)
+		indegree[to]++
+	}
+	var queue []*node
+	for _, n := range g.nodes {
+		if indegree[n] == 0 {
+			queue = append(queue, n)
+		}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, to := range next[n] {
+			to.rank = max(to.rank, n.rank+1)
+			if indegree[to]--; indegree[to] == 0 {
+				queue = append(queue, to)
+			}
+		}
+	}
+}
+
+// ends returns the ends of an edge by increasing rank
+func (e *edge) ends() (*node, *node) {
+	if e.reversed {
+		return e.to, e.from
+	}
+	return e.from, e.to
+}
+
+// order groups the nodes by rank, adding dummy nodes where edges cross
+// ranks, and orders each rank to reduce crossings
+func (g *graph) order() [][]*node {
+	maxRank := 0
+	for _, n := range g.nodes {
+		maxRank = max(maxRank, n.rank)
+	}
+	ranks := make([][]*node, maxRank+1)
+	for _, n := range g.nodes {
+		ranks[n.rank] = append(ranks[n.rank], n)
+	}
+
+	for _, e := range g.edges {
+		if e.from == e.to {
+			continue
+		}
+		from, to := e.ends()
+		e.chain = []*node{from}
+		for r := from.rank + 1; r < to.rank; r++ {
+			d := &node{dummy: true, rank: r, w: 8}
+			ranks[r] = append(ranks[r], d)
+			e.chain = append(e.chain, d)
+		}
+		e.chain = append(e.chain, to)
+	}
+
+	// Neighbors in the rank above and below
+	up := make(map[*node][]*node)
+	down := make(map[*node][]*node)
+	for _, e := range g.edges {
+		for i := 1; i < len(e.chain); i++ {
+			up[e.chain[i]] = append(up[e.chain[i]], e.chain[i-1])
+			down[e.chain[i-1]] = append(down[e.chain[i-1]], e.chain[i])
+		}
+	}
+
+	setOrder := func(rank []*node) {
+		for i, n := range rank {
+			n.order = i
+		}
+	}
+	for _, rank := range ranks {
+		setOrder(rank)
+	}
+
+	// Barycenter heuristic, sweeping down and up
+	sortRank := func(rank []*node, neighbors map[*node][]*node) {
+		bary := make(map[*node]float64, len(rank))
+		for _, n := range rank {
+			bary[n] = float64(n.order)
+			if adj := neighbors[n]; len(adj) > 0 {
+				sum := 0.0
+				for _, m := range adj {
+					sum += float64(m.order)
+				}
+				bary[n] = sum / float64(len(adj))
+			}
+		}
+		sort.SliceStable(rank, func(i, j int) bool { return bary[rank[i]] < bary[rank[j]] })
+		setOrder(rank)
+	}
+	for i := 0; i < 4; i++ {
+		for r := 1; r < len(ranks); r++ {
+			sortRank(ranks[r], up)
+		}
+		for r := len(ranks) - 2; r >= 0; r-- {
+			sortRank(ranks[r], down)
+		}
+	}
+
+	return ranks
+}
+
+// position places the ranks top to bottom and the nodes of each rank left
+// to right, moving nodes toward their neighbors
+func (g *graph) position(ranks [][]*node, horizontal bool) {
+	// Labels sit beside vertical edges and on horizontal ones
+	labelSpace := 0.0
+	for _, e := range g.edges {
+		if e.label != "" {
+			w, h := textSize(e.label)
+			if horizontal {
+				labelSpace = math.Max(labelSpace, w)
+			} else {
+				labelSpace = math.Max(labelSpace, h)
+			}
+		}
+	}
+	sep := rankSep + labelSpace
+
+	y := 0.0
+	for _, rank := range ranks {
+		height := 0.0
+		for _, n := range rank {
+			height = math.Max(height, n.h)
+		}
+		x := 0.0
+		for _, n := range rank {
+			n.y = y + height/2
+			n.x = x + n.w/2
+			x += n.w + nodeSep
+		}
+		y += height + sep
+	}
+
+	neighbors := make(map[*node][]*node)
+	for _, e := range g.edges {
+		for i := 1; i < len(e.chain); i++ {
+			a, b := e.chain[i-1], e.chain[i]
+			neighbors[a] = append(neighbors[a], b)
+			neighbors[b] = append(neighbors[b], a)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		for _, rank := range ranks {
+			align(rank, neighbors)
+		}
+		for r := len(ranks) - 1; r >= 0; r-- {
+			align(ranks[r], neighbors)
+		}
+	}
+}
+
+// align moves the nodes of a rank toward the average position of their
+// neighbors while keeping their order and spacing
+func align(rank []*node, neighbors map[*node][]*node) {
+	if len(rank) == 0 {
+		return
+	}
+	desired := make([]float64, len(rank))
+	for i, n := range rank {
+		desired[i] = n.x
+		if adj := neighbors[n]; len(adj) > 0 {
+			sum := 0.0
+			for _, m := range adj {
+				sum += m.x
+			}
+			desired[i] = sum / float64(len(adj))
+		}
+	}
+
+	// Push overlapping nodes apart to the right, then back to the left
+	// around the average shift so the rank stays centered on its neighbors
+	x := make([]float64, len(rank))
+	for i, n := range rank {
+		x[i] = desired[i]
+		if i > 0 {
+			x[i] = math.Max(x[i], x[i-1]+(rank[i-1].w+n.w)/2+nodeSep)
+		}
+	}
+	shift := 0.0
+	for i := range rank {
+		shift += x[i] - desired[i]
+	}
+	shift /= float64(len(rank))
+	for i, n := range rank {
+		n.x = x[i] - shift
+	}
+}
+
+// allNodes returns the nodes of the ranks, including dummy nodes
+func (g *graph) allNodes(ranks [][]*node) []*node {
+	var nodes []*node
+	for _, rank := range ranks {
+		nodes = append(nodes, rank...)
+	}
+	return nodes
+}
+
+// route sets the points of an edge, from border to border of its nodes
+func (g *graph) route(e *edge) {
+	if e.from == e.to {
+		n := e.from
+		right := n.x + n.w/2
+		e.points = []point{
+			{right, n.y - n.h/4},
+			{right + loopWidth, n.y - n.h/4},
+			{right + loopWidth, n.y + n.h/4},
+			{right, n.y + n.h/4},
+		}
+		return
+	}
+
+	points := make([]point, len(e.chain))
+	for i, n := range e.chain {
+		points[i] = point{n.x, n.y}
+	}
+	if e.reversed {
+		for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+			points[i], points[j] = points[j], points[i]
+		}
+	}
+	points[0] = clip(e.from, points[1])
+	points[len(points)-1] = clip(e.to, points[len(points)-2])
+	e.points = points
+}
+
+// clip returns where the line from the center of n toward p leaves its shape
+func clip(n *node, p point) point {
+	dx, dy := p.x-n.x, p.y-n.y
+	if dx == 0 && dy == 0 {
+		return point{n.x, n.y}
+	}
+	hw, hh := n.w/2, n.h/2
+
+	var t float64
+	switch n.shape {
+	case shapeEllipse, shapeCircle:
+		t = 1 / math.Sqrt(dx*dx/(hw*hw)+dy*dy/(hh*hh))
+	case shapeDiamond:
+		t = 1 / (math.Abs(dx)/hw + math.Abs(dy)/hh)
+	default:
+		t = math.Min(hw/math.Abs(dx), hh/math.Abs(dy))
+	}
+	return point{n.x + dx*t, n.y + dy*t}
+}
+
+// draw renders the laid out graph as SVG
+func (g *graph) draw() string {
+	// Bounds of nodes, self loops and edge labels
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	extend := func(x, y float64) {
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	for _, n := range g.nodes {
+		extend(n.x-n.w/2, n.y-n.h/2)
+		extend(n.x+n.w/2, n.y+n.h/2)
+	}
+	type label struct {
+		at     point
+		anchor string
+		text   string
+	}
+	var labels []label
+	for _, e := range g.edges {
+		for _, p := range e.points {
+			extend(p.x, p.y)
+		}
+		if e.label == "" {
+			continue
+		}
+		l := label{text: e.label, anchor: "start"}
+		w, h := textSize(e.label)
+		if e.from == e.to {
+			l.at = point{e.points[1].x + 6, (e.points[1].y + e.points[2].y) / 2}
+			extend(l.at.x+w, l.at.y+h/2)
+		} else {
+			// Beside the middle of the middle segment: right of vertical
+			// segments and above horizontal ones
+			i := (len(e.points) - 1) / 2
+			a, b := e.points[i], e.points[i+1]
+			mid := point{(a.x + b.x) / 2, (a.y + b.y) / 2}
+			if math.Abs(b.y-a.y) >= math.Abs(b.x-a.x) {
+				l.at = point{mid.x + 6, mid.y}
+				extend(l.at.x+w, l.at.y-h/2)
+				extend(l.at.x+w, l.at.y+h/2)
+			} else {
+				l.anchor = "middle"
+				l.at = point{mid.x, mid.y - h/2 - 4}
+				extend(l.at.x-w/2, l.at.y-h/2)
+				extend(l.at.x+w/2, l.at.y-h/2)
+			}
+		}
+		labels = append(labels, l)
+	}
+	dx, dy := margin-minX, margin-minY
+
+	var s svg
+	for _, e := range g.edges {
+		points := make([]point, len(e.points))
+		for i, p := range e.points {
+			points[i] = point{p.x + dx, p.y + dy}
+		}
+		class := "edge"
+		if e.style != "" {
+			class += " " + e.style
+		}
+		s.line(class, points)
+		if e.arrow {
+			s.arrow(points[len(points)-2], points[len(points)-1], false)
+		}
+	}
+	for _, l := range labels {
+		s.text(l.at.x+dx, l.at.y+dy, l.text, l.anchor)
+	}
+	for _, n := range g.nodes {
+		x, y := n.x+dx, n.y+dy
+		switch n.shape {
+		case shapeEllipse, shapeCircle:
+			s.element("ellipse", "class", "node", "cx", num(x), "cy", num(y), "rx", num(n.w/2), "ry", num(n.h/2))
+		case shapeDiamond:
+			s.element("polygon", "class", "node", "points", fmt.Sprintf("%s,%s %s,%s %s,%s %s,%s",
+				num(x), num(y-n.h/2), num(x+n.w/2), num(y), num(x), num(y+n.h/2), num(x-n.w/2), num(y)))
+		case shapePlain:
+		default:
+			attrs := []string{"class", "node", "x", num(x - n.w/2), "y", num(y - n.h/2), "width", num(n.w), "height", num(n.h)}
+			if n.shape == shapeRounded {
+				attrs = append(attrs, "rx", num(math.Min(12, n.h/2)))
+			}
+			s.element("rect", attrs...)
+		}
+		s.text(x, y, n.label, "middle")
+	}
+
+	return s.document(maxX-minX+2*margin, maxY-minY+2*margin)
+}
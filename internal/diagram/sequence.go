@@ -0,0 +1,292 @@
+package diagram
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Regexes for sequence diagram lines
+var (
+	// sequenceParticipantRegex matches "participant Alice" or
+	// "participant A as Alice"; actor is a synonym
+	sequenceParticipantRegex = regexp.MustCompile(`^(?i:participant|actor)\s+(.+?)(?:\s+as\s+(.+))?$`)
+
+	// sequenceMessageRegex matches "Alice->Bob: Hello", with --> for a
+	// dashed reply and ->> or -->> for an open arrowhead
+	sequenceMessageRegex = regexp.MustCompile(`^(.+?)\s*(-->>|->>|-->|->)\s*([^:]+?)\s*(?::\s*(.*))?$`)
+
+	// sequenceNoteRegex matches "Note left of A: text", "Note right of A:
+	// text" and "Note over A,B: text"
+	sequenceNoteRegex = regexp.MustCompile(`^(?i:note)\s+(?i:(left of|right of|over))\s+([^:]+?)\s*:\s*(.*)$`)
+
+	// sequenceTitleRegex matches "title: text"
+	sequenceTitleRegex = regexp.MustCompile(`^(?i:title)\s*:?\s*(.+)$`)
+)
+
+// Spacing of sequence diagrams
+const (
+	participantGap = 40.0 // Between participant boxes
+	messageGap     = 30.0 // Beside message labels
+	stepHeight     = 16.0 // Between events
+)
+
+// participant is a column of a sequence diagram
+type participant struct {
+	id, label string
+	w, h      float64
+	x         float64 // Center
+}
+
+// sequenceEvent is a message or a note, in the order they happen
+type sequenceEvent struct {
+	from, to *participant // Note spans from..to; to is nil beside from
+	text     string
+	arrow    string // Message arrow, empty for notes
+	side     string // Note position: left of, right of or over
+}
+
+// sequence is a parsed sequence diagram
+type sequence struct {
+	title        string
+	participants []*participant
+	byID         map[string]*participant
+	events       []*sequenceEvent
+}
+
+// renderSequence renders a sequence diagram
+func renderSequence(source string) (string, error) {
+	s := &sequence{byID: make(map[string]*participant)}
+
+	for i, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "%%") || line == "sequenceDiagram" {
+			continue
+		}
+		if err := s.parseLine(line); err != nil {
+			return "", fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	if len(s.participants) == 0 {
+		return "", fmt.Errorf("diagram has no participants")
+	}
+
+	return s.draw(), nil
+}
+
+// parseLine parses a line of a sequence diagram
+func (s *sequence) parseLine(line string) error {
+	if m := sequenceParticipantRegex.FindStringSubmatch(line); m != nil {
+		p := s.participant(unquote(m[1]))
+		if m[2] != "" {
+			p.label = unquote(strings.TrimSpace(m[2]))
+		}
+		return nil
+	}
+	if m := sequenceNoteRegex.FindStringSubmatch(line); m != nil {
+		side := strings.ToLower(strings.Join(strings.Fields(m[1]), " "))
+		ids := strings.Split(m[2], ",")
+		event := &sequenceEvent{side: side, text: m[3], from: s.participant(strings.TrimSpace(ids[0]))}
+		switch {
+		case len(ids) == 2 && side == "over":
+			event.to = s.participant(strings.TrimSpace(ids[1]))
+		case len(ids) != 1:
+			return fmt.Errorf("a note can only span two participants, and only over them")
+		}
+		s.events = append(s.events, event)
+		return nil
+	}
+	if m := sequenceMessageRegex.FindStringSubmatch(line); m != nil {
+		s.events = append(s.events, &sequenceEvent{
+			from:  s.participant(unquote(strings.TrimSpace(m[1]))),
+			to:    s.participant(unquote(m[3])),
+			arrow: m[2],
+			text:  m[4],
+		})
+		return nil
+	}
+	if m := sequenceTitleRegex.FindStringSubmatch(line); m != nil {
+		s.title = m[1]
+		return nil
+	}
+	return fmt.Errorf("cannot parse %q; expected a participant, a message such as A->B: text, or a note", line)
+}
+
+// participant returns the participant with the given id, adding it if needed
+func (s *sequence) participant(id string) *participant {
+	if p, ok := s.byID[id]; ok {
+		return p
+	}
+	p := &participant{id: id, label: id}
+	s.byID[id] = p
+	s.participants = append(s.participants, p)
+	return p
+}
+
+// index returns the column of a participant
+func (s *sequence) index(p *participant) int {
+	for i, q := range s.participants {
+		if q == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// layout sets the size and position of the participants so their boxes,
+// messages and notes fit, and returns the width of the diagram
+func (s *sequence) layout() float64 {
+	for _, p := range s.participants {
+		w, h := textSize(p.label)
+		p.w, p.h = math.Max(w+24, 60), h+18
+	}
+
+	// gaps[i] is the distance between the centers of columns i and i+1;
+	// the last one is the space right of the last column
+	n := len(s.participants)
+	gaps := make([]float64, n)
+	for i := 0; i < n-1; i++ {
+		gaps[i] = (s.participants[i].w+s.participants[i+1].w)/2 + participantGap
+	}
+	gaps[n-1] = s.participants[n-1].w / 2
+	left := s.participants[0].w / 2
+
+	// need widens the space between columns a and b to at least width
+	need := func(a, b int, width float64) {
+		have := 0.0
+		for i := a; i < b; i++ {
+			have += gaps[i]
+		}
+		if have < width {
+			gaps[b-1] += width - have
+		}
+	}
+	for _, e := range s.events {
+		w, _ := textSize(e.text)
+		from, to := s.index(e.from), s.index(e.to)
+		switch {
+		case e.arrow != "" && from == to:
+			// Self messages loop to the right with their label beside them
+			need(from, from+1, w+messageGap+loopWidth)
+		case e.arrow != "":
+			need(min(from, to), max(from, to), w+messageGap)
+		case e.side == "right of":
+			need(from, from+1, w+24+messageGap)
+		case e.side == "left of":
+			if from == 0 {
+				left = math.Max(left, w+24+messageGap)
+			} else {
+				need(from-1, from, w+24+messageGap)
+			}
+		case e.to != nil:
+			// Notes over two participants cover the columns between them
+			a, b := min(from, to), max(from, to)
+			if a != b {
+				need(a, b, w+24-2*messageGap)
+			}
+		default:
+			// Notes over one participant are centered on it
+			if from == 0 {
+				left = math.Max(left, (w+24)/2)
+			}
+			if from == n-1 {
+				gaps[n-1] = math.Max(gaps[n-1], (w+24)/2)
+			}
+		}
+	}
+
+	x := margin + left
+	for i, p := range s.participants {
+		p.x = x
+		x += gaps[i]
+	}
+	return x + margin
+}
+
+// draw lays out and renders the sequence diagram as SVG
+func (s *sequence) draw() string {
+	width := s.layout()
+
+	var out svg
+	y := margin
+	if s.title != "" {
+		w, h := textSize(s.title)
+		width = math.Max(width, w+2*margin)
+		out.text(width/2, y+h/2, s.title, "middle")
+		y += h + stepHeight
+	}
+
+	boxHeight := 0.0
+	for _, p := range s.participants {
+		boxHeight = math.Max(boxHeight, p.h)
+	}
+	top := y
+	y += boxHeight + stepHeight
+
+	var body svg
+	for _, e := range s.events {
+		w, h := textSize(e.text)
+		switch {
+		case e.arrow == "":
+			x, noteWidth := s.notePosition(e, w+24)
+			body.element("rect", "class", "note", "x", num(x), "y", num(y), "width", num(noteWidth), "height", num(h+12))
+			body.text(x+noteWidth/2, y+h/2+6, e.text, "middle")
+			y += h + 12 + stepHeight
+		case e.from == e.to:
+			x := e.from.x
+			body.text(x+loopWidth+6, y+h/2, e.text, "start")
+			points := []point{{x, y}, {x + loopWidth, y}, {x + loopWidth, y + h + 8}, {x, y + h + 8}}
+			body.line(messageClass(e.arrow), points)
+			body.arrow(points[2], points[3], strings.HasSuffix(e.arrow, ">>"))
+			y += h + 8 + stepHeight
+		default:
+			if e.text != "" {
+				body.text((e.from.x+e.to.x)/2, y+h/2, e.text, "middle")
+				y += h + 4
+			}
+			from, to := point{e.from.x, y}, point{e.to.x, y}
+			body.line(messageClass(e.arrow), []point{from, to})
+			body.arrow(from, to, strings.HasSuffix(e.arrow, ">>"))
+			y += stepHeight
+		}
+	}
+	y += stepHeight / 2
+
+	// Lifelines, then participant boxes at the top and bottom
+	for _, p := range s.participants {
+		out.element("line", "class", "lifeline", "x1", num(p.x), "y1", num(top+boxHeight), "x2", num(p.x), "y2", num(y))
+	}
+	out.sb.WriteString(body.sb.String())
+	for _, p := range s.participants {
+		for _, boxTop := range []float64{top, y} {
+			out.element("rect", "class", "node", "x", num(p.x-p.w/2), "y", num(boxTop), "width", num(p.w), "height", num(boxHeight))
+			out.text(p.x, boxTop+boxHeight/2, p.label, "middle")
+		}
+	}
+
+	return out.document(width, y+boxHeight+margin)
+}
+
+// notePosition returns the left edge and the width of a note
+func (s *sequence) notePosition(e *sequenceEvent, width float64) (float64, float64) {
+	switch {
+	case e.side == "right of":
+		return e.from.x + messageGap/2, width
+	case e.side == "left of":
+		return e.from.x - messageGap/2 - width, width
+	case e.to != nil && e.to != e.from:
+		a, b := math.Min(e.from.x, e.to.x), math.Max(e.from.x, e.to.x)
+		width = math.Max(width, b-a+2*messageGap)
+		return (a+b)/2 - width/2, width
+	}
+	return e.from.x - width/2, width
+}
+
+// messageClass returns the class of a message line
+func messageClass(arrow string) string {
+	if strings.HasPrefix(arrow, "--") {
+		return "edge dashed"
+	}
+	return "edge"
+}
@@ -0,0 +1,110 @@
+package generator
+
+import (
+	parserPkg "gobig/internal/parser"
+)
+
+// Backend emits parsed slides in one output format
+type Backend interface {
+	// Name is the -format value that selects the backend
+	Name() string
+	// MediaType is the MIME type of the generated document
+	MediaType() string
+	// Generate renders the slides with the generator's options. Problems
+	// are available from the generator's Diagnostics afterwards.
+	Generate(g *Generator, slides []*parserPkg.Slide) ([]byte, error)
+}
+
+// backends lists the output formats in the order they are documented
+var backends = []Backend{bigBackend{}, revealBackend{}, pdfBackend{}, pptxBackend{}}
+
+// LookupBackend returns the backend for a -format value, with ok false if
+// there is none. An empty name selects big.js HTML.
+func LookupBackend(name string) (Backend, bool) {
+	if name == "" {
+		name = "html"
+	}
+	for _, backend := range backends {
+		if backend.Name() == name {
+			return backend, true
+		}
+	}
+	return nil, false
+}
+
+// BackendNames returns the names of the output formats
+func BackendNames() []string {
+	names := make([]string, len(backends))
+	for i, backend := range backends {
+		names[i] = backend.Name()
+	}
+	return names
+}
+
+// bigBackend emits a single HTML file presented by big.js
+type bigBackend struct{}
+
+func (bigBackend) Name() string      { return "html" }
+func (bigBackend) MediaType() string { return "text/html; charset=utf-8" }
+
+func (bigBackend) Generate(g *Generator, slides []*parserPkg.Slide) ([]byte, error) {
+	html, err := g.Generate(slides)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(html), nil
+}
+
+// revealBackend emits a single HTML file presented by reveal.js
+type revealBackend struct{}
+
+func (revealBackend) Name() string      { return "reveal" }
+func (revealBackend) MediaType() string { return "text/html; charset=utf-8" }
+
+func (revealBackend) Generate(g *Generator, slides []*parserPkg.Slide) ([]byte, error) {
+	html, err := g.GenerateReveal(slides)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(html), nil
+}
+
+// pdfBackend emits a PDF document with one page per slide
+type pdfBackend struct{}
+
+func (pdfBackend) Name() string      { return "pdf" }
+func (pdfBackend) MediaType() string { return "application/pdf" }
+
+func (pdfBackend) Generate(g *Generator, slides []*parserPkg.Slide) ([]byte, error) {
+	return g.GeneratePDF(slides)
+}
+
+// pptxBackend emits a PowerPoint presentation
+type pptxBackend struct{}
+
+func (pptxBackend) Name() string { return "pptx" }
+func (pptxBackend) MediaType() string {
+	return "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+}
+
+func (pptxBackend) Generate(g *Generator, slides []*parserPkg.Slide) ([]byte, error) {
+	return g.GeneratePPTX(slides)
+}
+
+// begin resets the state recorded by a previous call to a backend and
+// checks the options all backends share
+func (g *Generator) begin(slides []*parserPkg.Slide) {
+	g.dependencies = nil
+	g.diagnostics = nil
+	g.source = ""
+	if len(slides) > 0 {
+		g.source = slides[0].File
+	}
+	g.highlighted = false
+	g.diagrams = false
+	g.assets = nil
+	g.images = nil
+	g.scriptHashes = nil
+	g.styleHashes = nil
+	g.validateImageOptions()
+}
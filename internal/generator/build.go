@@ -0,0 +1,182 @@
+package generator
+
+import (
+	"strconv"
+
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+
+	parserPkg "gobig/internal/parser"
+)
+
+// hiddenStyle hides a build element while keeping its space, so that big.js
+// picks the same font size for every step of a build
+const hiddenStyle = "visibility: hidden"
+
+// buildState tracks which build elements are revealed while rendering one
+// step of a slide with a build
+type buildState struct {
+	mode     string // parser.BuildItems, parser.BuildBlocks or parser.BuildCells, or empty for code steps only
+	revealed int    // Number of build elements shown in this step
+	count    int    // Number of build elements seen so far
+	static   bool   // Whether the slide has visible content outside the build
+	codeStep int    // Index of the line highlight group shown in step-through code blocks
+
+	// Mark unrevealed build elements as reveal.js fragments, shown one step
+	// at a time by reveal.js, instead of hiding them
+	fragments bool
+}
+
+// apply marks the build elements of a parsed markdown document, hiding the
+// ones beyond the revealed count
+func (b *buildState) apply(doc ast.Node) {
+	switch b.mode {
+	case parserPkg.BuildItems:
+		var items []ast.Node
+		for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+			if child.Kind() != ast.KindList {
+				b.static = true
+			}
+		}
+		_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			if entering && n.Kind() == ast.KindListItem {
+				items = append(items, n)
+			}
+			return ast.WalkContinue, nil
+		})
+		for _, item := range items {
+			b.mark(item)
+		}
+
+	case parserPkg.BuildBlocks:
+		for _, child := range children(doc) {
+			if child.Kind() == ast.KindHeading {
+				b.static = true
+				continue
+			}
+			b.mark(child)
+		}
+
+	case parserPkg.BuildCells:
+		// Every top-level block of a layout cell belongs to the same step
+		index := b.count
+		b.count++
+		for _, child := range children(doc) {
+			b.hide(child, index)
+		}
+	}
+}
+
+// mark numbers the next build element and hides it if not yet revealed
+func (b *buildState) mark(n ast.Node) {
+	b.hide(n, b.count)
+	b.count++
+}
+
+// hide hides the build element with the given index if it is not revealed
+// yet, or makes it the fragment of its step
+func (b *buildState) hide(n ast.Node, index int) {
+	if !b.fragments {
+		setHidden(n, index >= b.revealed)
+	} else if index >= b.revealed {
+		setFragment(n, index-b.revealed)
+	}
+}
+
+// children returns a snapshot of n's children, safe to use while the tree
+// is being modified
+func children(n ast.Node) []ast.Node {
+	var nodes []ast.Node
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		nodes = append(nodes, child)
+	}
+	return nodes
+}
+
+// setHidden hides or shows a build element. Blocks whose HTML renderer
+// ignores attributes (code blocks, raw HTML) are wrapped in a div in every
+// step, so that the markup only differs in the style attribute.
+func setHidden(n ast.Node, hidden bool) {
+	target := n
+	if !rendersAttributes(n) {
+		wrapper := &buildBlock{}
+		n.Parent().ReplaceChild(n.Parent(), n, wrapper)
+		wrapper.AppendChild(wrapper, n)
+		target = wrapper
+	}
+	if hidden {
+		target.SetAttributeString("style", []byte(hiddenStyle))
+	}
+}
+
+// setFragment makes a build element a reveal.js fragment. Fragments with
+// the same index are shown together.
+func setFragment(n ast.Node, index int) {
+	target := n
+	if !rendersAttributes(n) {
+		wrapper := &buildBlock{}
+		n.Parent().ReplaceChild(n.Parent(), n, wrapper)
+		wrapper.AppendChild(wrapper, n)
+		target = wrapper
+	}
+	class := "fragment"
+	if existing, ok := target.AttributeString("class"); ok {
+		if s, ok := existing.([]byte); ok {
+			class = string(s) + " " + class
+		}
+	}
+	target.SetAttributeString("class", []byte(class))
+	target.SetAttributeString("data-fragment-index", []byte(strconv.Itoa(index)))
+}
+
+// rendersAttributes reports whether the HTML renderer writes the node's
+// attributes
+func rendersAttributes(n ast.Node) bool {
+	switch n.Kind() {
+	case ast.KindParagraph, ast.KindHeading, ast.KindBlockquote, ast.KindList,
+		ast.KindListItem, ast.KindThematicBreak, extast.KindTable:
+		return true
+	default:
+		return false
+	}
+}
+
+// kindBuildBlock is the node kind of buildBlock
+var kindBuildBlock = ast.NewNodeKind("BuildBlock")
+
+// buildBlock wraps a build element that cannot carry attributes itself
+type buildBlock struct {
+	ast.BaseBlock
+}
+
+// Kind implements ast.Node
+func (n *buildBlock) Kind() ast.NodeKind {
+	return kindBuildBlock
+}
+
+// Dump implements ast.Node
+func (n *buildBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// buildBlockRenderer renders buildBlock nodes as divs
+type buildBlockRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *buildBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindBuildBlock, r.render)
+}
+
+func (r *buildBlockRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString("<div")
+		html.RenderAttributes(w, n, nil)
+		_, _ = w.WriteString(">\n")
+	} else {
+		_, _ = w.WriteString("</div>\n")
+	}
+	return ast.WalkContinue, nil
+}
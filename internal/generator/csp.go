@@ -0,0 +1,80 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// inlineScript returns a <script> element holding js, recording its hash for
+// the Content-Security-Policy
+func (g *Generator) inlineScript(js string) string {
+	g.scriptHashes = append(g.scriptHashes, cspHash(js))
+	return "<script>" + js + "</script>"
+}
+
+// inlineStyle returns a <style> element holding css, recording its hash for
+// the Content-Security-Policy
+func (g *Generator) inlineStyle(css string) string {
+	g.styleHashes = append(g.styleHashes, cspHash(css))
+	return "<style>" + css + "</style>"
+}
+
+// cspHash returns the CSP hash source matching an inline element with the
+// given content
+func cspHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// integrity returns the integrity attribute of an asset holding data, or an
+// empty string unless the Content-Security-Policy is enabled
+func (g *Generator) integrity(data []byte) string {
+	if !g.options.CSP {
+		return ""
+	}
+	sum := sha512.Sum384(data)
+	return fmt.Sprintf(` integrity="sha384-%s"`, base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// cspMeta returns the <meta> element holding the Content-Security-Policy of
+// a big.js deck, or an empty string if it is disabled. Only the scripts and
+// stylesheets written by the generator may run: inline ones by hash, and in
+// directory output assets from the deck's own origin. Style attributes stay
+// allowed for layouts, builds and body styles, and images, fonts and media
+// may be embedded or, for images and media, remote.
+func (g *Generator) cspMeta() string {
+	if !g.options.CSP {
+		return ""
+	}
+
+	scripts := append([]string(nil), g.scriptHashes...)
+	styles := append([]string(nil), g.styleHashes...)
+	if g.options.Directory {
+		scripts = append([]string{"'self'"}, scripts...)
+		styles = append([]string{"'self'"}, styles...)
+	}
+	if len(scripts) == 0 {
+		scripts = []string{"'none'"}
+	}
+	if len(styles) == 0 {
+		styles = []string{"'none'"}
+	}
+
+	directives := []string{
+		"default-src 'none'",
+		"script-src " + strings.Join(scripts, " "),
+		"style-src " + strings.Join(styles, " "),
+		"style-src-attr 'unsafe-inline'",
+		"img-src 'self' data: https:",
+		"font-src 'self' data:",
+		"media-src 'self' data: https:",
+		"frame-src 'self'",
+		"base-uri 'none'",
+		"form-action 'none'",
+	}
+	// The policy holds nothing but keywords and base64, which need no escaping
+	return fmt.Sprintf("<meta http-equiv=\"Content-Security-Policy\" content=\"%s\">\n  ", strings.Join(directives, "; "))
+}
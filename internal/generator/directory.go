@@ -0,0 +1,84 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// assetsDir is the directory, relative to the presentation, that assets are
+// written to in directory output
+const assetsDir = "assets"
+
+// Regex to match characters left out of asset names
+var assetNameRegex = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Asset is a file referenced by a presentation generated for directory
+// output, such as an image, a stylesheet or a script
+type Asset struct {
+	Path string // Slash-separated path relative to the presentation, e.g. "assets/cat-1a2b3c4d5e6f.png"
+	Data []byte
+}
+
+// Assets returns the files to write next to the presentation generated by
+// the last call to Generate or GenerateReveal in directory output. It is
+// empty for single-file output.
+func (g *Generator) Assets() []Asset {
+	return g.assets
+}
+
+// addAsset records a file for directory output and returns its path. The
+// name includes a hash of the content, so that the file can be cached
+// forever and changes get a new name.
+func (g *Generator) addAsset(name string, data []byte) string {
+	sum := sha256.Sum256(data)
+	ext := "." + assetNameRegex.ReplaceAllString(strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")), "")
+	if ext == "." {
+		ext = ""
+	}
+	base := strings.Trim(assetNameRegex.ReplaceAllString(strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)), "-"), "-")
+	if base == "" {
+		base = "asset"
+	}
+	path := fmt.Sprintf("%s/%s-%s%s", assetsDir, base, hex.EncodeToString(sum[:6]), ext)
+
+	for _, asset := range g.assets {
+		if asset.Path == path {
+			return path
+		}
+	}
+	g.assets = append(g.assets, Asset{Path: path, Data: data})
+	return path
+}
+
+// embedURL returns the URL a local file is referenced by: a data URI, or in
+// directory output the path of an asset unless the file is within the
+// inline limit
+func (g *Generator) embedURL(filename string, data []byte) string {
+	if g.options.Directory && len(data) > g.options.InlineLimit {
+		return g.addAsset(filename, data)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", detectContentType(filename), base64.StdEncoding.EncodeToString(data))
+}
+
+// styleElement returns a <style> element holding css, or in directory
+// output a <link> to it as an asset
+func (g *Generator) styleElement(name, css string) string {
+	if g.options.Directory {
+		return fmt.Sprintf(`<link rel="stylesheet" href="%s"%s>`, escapeAttr(g.addAsset(name, []byte(css))), g.integrity([]byte(css)))
+	}
+	return g.inlineStyle("\n" + css + "\n  ")
+}
+
+// scriptElement returns a <script> element holding js, or in directory
+// output one that loads it as an asset
+func (g *Generator) scriptElement(name, js string) string {
+	if g.options.Directory {
+		return fmt.Sprintf(`<script src="%s"%s></script>`, escapeAttr(g.addAsset(name, []byte(js))), g.integrity([]byte(js)))
+	}
+	return g.inlineScript("\n" + js + "\n  ")
+}
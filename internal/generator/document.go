@@ -0,0 +1,373 @@
+package generator
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+
+	"gobig/internal/diagram"
+	parserPkg "gobig/internal/parser"
+)
+
+// docKind is the type of a docBlock
+type docKind int
+
+const (
+	docParagraph docKind = iota
+	docHeading
+	docList
+	docCode
+	docQuote
+	docImage
+	docTable
+	docRule
+)
+
+// docBlock is a block of slide content for backends that lay out slides
+// themselves, such as PDF and PowerPoint, instead of emitting HTML
+type docBlock struct {
+	kind     docKind
+	level    int           // Heading level
+	spans    []docSpan     // Text of paragraphs and headings
+	items    []docItem     // List items
+	ordered  bool          // Whether a list is numbered
+	start    int           // First number of an ordered list
+	code     string        // Code block source, without the final newline
+	src      string        // Image path or URL
+	alt      string        // Image description
+	rows     [][][]docSpan // Table cells by row, the first row is the header
+	children []docBlock    // Blockquote content
+}
+
+// docItem is a list item: its text followed by nested blocks
+type docItem struct {
+	spans    []docSpan
+	children []docBlock
+}
+
+// docSpan is a run of text with a single style
+type docSpan struct {
+	text     string
+	strong   bool
+	emphasis bool
+	code     bool
+	link     string // Link destination, empty if the span is not a link
+}
+
+// docStyle is the style inherited by the inline content of a node
+type docStyle struct {
+	strong, emphasis bool
+	link             string
+}
+
+// documentBlocks parses markdown into blocks. Content that cannot be laid
+// out without a browser, such as raw HTML, is dropped with a warning, and
+// math and diagrams are kept as their source.
+func (g *Generator) documentBlocks(markdown string) []docBlock {
+	source := []byte(markdown)
+	doc := g.md.Parser().Parse(text.NewReader(source))
+	if g.options.Safe {
+		g.sanitizeLinks(doc, source)
+	}
+	return g.docBlocks(doc, source)
+}
+
+// docBlocks converts the block children of a node
+func (g *Generator) docBlocks(parent ast.Node, source []byte) []docBlock {
+	var blocks []docBlock
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		blocks = append(blocks, g.docBlock(n, source)...)
+	}
+	return blocks
+}
+
+// docBlock converts a block node, which may become several blocks when a
+// paragraph contains images
+func (g *Generator) docBlock(n ast.Node, source []byte) []docBlock {
+	switch n := n.(type) {
+	case *ast.Heading:
+		spans, images := g.docInline(n, source, docStyle{})
+		return append([]docBlock{{kind: docHeading, level: n.Level, spans: trimSpans(spans)}}, images...)
+	case *ast.Paragraph, *ast.TextBlock:
+		spans, images := g.docInline(n, source, docStyle{})
+		if spans = trimSpans(spans); len(spans) > 0 {
+			return append([]docBlock{{kind: docParagraph, spans: spans}}, images...)
+		}
+		return images
+	case *ast.List:
+		return []docBlock{g.docList(n, source)}
+	case *ast.FencedCodeBlock:
+		language := string(n.Language(source))
+		if diagram.IsDiagram(language) {
+			g.addDiagnostic(parserPkg.SeverityWarning, "%s diagram is exported as its source", language)
+		}
+		return []docBlock{{kind: docCode, code: codeText(n, source)}}
+	case *ast.CodeBlock:
+		return []docBlock{{kind: docCode, code: codeText(n, source)}}
+	case *mathBlockNode:
+		g.addDiagnostic(parserPkg.SeverityWarning, "math is exported as TeX source")
+		return []docBlock{{kind: docCode, code: "$$\n" + codeText(n, source) + "\n$$"}}
+	case *ast.Blockquote:
+		return []docBlock{{kind: docQuote, children: g.docBlocks(n, source)}}
+	case *ast.ThematicBreak:
+		return []docBlock{{kind: docRule}}
+	case *extast.Table:
+		return []docBlock{g.docTable(n, source)}
+	case *ast.HTMLBlock:
+		if n.HTMLBlockType != ast.HTMLBlockType2 { // Comments are not content
+			g.addDiagnostic(parserPkg.SeverityWarning, "raw HTML is not exported")
+		}
+		return nil
+	}
+	return g.docBlocks(n, source)
+}
+
+// docList converts a list and its nested lists
+func (g *Generator) docList(list *ast.List, source []byte) docBlock {
+	block := docBlock{kind: docList, ordered: list.IsOrdered(), start: list.Start}
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		var di docItem
+		for child := item.FirstChild(); child != nil; child = child.NextSibling() {
+			switch child.(type) {
+			case *ast.Paragraph, *ast.TextBlock:
+				if len(di.spans) == 0 && len(di.children) == 0 {
+					spans, images := g.docInline(child, source, docStyle{})
+					di.spans = trimSpans(spans)
+					di.children = append(di.children, images...)
+					continue
+				}
+			}
+			di.children = append(di.children, g.docBlock(child, source)...)
+		}
+		block.items = append(block.items, di)
+	}
+	return block
+}
+
+// docTable converts a table
+func (g *Generator) docTable(table *extast.Table, source []byte) docBlock {
+	block := docBlock{kind: docTable}
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		var cells [][]docSpan
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			spans, _ := g.docInline(cell, source, docStyle{})
+			cells = append(cells, trimSpans(spans))
+		}
+		block.rows = append(block.rows, cells)
+	}
+	return block
+}
+
+// docInline converts the inline children of a node to spans, returning the
+// images it contains as separate blocks
+func (g *Generator) docInline(parent ast.Node, source []byte, style docStyle) ([]docSpan, []docBlock) {
+	var spans []docSpan
+	var images []docBlock
+	add := func(s string, code bool) {
+		spans = append(spans, docSpan{text: s, strong: style.strong, emphasis: style.emphasis, code: code, link: style.link})
+	}
+
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		switch n := n.(type) {
+		case *ast.Text:
+			add(string(n.Segment.Value(source)), false)
+			if n.HardLineBreak() {
+				add("\n", false)
+			} else if n.SoftLineBreak() {
+				add(" ", false)
+			}
+		case *ast.String:
+			add(string(n.Value), false)
+		case *ast.CodeSpan:
+			var sb strings.Builder
+			for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+				if t, ok := c.(*ast.Text); ok {
+					sb.Write(t.Segment.Value(source))
+				}
+			}
+			add(sb.String(), true)
+		case *ast.Emphasis:
+			inner := style
+			if n.Level >= 2 {
+				inner.strong = true
+			} else {
+				inner.emphasis = true
+			}
+			s, i := g.docInline(n, source, inner)
+			spans, images = append(spans, s...), append(images, i...)
+		case *ast.Link:
+			inner := style
+			inner.link = string(n.Destination)
+			s, i := g.docInline(n, source, inner)
+			spans, images = append(spans, s...), append(images, i...)
+		case *ast.AutoLink:
+			inner := style
+			inner.link = string(n.URL(source))
+			if n.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(inner.link, "mailto:") {
+				inner.link = "mailto:" + inner.link
+			}
+			spans = append(spans, docSpan{text: string(n.Label(source)), strong: inner.strong, emphasis: inner.emphasis, link: inner.link})
+		case *ast.Image:
+			alt, _ := g.docInline(n, source, docStyle{})
+			images = append(images, docBlock{kind: docImage, src: string(n.Destination), alt: spansText(alt)})
+		case *mathNode:
+			g.addDiagnostic(parserPkg.SeverityWarning, "math is exported as TeX source")
+			add("$"+string(n.tex.Value(source))+"$", true)
+		case *extast.TaskCheckBox:
+			if n.IsChecked {
+				add("[x] ", false)
+			} else {
+				add("[ ] ", false)
+			}
+		case *ast.RawHTML:
+			// Inline tags such as <br> or <span> are dropped silently, the
+			// text between them is kept
+		default:
+			s, i := g.docInline(n, source, style)
+			spans, images = append(spans, s...), append(images, i...)
+		}
+	}
+	return spans, images
+}
+
+// codeText returns the source of a code or math block without the final
+// newline
+func codeText(n ast.Node, source []byte) string {
+	var sb strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		sb.Write(segment.Value(source))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// trimSpans removes leading and trailing white space from spans
+func trimSpans(spans []docSpan) []docSpan {
+	for len(spans) > 0 {
+		first := &spans[0]
+		first.text = strings.TrimLeft(first.text, " \t\n")
+		if first.text != "" {
+			break
+		}
+		spans = spans[1:]
+	}
+	for len(spans) > 0 {
+		last := &spans[len(spans)-1]
+		last.text = strings.TrimRight(last.text, " \t\n")
+		if last.text != "" {
+			break
+		}
+		spans = spans[:len(spans)-1]
+	}
+	return spans
+}
+
+// mergeSpans joins adjacent spans of the same style
+func mergeSpans(spans []docSpan) []docSpan {
+	var merged []docSpan
+	for _, span := range spans {
+		if n := len(merged); n > 0 {
+			last := merged[n-1]
+			last.text = span.text
+			if last == span {
+				merged[n-1].text += span.text
+				continue
+			}
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// spansText returns the plain text of spans
+func spansText(spans []docSpan) string {
+	var sb strings.Builder
+	for _, span := range spans {
+		sb.WriteString(span.text)
+	}
+	return sb.String()
+}
+
+// listMarker returns the bullet or number of the i-th item of a list nested
+// depth levels deep
+func listMarker(block docBlock, i, depth int) string {
+	if block.ordered {
+		return strconv.Itoa(block.start+i) + "."
+	}
+	if depth%2 == 1 {
+		return "–"
+	}
+	return "•"
+}
+
+// layoutGrid returns the relative column widths and row heights of a named
+// layout, with ok false for custom CSS layouts
+func layoutGrid(layout string) (columns, rows []float64, ok bool) {
+	switch layout {
+	case "50-50":
+		return []float64{50, 50}, nil, true
+	case "75-25":
+		return []float64{75, 25}, nil, true
+	case "25-75":
+		return []float64{25, 75}, nil, true
+	case "50-50-rows":
+		return nil, []float64{50, 50}, true
+	case "75-25-rows":
+		return nil, []float64{75, 25}, true
+	case "25-75-rows":
+		return nil, []float64{25, 75}, true
+	case "grid-3x2":
+		return []float64{1, 1, 1}, []float64{1, 1}, true
+	case "grid-2x3":
+		return []float64{1, 1}, []float64{1, 1, 1}, true
+	}
+	return nil, nil, false
+}
+
+// gridCell is the position of a layout cell as fractions of the slide
+type gridCell struct {
+	x, y, w, h float64
+}
+
+// layoutCells places n parts on the grid of a named layout, in rows from
+// left to right like CSS grid auto-placement. Parts that do not fit the
+// grid add rows of equal height.
+func layoutCells(columns, rows []float64, n int) []gridCell {
+	if len(columns) == 0 {
+		columns = []float64{1}
+	}
+	needed := int(math.Ceil(float64(n) / float64(len(columns))))
+	if len(rows) == 0 {
+		rows = []float64{1}
+	}
+	for len(rows) < needed {
+		rows = append(rows, sum(rows)/float64(len(rows)))
+	}
+
+	cells := make([]gridCell, 0, n)
+	totalW, totalH := sum(columns), sum(rows)
+	y := 0.0
+	for r := 0; r < len(rows) && len(cells) < n; r++ {
+		x := 0.0
+		for c := 0; c < len(columns) && len(cells) < n; c++ {
+			cells = append(cells, gridCell{x: x / totalW, y: y / totalH, w: columns[c] / totalW, h: rows[r] / totalH})
+			x += columns[c]
+		}
+		y += rows[r]
+	}
+	return cells
+}
+
+// sum returns the sum of values
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
@@ -0,0 +1,103 @@
+package generator
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gobig/internal/assets"
+	parserPkg "gobig/internal/parser"
+)
+
+// Regex to match HTML tags, used to get the text of rendered slides
+var tagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// Regex to match safe CSS font-weight and font-style values
+var fontKeywordRegex = regexp.MustCompile(`^[A-Za-z0-9 .%-]+$`)
+
+// fontFaceCSS returns @font-face rules embedding the fonts declared in the
+// presentation metadata as data URIs, subset to the glyphs of text if
+// subset is set. Unreadable fonts are reported as errors.
+func (g *Generator) fontFaceCSS(subset bool, text string) string {
+	var sb strings.Builder
+
+	for _, font := range g.options.PresentationMetadata.Fonts {
+		if font.Family == "" || font.Src == "" {
+			continue
+		}
+
+		path := font.Src
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(g.options.BasePath, path)
+		}
+		if g.refusePath(path, font.Src) {
+			continue
+		}
+		g.addDependency(path)
+
+		if !assets.IsFontFile(path) {
+			g.addDiagnostic(parserPkg.SeverityError, "font %s must be a woff2, woff, ttf or otf file", font.Src)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			g.addDiagnostic(parserPkg.SeverityError, "failed to read font %s: %v", font.Src, err)
+			continue
+		}
+
+		uri := assets.FontDataURI(path, data)
+		if subset {
+			// Subset fonts are always TrueType
+			if subsetData, err := assets.SubsetFont(data, text); err != nil {
+				g.addDiagnostic(parserPkg.SeverityWarning, "font %s embedded without subsetting: %v", font.Src, err)
+			} else {
+				uri = assets.FontDataURI(".ttf", subsetData)
+			}
+		}
+
+		sb.WriteString("@font-face {\n")
+		sb.WriteString(fmt.Sprintf("  font-family: %s;\n", cssString(font.Family)))
+		sb.WriteString(fmt.Sprintf("  src: url(\"%s\");\n", uri))
+		for _, descriptor := range []struct{ name, value string }{
+			{"font-weight", font.Weight},
+			{"font-style", font.Style},
+		} {
+			if descriptor.value == "" {
+				continue
+			}
+			if !fontKeywordRegex.MatchString(descriptor.value) {
+				g.addDiagnostic(parserPkg.SeverityError, "invalid %s %q for font %s", descriptor.name, descriptor.value, font.Family)
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("  %s: %s;\n", descriptor.name, descriptor.value))
+		}
+		sb.WriteString("  font-display: block;\n")
+		sb.WriteString("}\n")
+	}
+
+	return sb.String()
+}
+
+// visibleText returns the text content of rendered HTML
+func visibleText(htmlContent string) string {
+	return html.UnescapeString(tagRegex.ReplaceAllString(htmlContent, " "))
+}
+
+// cssString quotes s as a CSS string that is safe inside a <style> element
+func cssString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\', '<', '>', '\n', '\r', '\f':
+			sb.WriteString(fmt.Sprintf("\\%x ", r))
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
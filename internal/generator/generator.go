@@ -2,17 +2,21 @@ package generator
 
 import (
 	"bytes"
-	"encoding/base64"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 
 	"gobig/internal/assets"
 	parserPkg "gobig/internal/parser"
@@ -20,17 +24,44 @@ import (
 
 // Options contains configuration for HTML generation
 type Options struct {
-	Theme                string                         // "dark", "light", or "white"
+	Theme                string                         // "dark", "light", "white", a CSS file or a theme directory
+	ThemePaths           []string                       // Directories searched for themes given by name
 	Title                string                         // Presentation title
 	AspectRatio          string                         // Aspect ratio (e.g., "1.6", "2", "false")
-	BasePath             string                         // Base path for resolving relative image paths
-	PresentationMetadata parserPkg.PresentationMetadata // Presentation-level metadata
+	BasePath             string                         // Base path for resolving relative image paths of slides without a source file
+	Presenter            bool                           // Include the presenter view (press "s" while presenting)
+	PlainNotes           bool                           // Emit speaker notes as escaped plain text instead of Markdown HTML
+	SubsetFonts          bool                           // Reduce embedded fonts to the glyphs used in the deck
+	HighlightStyle       string                         // Syntax highlighting style for code blocks, "none" to disable (default: matches the theme)
+	NotesPages           bool                           // Follow each slide with a page of its speaker notes in PDF output
+	RevealURL            string                         // Base URL of the reveal.js package for reveal.js output (default: DefaultRevealURL)
+	Directory            bool                           // Write images, CSS and JS as separate files in an assets directory (see Generator.Assets) instead of inlining them
+	InlineLimit          int                            // In directory output, images of at most this many bytes are still inlined as data URIs
+	OptimizeImages       bool                           // Downscale and re-encode local JPEG and PNG images, removing EXIF and other metadata
+	ImageWidth           int                            // Screen width in pixels that optimized images are scaled for (default: 1920)
+	ImageQuality         int                            // JPEG quality of optimized images, from 1 to 100 (default: 85)
+	ImageVariants        bool                           // In directory output, add srcset variants of optimized images at half and quarter width
+	Strict               bool                           // Report problems with slide content, such as invalid math, as errors instead of warnings
+	Safe                 bool                           // Sanitize raw HTML and remove javascript: and other unsafe URLs, for untrusted Markdown
+	CSP                  bool                           // Add a Content-Security-Policy allowing only the generator's own scripts and styles to big.js output, and integrity attributes to assets
+	PresentationMetadata parserPkg.PresentationMetadata // Presentation-level metadata, used where the options above leave a setting unset
 }
 
 // Generator handles HTML generation from parsed slides
 type Generator struct {
-	options Options
-	md      goldmark.Markdown
+	options      Options
+	md           goldmark.Markdown
+	dependencies []string
+	diagnostics  []parserPkg.Diagnostic
+	source       string                     // File presentation-level problems are reported against
+	current      *parserPkg.Slide           // Slide being rendered
+	highlighted  bool                       // Whether a code block was highlighted
+	diagrams     bool                       // Whether a diagram was rendered
+	codeStep     int                        // Line highlight group shown in step-through code blocks
+	assets       []Asset                    // Files referenced by directory output
+	images       map[string]*optimizedImage // Local images by path
+	scriptHashes []string                   // CSP hashes of inline scripts
+	styleHashes  []string                   // CSP hashes of inline styles
 }
 
 // NewGenerator creates a new generator with the given options
@@ -40,30 +71,44 @@ func NewGenerator(opts Options) *Generator {
 		opts.Theme = "dark"
 	}
 
+	g := &Generator{options: opts}
+
+	// Raw HTML is allowed, or in safe mode passed through the sanitizer
+	rendererOptions := []renderer.Option{
+		renderer.WithNodeRenderers(
+			util.Prioritized(&buildBlockRenderer{}, 500),
+			util.Prioritized(&codeBlockRenderer{g: g}, 500),
+		),
+	}
+	if opts.Safe {
+		rendererOptions = append(rendererOptions, renderer.WithNodeRenderers(util.Prioritized(&safeHTMLRenderer{g: g}, 500)))
+	} else {
+		rendererOptions = append(rendererOptions, html.WithUnsafe())
+	}
+
 	// Create goldmark markdown processor
-	md := goldmark.New(
+	g.md = goldmark.New(
 		goldmark.WithExtensions(
 			extension.GFM,   // GitHub Flavored Markdown
 			extension.Table, // Tables
 			extension.Strikethrough,
 			extension.TaskList,
+			&mathExtension{g: g}, // $...$ and $$...$$ math as MathML
 		),
 		goldmark.WithParserOptions(
 			parser.WithAutoHeadingID(),
 		),
-		goldmark.WithRendererOptions(
-			html.WithUnsafe(), // Allow raw HTML
-		),
+		goldmark.WithRendererOptions(rendererOptions...),
 	)
 
-	return &Generator{
-		options: opts,
-		md:      md,
-	}
+	return g
 }
 
 // Generate creates the final HTML output from slides
 func (g *Generator) Generate(slides []*parserPkg.Slide) (string, error) {
+	g.begin(slides)
+	g.validateHighlightStyle()
+
 	// Get embedded assets
 	bigJS, err := assets.GetBigJS()
 	if err != nil {
@@ -75,22 +120,94 @@ func (g *Generator) Generate(slides []*parserPkg.Slide) (string, error) {
 		return "", fmt.Errorf("failed to get big.css: %w", err)
 	}
 
-	themeCSS, err := assets.GetTheme(g.options.Theme)
+	// Generate slides HTML
+	slidesHTML := g.generateSlides(slides)
+
+	theme, fontCSS, err := g.loadHTMLTheme(slidesHTML)
 	if err != nil {
-		return "", fmt.Errorf("failed to get theme: %w", err)
+		return "", err
 	}
 
-	// Generate slides HTML
-	slidesHTML := g.generateSlides(slides)
+	if errors := g.countErrors(); errors > 0 {
+		return "", fmt.Errorf("%d problem(s) found", errors)
+	}
+
+	// Generate aspect ratio script
+	aspectRatioScript, err := g.aspectRatioScript(g.options.AspectRatio)
+	if err != nil {
+		return "", err
+	}
+
+	// Add the presenter view if requested by flag or presentation metadata
+	extraJS := ""
+	if g.options.Presenter || g.options.PresentationMetadata.Presenter {
+		presenterJS, err := assets.GetPresenterJS()
+		if err != nil {
+			return "", fmt.Errorf("failed to get presenter.js: %w", err)
+		}
+		extraJS = g.presenterScript(g.scriptElement("presenter.js", presenterJS), g.options.PresentationMetadata.Duration)
+	}
+
+	// Generate final HTML. The policy is built last, from the hashes of the
+	// inline elements.
+	bigCSSElement := g.styleElement("big.css", bigCSS)
+	themeCSSElement := g.styleElement("theme.css", g.highlightStyleCSS()+g.diagramCSS()+fontCSS+theme.CSS)
+	bigJSElement := g.scriptElement("big.js", bigJS)
+	html := generateHTML(
+		g.cspMeta(),
+		escapeHTML(g.title(slides)),
+		bigCSSElement,
+		themeCSSElement,
+		aspectRatioScript,
+		bigJSElement,
+		extraJS,
+		escapeAttr(theme.Name),
+		slidesHTML,
+	)
+
+	return html, nil
+}
+
+// loadHTMLTheme loads the theme and returns it with the @font-face rules
+// of the presentation's fonts, both subset to the text of slidesHTML if
+// requested
+func (g *Generator) loadHTMLTheme(slidesHTML string) (*assets.Theme, string, error) {
+	subsetFonts := g.options.SubsetFonts || g.options.PresentationMetadata.SubsetFonts
+	subsetText := ""
+	if subsetFonts {
+		subsetText = visibleText(slidesHTML)
+	}
+	fontCSS := g.fontFaceCSS(subsetFonts, subsetText)
+
+	theme, err := assets.LoadThemeWithOptions(g.options.Theme, assets.ThemeOptions{
+		SearchPaths: g.options.ThemePaths,
+		SubsetFonts: subsetFonts,
+		SubsetText:  subsetText,
+		Confine:     g.options.Safe,
+	})
+	if theme != nil {
+		for _, file := range theme.Files {
+			g.addDependency(file)
+		}
+		for _, warning := range theme.Warnings {
+			g.addDiagnostic(parserPkg.SeverityWarning, "%s", warning)
+		}
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get theme: %w", err)
+	}
+	return theme, fontCSS, nil
+}
 
-	// Determine title with priority:
-	// 1. Presentation metadata (overrides flag)
-	// 2. Command-line flag
-	// 3. First slide's text
-	// 4. Default "Presentation"
-	title := g.options.PresentationMetadata.Title
+// title returns the presentation title with priority:
+// 1. Options (the command line resolves flags, metadata and configuration into them)
+// 2. Presentation metadata
+// 3. First slide's text
+// 4. Default "Presentation"
+func (g *Generator) title(slides []*parserPkg.Slide) string {
+	title := g.options.Title
 	if title == "" {
-		title = g.options.Title
+		title = g.options.PresentationMetadata.Title
 	}
 	if title == "" && len(slides) > 0 {
 		title = extractTitle(slides[0].Content)
@@ -98,75 +215,217 @@ func (g *Generator) Generate(slides []*parserPkg.Slide) (string, error) {
 	if title == "" {
 		title = "Presentation"
 	}
+	return title
+}
 
-	// Generate aspect ratio script
-	aspectRatioScript := aspectRatioScript(g.options.AspectRatio)
+// Dependencies returns the local files referenced by the last call to
+// Generate, such as embedded images, including ones that could not be read
+func (g *Generator) Dependencies() []string {
+	return g.dependencies
+}
 
-	// Generate final HTML
-	html := generateHTML(
-		title,
-		bigCSS,
-		themeCSS,
-		aspectRatioScript,
-		bigJS,
-		g.options.Theme,
-		slidesHTML,
-	)
+// addDependency records a local file used by the presentation
+func (g *Generator) addDependency(path string) {
+	for _, dep := range g.dependencies {
+		if dep == path {
+			return
+		}
+	}
+	g.dependencies = append(g.dependencies, path)
+}
 
-	return html, nil
+// Diagnostics returns the problems found by the last call to Generate
+func (g *Generator) Diagnostics() []parserPkg.Diagnostic {
+	return g.diagnostics
+}
+
+// addDiagnostic records a problem with the slide being rendered, or with the
+// presentation as a whole outside of a slide
+func (g *Generator) addDiagnostic(severity parserPkg.Severity, format string, args ...interface{}) {
+	g.addDiagnosticAt(severity, 0, format, args...)
+}
+
+// addProblem records a problem with slide content on the line of the
+// current slide holding text. It is an error in strict mode and a warning
+// otherwise.
+func (g *Generator) addProblem(text string, format string, args ...interface{}) {
+	severity := parserPkg.SeverityWarning
+	if g.options.Strict {
+		severity = parserPkg.SeverityError
+	}
+	g.addDiagnosticAt(severity, g.contentLine(text), format, args...)
+}
+
+// contentLine returns the line of the current slide's source file where
+// text first appears in its content, or 0 if it is not found
+func (g *Generator) contentLine(text string) int {
+	if g.current == nil || g.current.ContentLine == 0 {
+		return 0
+	}
+	i := strings.Index(g.current.Content, text)
+	if i < 0 {
+		first, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+		if i = strings.Index(g.current.Content, first); first == "" || i < 0 {
+			return 0
+		}
+	}
+	return g.current.ContentLine + strings.Count(g.current.Content[:i], "\n")
+}
+
+// addDiagnosticAt records a diagnostic for the slide being rendered, at the
+// given line of its source file or, for line 0, where the slide starts
+func (g *Generator) addDiagnosticAt(severity parserPkg.Severity, line int, format string, args ...interface{}) {
+	d := parserPkg.Diagnostic{
+		Severity: severity,
+		File:     g.source,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if g.current != nil {
+		d.File = g.current.File
+		d.Line = g.current.StartLine
+		if line > 0 {
+			d.Line = line
+		}
+	}
+
+	// Slides with several steps are rendered more than once
+	for _, existing := range g.diagnostics {
+		if existing == d {
+			return
+		}
+	}
+	g.diagnostics = append(g.diagnostics, d)
+}
+
+// countErrors returns the number of error diagnostics recorded so far
+func (g *Generator) countErrors() int {
+	count := 0
+	for _, d := range g.diagnostics {
+		if d.Severity == parserPkg.SeverityError {
+			count++
+		}
+	}
+	return count
 }
 
-// generateSlides converts all slides to HTML
+// headingIDRegex matches the id attribute of a heading
+var headingIDRegex = regexp.MustCompile(`(<h[1-6]\b[^>]*?) id="[^"]*"`)
+
+// dropHeadingIDs removes the ids of the headings in a repeated step of a
+// slide, so that in-page links lead to its first step
+func dropHeadingIDs(html string) string {
+	return headingIDRegex.ReplaceAllString(html, "$1")
+}
+
+// generateSlides converts all slides to HTML. A slide with a build or with
+// step-through code blocks is expanded into one big.js slide per step.
 func (g *Generator) generateSlides(slides []*parserPkg.Slide) string {
 	var sb strings.Builder
 
 	for _, slide := range slides {
-		slideHTML := g.generateSlide(slide)
-		sb.WriteString(slideHTML)
-		sb.WriteString("\n")
+		steps := g.buildSteps(slide)
+		for i, step := range steps {
+			slideHTML := g.generateSlide(slide, step, len(steps))
+			if i > 0 {
+				slideHTML = dropHeadingIDs(slideHTML)
+			}
+			sb.WriteString(slideHTML)
+			sb.WriteString("\n")
+		}
 	}
 
 	return sb.String()
 }
 
-// generateSlide converts a single slide to HTML
-func (g *Generator) generateSlide(slide *parserPkg.Slide) string {
+// buildSteps returns the build state of each step of a slide, or a single
+// nil state if the slide has neither a build nor step-through code. Code
+// steps follow the steps of the build, with every build element revealed.
+func (g *Generator) buildSteps(slide *parserPkg.Slide) []*buildState {
+	steps := []*buildState{nil}
+	if slide.Metadata.Build != "" {
+		steps = g.buildElementSteps(slide)
+	}
+
+	last := steps[len(steps)-1]
+	for step := 1; step < g.codeSteps(slide); step++ {
+		next := &buildState{codeStep: step}
+		if last != nil {
+			next.mode = last.mode
+			next.revealed = last.revealed
+		}
+		steps = append(steps, next)
+	}
+	return steps
+}
+
+// buildElementSteps returns the build state of each step of a slide's
+// build, or a single nil state if it has no build elements
+func (g *Generator) buildElementSteps(slide *parserPkg.Slide) []*buildState {
+	// Count the build elements by revealing all of them
+	probe := &buildState{mode: slide.Metadata.Build, revealed: -1}
+	for _, part := range g.contentParts(slide) {
+		probe.apply(g.md.Parser().Parse(text.NewReader([]byte(part))))
+	}
+	if probe.count == 0 {
+		return []*buildState{nil}
+	}
+
+	// Start with nothing revealed only if something else is visible
+	first := 1
+	if probe.static {
+		first = 0
+	}
+
+	var steps []*buildState
+	for revealed := first; revealed <= probe.count; revealed++ {
+		steps = append(steps, &buildState{mode: slide.Metadata.Build, revealed: revealed})
+	}
+	return steps
+}
+
+// contentParts returns the markdown rendered for a slide: one part per
+// layout cell, or the whole content for regular slides
+func (g *Generator) contentParts(slide *parserPkg.Slide) []string {
+	if slide.Metadata.Layout != "" {
+		return splitContentForLayout(slide.Content)
+	}
+	return []string{slide.Content}
+}
+
+// generateSlide converts a single slide, or one step of its build, to HTML
+func (g *Generator) generateSlide(slide *parserPkg.Slide, build *buildState, steps int) string {
+	g.current = slide
+	g.codeStep = 0
+	if build != nil {
+		g.codeStep = build.codeStep
+	}
+	defer func() { g.current, g.codeStep = nil, 0 }()
+
 	var sb strings.Builder
 
 	// Start slide div with optional attributes
 	sb.WriteString("  <div")
 
 	// Add data attributes
-	// Determine time-to-next: slide-level overrides presentation-level
-	timeToNext := slide.Metadata.TimeToNext
-	if timeToNext == 0 && g.options.PresentationMetadata.TimeToNext > 0 {
-		timeToNext = g.options.PresentationMetadata.TimeToNext
-	}
-	if timeToNext > 0 {
-		sb.WriteString(fmt.Sprintf(` data-time-to-next="%d"`, timeToNext))
+	if timeToNext := g.timeToNext(slide); timeToNext > 0 {
+		// The slide's time is spread evenly across the steps of its build
+		seconds := float64(timeToNext) / float64(steps)
+		sb.WriteString(fmt.Sprintf(` data-time-to-next="%s"`, strconv.FormatFloat(seconds, 'f', -1, 64)))
 	}
 
-	if slide.Metadata.BodyStyle != "" {
-		sb.WriteString(fmt.Sprintf(` data-body-style="%s"`, escapeAttr(slide.Metadata.BodyStyle)))
+	if style := cssStyle(slide.Metadata.BodyStyle); style != "" {
+		sb.WriteString(fmt.Sprintf(` data-body-style="%s"`, escapeAttr(style)))
 	}
 	if slide.Metadata.BodyClass != "" {
 		sb.WriteString(fmt.Sprintf(` data-body-class="%s"`, escapeAttr(slide.Metadata.BodyClass)))
 	}
 
 	sb.WriteString(">")
-
-	// Handle layouts
-	if slide.Metadata.Layout != "" {
-		sb.WriteString(g.generateLayoutSlide(slide))
-	} else {
-		// Regular slide - convert markdown to HTML
-		html := g.markdownToHTML(slide.Content)
-		sb.WriteString(html)
-	}
+	sb.WriteString(g.slideContent(slide, build))
 
 	// Add speaker notes if present
 	if slide.Notes != "" {
-		sb.WriteString(fmt.Sprintf("\n    <notes>%s</notes>", escapeHTML(slide.Notes)))
+		sb.WriteString(fmt.Sprintf("\n    <notes>%s</notes>", g.notesToHTML(slide.Notes)))
 	}
 
 	sb.WriteString("\n  </div>")
@@ -174,18 +433,51 @@ func (g *Generator) generateSlide(slide *parserPkg.Slide) string {
 	return sb.String()
 }
 
+// timeToNext returns the seconds before a slide advances on its own, 0 for
+// none. The slide's time-to-next overrides the presentation's.
+func (g *Generator) timeToNext(slide *parserPkg.Slide) int {
+	if slide.Metadata.TimeToNext > 0 {
+		return slide.Metadata.TimeToNext
+	}
+	return g.options.PresentationMetadata.TimeToNext
+}
+
+// slideContent converts the content of a slide, or one step of its build,
+// to HTML
+func (g *Generator) slideContent(slide *parserPkg.Slide, build *buildState) string {
+	// Handle layouts
+	if slide.Metadata.Layout != "" {
+		return g.generateLayoutSlide(slide, build)
+	}
+	// Regular slide - convert markdown to HTML
+	return g.renderMarkdown(slide.Content, build)
+}
+
+// notesToHTML renders speaker notes as Markdown, or as escaped plain text
+// when PlainNotes is set (big.js logs notes to the console verbatim)
+func (g *Generator) notesToHTML(notes string) string {
+	if g.options.PlainNotes {
+		return escapeHTML(notes)
+	}
+	return g.markdownToHTML(notes)
+}
+
 // generateLayoutSlide generates a slide with CSS Grid layout
-func (g *Generator) generateLayoutSlide(slide *parserPkg.Slide) string {
+func (g *Generator) generateLayoutSlide(slide *parserPkg.Slide, build *buildState) string {
 	gridStyle := layoutToGridStyle(slide.Metadata.Layout)
 
 	// Split content by image/text blocks
 	parts := splitContentForLayout(slide.Content)
 
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("\n    <div class=\"layout\" style=\"%s\">", gridStyle))
+	if gridStyle == "" {
+		sb.WriteString("\n    <div class=\"layout\">")
+	} else {
+		sb.WriteString(fmt.Sprintf("\n    <div class=\"layout\" style=\"%s\">", escapeAttr(gridStyle)))
+	}
 
 	for _, part := range parts {
-		html := g.markdownToHTML(part)
+		html := g.renderMarkdown(part, build)
 		sb.WriteString("\n      ")
 		sb.WriteString(html)
 	}
@@ -197,8 +489,23 @@ func (g *Generator) generateLayoutSlide(slide *parserPkg.Slide) string {
 
 // markdownToHTML converts markdown to HTML
 func (g *Generator) markdownToHTML(markdown string) string {
+	return g.renderMarkdown(markdown, nil)
+}
+
+// renderMarkdown converts markdown to HTML, hiding the build elements that
+// the given build step has not revealed yet
+func (g *Generator) renderMarkdown(markdown string, build *buildState) string {
+	source := []byte(markdown)
+	doc := g.md.Parser().Parse(text.NewReader(source))
+	if g.options.Safe {
+		g.sanitizeLinks(doc, source)
+	}
+	if build != nil {
+		build.apply(doc)
+	}
+
 	var buf bytes.Buffer
-	if err := g.md.Convert([]byte(markdown), &buf); err != nil {
+	if err := g.md.Renderer().Render(&buf, source, doc); err != nil {
 		return markdown // Fallback to raw content
 	}
 
@@ -210,9 +517,35 @@ func (g *Generator) markdownToHTML(markdown string) string {
 	return strings.TrimSpace(html)
 }
 
-// processImages converts local image paths to base64 data URIs
+// imageDir returns the directory relative image paths are resolved against:
+// the directory of the current slide's source file, so that slides from
+// included files find their own images, or BasePath otherwise
+func (g *Generator) imageDir() string {
+	if g.current != nil && g.current.File != "" {
+		dir, err := filepath.Abs(filepath.Dir(g.current.File))
+		if err == nil {
+			return dir
+		}
+	}
+	return g.options.BasePath
+}
+
+// refusePath reports whether safe mode forbids reading path, a local file
+// the presentation refers to by name, because it is outside BasePath, the
+// presentation's directory. Refused files are reported as errors.
+func (g *Generator) refusePath(path, name string) bool {
+	if !g.options.Safe || assets.WithinDir(g.options.BasePath, path) {
+		return false
+	}
+	g.addDiagnostic(parserPkg.SeverityError, "cannot read %s: safe mode only allows files in the presentation's directory", name)
+	return true
+}
+
+// processImages converts local image paths to base64 data URIs, or to
+// assets in directory output, optimizing the images if requested
 func (g *Generator) processImages(html string) string {
-	if g.options.BasePath == "" {
+	baseDir := g.imageDir()
+	if baseDir == "" {
 		return html
 	}
 
@@ -237,23 +570,32 @@ func (g *Generator) processImages(html string) string {
 			return match
 		}
 
-		// Try to read and encode the image
-		imagePath := filepath.Join(g.options.BasePath, src)
+		// Try to read and encode the image. The renderer percent-encodes
+		// characters such as spaces in the path.
+		if unescaped, err := url.PathUnescape(src); err == nil {
+			src = unescaped
+		}
+		imagePath := filepath.Join(baseDir, src)
+		if g.refusePath(imagePath, src) {
+			return match
+		}
+		g.addDependency(imagePath)
 		data, err := os.ReadFile(imagePath)
 		if err != nil {
 			// If file doesn't exist, return original
 			return match
 		}
 
-		// Detect content type
-		contentType := detectContentType(imagePath)
-
-		// Encode to base64
-		encoded := base64.StdEncoding.EncodeToString(data)
-		dataURI := fmt.Sprintf("data:%s;base64,%s", contentType, encoded)
-
-		// Replace src
-		return srcRegex.ReplaceAllString(match, fmt.Sprintf(`src="%s"`, dataURI))
+		// Replace src, listing smaller variants of large images
+		optimized := g.optimizeImage(imagePath, data)
+		url := g.embedURL(imagePath, optimized.data)
+		attrs := fmt.Sprintf(`src="%s"`, escapeAttr(url))
+		if g.options.ImageVariants && strings.HasPrefix(url, assetsDir+"/") {
+			if srcset := g.imageSrcset(imagePath, optimized, url); srcset != "" {
+				attrs += fmt.Sprintf(` srcset="%s"`, escapeAttr(srcset))
+			}
+		}
+		return srcRegex.ReplaceAllLiteralString(match, attrs)
 	})
 }
 
@@ -296,9 +638,36 @@ func layoutToGridStyle(layout string) string {
 	case "grid-2x3":
 		return "grid-template-columns: repeat(2, 1fr); grid-template-rows: repeat(3, 1fr);"
 	default:
-		// Allow custom grid styles
-		return layout
+		// Custom layouts are CSS grid declarations; anything else gets the
+		// default grid, the parser having reported it
+		declarations, err := parserPkg.GridDeclarations(layout)
+		if err != nil {
+			return ""
+		}
+		return joinDeclarations(declarations)
+	}
+}
+
+// cssStyle returns the declarations of a body-style in normalized form, or
+// an empty string if it is not valid CSS declarations
+func cssStyle(style string) string {
+	if style == "" {
+		return ""
 	}
+	declarations, err := parserPkg.ParseDeclarations(style)
+	if err != nil {
+		return ""
+	}
+	return joinDeclarations(declarations)
+}
+
+// joinDeclarations formats CSS declarations for a style attribute
+func joinDeclarations(declarations []parserPkg.Declaration) string {
+	styles := make([]string, len(declarations))
+	for i, d := range declarations {
+		styles[i] = d.String()
+	}
+	return strings.Join(styles, " ")
 }
 
 // splitContentForLayout splits content into parts for layout
@@ -341,8 +710,9 @@ func escapeHTML(s string) string {
 	return s
 }
 
-// escapeAttr escapes HTML attribute values
+// escapeAttr escapes HTML attribute values. Values need the same escaping
+// as text, so that they are safe in single- and double-quoted attributes
+// and ampersands are not read as character references.
 func escapeAttr(s string) string {
-	s = strings.ReplaceAll(s, "\"", "&quot;")
-	return s
+	return escapeHTML(s)
 }
@@ -1,9 +1,27 @@
 package generator
 
 import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
+	"gobig/internal/assets"
 	"gobig/internal/parser"
 )
 
@@ -160,6 +178,63 @@ func TestGenerateWithSlideMetadata(t *testing.T) {
 	}
 }
 
+func TestGenerateEscapesMetadata(t *testing.T) {
+	gen := NewGenerator(Options{})
+
+	html, err := gen.Generate([]*parser.Slide{
+		{
+			Content: "# Escaped",
+			Metadata: parser.SlideMetadata{
+				Layout:    `grid-template-areas: "a b"; gap: 1em`,
+				BodyStyle: "font-family: 'A&B', serif",
+				BodyClass: `intro' onmouseover='alert(1)`,
+			},
+		},
+		{
+			Content: "# Dropped",
+			Metadata: parser.SlideMetadata{
+				Layout:    `grid-template-columns: 1fr"><script>alert(2)</script>`,
+				BodyStyle: "color: red } body { color: blue",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	for _, want := range []string{
+		`<div class="layout" style="grid-template-areas: &quot;a b&quot;; gap: 1em;">`,
+		`data-body-style="font-family: &#39;A&amp;B&#39;, serif;"`,
+		`data-body-class="intro&#39; onmouseover=&#39;alert(1)"`,
+		`<div class="layout">`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Generated HTML should contain %s", want)
+		}
+	}
+	if strings.Contains(html, "alert(2)") || strings.Contains(html, "color: blue") {
+		t.Error("Invalid layouts and body styles should be dropped")
+	}
+}
+
+func TestLayoutToGridStyle(t *testing.T) {
+	tests := []struct {
+		layout string
+		want   string
+	}{
+		{"50-50", "grid-template-columns: 50% 50%;"},
+		{"Grid-Template-Columns: 1fr 2fr", "grid-template-columns: 1fr 2fr;"},
+		{"grid-template-rows: 1fr 1fr;  gap: 2em;", "grid-template-rows: 1fr 1fr; gap: 2em;"},
+		{"50-05", ""},
+		{"position: fixed", ""},
+	}
+	for _, tt := range tests {
+		if got := layoutToGridStyle(tt.layout); got != tt.want {
+			t.Errorf("layoutToGridStyle(%q) = %q, want %q", tt.layout, got, tt.want)
+		}
+	}
+}
+
 func TestGenerateWithNotes(t *testing.T) {
 	opts := Options{
 		Theme: "dark",
@@ -186,6 +261,36 @@ func TestGenerateWithNotes(t *testing.T) {
 	}
 }
 
+func TestGenerateMarkdownNotes(t *testing.T) {
+	slides := []*parser.Slide{
+		{
+			Content: "# Slide",
+			Notes:   "- **Pause** here\n- See [docs](https://example.com)",
+		},
+	}
+
+	html, err := NewGenerator(Options{Theme: "dark"}).Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	if !strings.Contains(html, "<notes><ul>\n<li><strong>Pause</strong> here</li>") {
+		t.Error("Speaker notes should be rendered as Markdown")
+	}
+	if !strings.Contains(html, `<a href="https://example.com">docs</a>`) {
+		t.Error("Speaker notes should render links")
+	}
+
+	html, err = NewGenerator(Options{Theme: "dark", PlainNotes: true}).Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	if !strings.Contains(html, "<notes>- **Pause** here\n- See [docs](https://example.com)</notes>") {
+		t.Error("PlainNotes should keep speaker notes as plain text")
+	}
+}
+
 func TestGenerateWithAutoAdvance(t *testing.T) {
 	opts := Options{
 		Theme: "dark",
@@ -214,6 +319,48 @@ func TestGenerateWithAutoAdvance(t *testing.T) {
 	}
 }
 
+func TestGeneratePresenter(t *testing.T) {
+	slides := []*parser.Slide{
+		{Content: "# Slide", Notes: "Remember the demo"},
+	}
+
+	html, err := NewGenerator(Options{Theme: "dark"}).Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if strings.Contains(html, "GOBIG_PRESENTER_DURATION") {
+		t.Error("Presenter view should be off by default")
+	}
+
+	html, err = NewGenerator(Options{Theme: "dark", Presenter: true}).Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if !strings.Contains(html, "GOBIG_PRESENTER_DURATION = 0;") {
+		t.Error("Presenter option should include the presenter view")
+	}
+
+	opts := Options{
+		Theme: "dark",
+		PresentationMetadata: parser.PresentationMetadata{
+			Presenter: true,
+			Duration:  20,
+		},
+	}
+	html, err = NewGenerator(opts).Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if !strings.Contains(html, "GOBIG_PRESENTER_DURATION = 1200;") {
+		t.Error("Presentation metadata should enable the presenter view with its duration")
+	}
+
+	// The presenter script must be loaded after big.js in the head
+	if strings.Index(html, "GOBIG_PRESENTER_DURATION") < strings.Index(html, "ASPECT_RATIO") {
+		t.Error("Presenter view should be loaded after big.js")
+	}
+}
+
 func TestGenerateEmptySlides(t *testing.T) {
 	opts := Options{
 		Theme: "dark",
@@ -258,3 +405,1370 @@ func TestGenerateWithAspectRatioFalse(t *testing.T) {
 		t.Error("Generated HTML should handle aspect ratio false")
 	}
 }
+
+func TestGenerateDependencies(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "logo.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator(Options{Theme: "dark", BasePath: dir})
+
+	slides := []*parser.Slide{
+		{Content: "![logo](logo.png)\n\n![missing](missing.png)\n\n![remote](https://example.com/a.png)"},
+		{Content: "![logo again](logo.png)"},
+	}
+
+	if _, err := gen.Generate(slides); err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	want := []string{filepath.Join(dir, "logo.png"), filepath.Join(dir, "missing.png")}
+	got := gen.Dependencies()
+	if len(got) != len(want) {
+		t.Fatalf("Dependencies() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Dependencies()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestGenerateDirectory(t *testing.T) {
+	dir := t.TempDir()
+	photo := []byte("a photo larger than the limit")
+	if err := os.WriteFile(filepath.Join(dir, "small.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "My Photo.JPG"), photo, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator(Options{Theme: "dark", BasePath: dir, Directory: true, InlineLimit: 10})
+	html, err := gen.Generate([]*parser.Slide{
+		{Content: "![small](small.png)\n\n![photo](My%20Photo.JPG)"},
+		{Content: "![photo again](My%20Photo.JPG)"},
+	})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	sum := sha256.Sum256(photo)
+	photoPath := "assets/My-Photo-" + hex.EncodeToString(sum[:6]) + ".jpg"
+
+	var paths []string
+	for _, asset := range gen.Assets() {
+		paths = append(paths, asset.Path)
+		if !strings.Contains(html, `"`+asset.Path+`"`) {
+			t.Errorf("Asset %s is not referenced:\n%s", asset.Path, html)
+		}
+	}
+	if len(paths) != 4 || paths[0] != photoPath || !strings.HasPrefix(paths[1], "assets/big-") ||
+		!strings.HasSuffix(paths[1], ".css") || !strings.HasPrefix(paths[2], "assets/theme-") || !strings.HasSuffix(paths[3], ".js") {
+		t.Errorf("Expected the photo, big.css, theme CSS and big.js as assets, got %v", paths)
+	}
+	if got := strings.Count(html, `src="`+photoPath+`"`); got != 2 {
+		t.Errorf("Expected the photo referenced twice as %s, got %d", photoPath, got)
+	}
+	if !strings.Contains(html, "data:image/png;base64,cG5n") {
+		t.Error("Images within the inline limit should stay inline")
+	}
+	if strings.Contains(html, "<style>") || strings.Contains(html, "<script>\n") {
+		t.Error("CSS and JS should not be inlined in directory output")
+	}
+
+	// Single-file output inlines everything
+	gen = NewGenerator(Options{Theme: "dark", BasePath: dir, InlineLimit: 10})
+	html, err = gen.Generate([]*parser.Slide{{Content: "![photo](My%20Photo.JPG)"}})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if len(gen.Assets()) != 0 || !strings.Contains(html, "data:image/jpeg;base64,") {
+		t.Error("Single-file output should not have assets")
+	}
+}
+
+func TestGenerateCSP(t *testing.T) {
+	slides := []*parser.Slide{{Content: "# CSP\n\n<script>alert(1)</script>"}}
+
+	html, err := NewGenerator(Options{CSP: true, AspectRatio: "2", Presenter: true}).Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	policy := regexp.MustCompile(`<meta http-equiv="Content-Security-Policy" content="([^"]+)">`).FindStringSubmatch(html)
+	if policy == nil {
+		t.Fatalf("Missing Content-Security-Policy meta element:\n%s", html[:500])
+	}
+	if strings.Index(html, policy[0]) > strings.Index(html, "<style>") {
+		t.Error("The policy must come before the elements it covers")
+	}
+	content := policy[1]
+
+	// Every inline element of the head is allowed by its hash, and nothing
+	// else is
+	head := html[:strings.Index(html, "</head>\n<body class=")]
+	elements := regexp.MustCompile(`(?s)<(script|style)>(.*?)</(?:script|style)>`).FindAllStringSubmatch(head, -1)
+	if len(elements) != 6 {
+		t.Fatalf("Expected 6 inline elements, got %d", len(elements))
+	}
+	for _, element := range elements {
+		sum := sha256.Sum256([]byte(element[2]))
+		hash := "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+		if !strings.Contains(content, hash) {
+			t.Errorf("Policy does not allow the <%s> element %.40q", element[1], element[2])
+		}
+	}
+	sum := sha256.Sum256([]byte("alert(1)"))
+	if got := strings.Count(content, "'sha256-"); got != 6 || strings.Contains(content, base64.StdEncoding.EncodeToString(sum[:])) {
+		t.Errorf("Only the generator's own elements should be allowed, got %d hashes", got)
+	}
+	for _, want := range []string{"default-src 'none'", "style-src-attr 'unsafe-inline'", "base-uri 'none'"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Policy should contain %q: %s", want, content)
+		}
+	}
+
+	// Directory output allows its own assets and checks their integrity
+	gen := NewGenerator(Options{CSP: true, Directory: true})
+	html, err = gen.Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if !strings.Contains(html, "script-src 'self'") || !strings.Contains(html, "style-src 'self'") {
+		t.Error("Directory output should allow assets from its own origin")
+	}
+	for _, asset := range gen.Assets() {
+		sum := sha512.Sum384(asset.Data)
+		if !strings.Contains(html, asset.Path+`" integrity="sha384-`+base64.StdEncoding.EncodeToString(sum[:])+`"`) {
+			t.Errorf("Missing integrity attribute for %s", asset.Path)
+		}
+	}
+
+	html, err = NewGenerator(Options{}).Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if strings.Contains(html, "Content-Security-Policy") || strings.Contains(html, "integrity=") {
+		t.Error("The policy should be off by default")
+	}
+}
+
+func TestOptimizeImages(t *testing.T) {
+	dir := t.TempDir()
+
+	// A landscape photo, red on the left and blue on the right, that the
+	// camera marks as needing a turn to the right, with a location
+	photo := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 200 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			photo.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, photo, nil); err != nil {
+		t.Fatal(err)
+	}
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00GPS 52.37N")
+	exif := append([]byte("Exif\x00\x00"), tiff...)
+	segment := append([]byte{0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	jpegData := append(append([]byte{0xFF, 0xD8}, segment...), buf.Bytes()[2:]...)
+	if err := os.WriteFile(filepath.Join(dir, "photo.jpg"), jpegData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A small PNG with a text chunk
+	buf.Reset()
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	text := []byte("tEXtAuthor\x00Jane")
+	chunk := append([]byte{0, 0, 0, byte(len(text) - 4)}, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(text))
+	pngData := append(append(append([]byte{}, buf.Bytes()[:33]...), chunk...), buf.Bytes()[33:]...)
+	if err := os.WriteFile(filepath.Join(dir, "icon.png"), pngData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator(Options{BasePath: dir, OptimizeImages: true, ImageWidth: 320})
+	html, err := gen.Generate([]*parser.Slide{{Content: "![photo](photo.jpg)\n\n![icon](icon.png)"}})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if len(gen.Diagnostics()) != 0 {
+		t.Errorf("Unexpected diagnostics: %v", gen.Diagnostics())
+	}
+
+	optimized := gen.images[filepath.Join(dir, "photo.jpg")].data
+	if bytes.Contains(optimized, []byte("Exif")) || bytes.Contains(optimized, []byte("GPS")) {
+		t.Error("Optimized photos should not keep their EXIF data")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(optimized))
+	if err != nil {
+		t.Fatalf("Optimized photo is not a JPEG: %v", err)
+	}
+	// Upright it is 200×400, scaled to fit 320×200
+	if got := img.Bounds().Size(); got != image.Pt(100, 200) {
+		t.Errorf("Optimized photo size = %v, want (100,200)", got)
+	}
+	if r, _, b, _ := img.At(50, 20).RGBA(); r < b {
+		t.Error("The left of the photo should be at the top once upright")
+	}
+	if r, _, b, _ := img.At(50, 180).RGBA(); b < r {
+		t.Error("The right of the photo should be at the bottom once upright")
+	}
+	if !strings.Contains(html, "data:image/jpeg;base64,"+base64.StdEncoding.EncodeToString(optimized)) {
+		t.Error("The optimized photo should be embedded")
+	}
+
+	icon := gen.images[filepath.Join(dir, "icon.png")].data
+	if bytes.Contains(icon, []byte("tEXt")) {
+		t.Error("Optimized PNG images should not keep text chunks")
+	}
+	if _, err := png.Decode(bytes.NewReader(icon)); err != nil {
+		t.Errorf("Optimized icon is not a PNG: %v", err)
+	}
+
+	// Out of range options are errors
+	gen = NewGenerator(Options{OptimizeImages: true, ImageQuality: 101})
+	if _, err := gen.Generate(nil); err == nil {
+		t.Error("An image quality above 100 should be an error")
+	}
+}
+
+func TestGenerateImageVariants(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1280, 800)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "wide.jpg"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator(Options{BasePath: dir, Directory: true, OptimizeImages: true, ImageVariants: true})
+	html, err := gen.Generate([]*parser.Slide{{Content: "![wide](wide.jpg)"}})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	m := regexp.MustCompile(`src="(assets/wide-[0-9a-f]+\.jpg)" srcset="([^"]+)"`).FindStringSubmatch(html)
+	if m == nil {
+		t.Fatalf("Image should have a srcset:\n%s", html)
+	}
+	candidates := strings.Split(m[2], ", ")
+	if len(candidates) != 3 || candidates[0] != m[1]+" 1280w" ||
+		!strings.HasPrefix(candidates[1], "assets/wide-640w-") || !strings.HasSuffix(candidates[2], " 320w") {
+		t.Errorf("Unexpected srcset %q", m[2])
+	}
+
+	assetData := map[string][]byte{}
+	for _, asset := range gen.Assets() {
+		assetData[asset.Path] = asset.Data
+	}
+	variant := strings.Fields(candidates[1])[0]
+	config, err := jpeg.DecodeConfig(bytes.NewReader(assetData[variant]))
+	if err != nil || config.Width != 640 || config.Height != 400 {
+		t.Errorf("Variant %s should be a 640×400 JPEG, got %+v, %v", variant, config, err)
+	}
+}
+
+func TestGenerateBuildItems(t *testing.T) {
+	gen := NewGenerator(Options{Theme: "dark"})
+
+	slides := []*parser.Slide{
+		{
+			Content:  "# Agenda\n\n- One\n- Two\n- Three",
+			Notes:    "Take it slow",
+			Metadata: parser.SlideMetadata{Build: parser.BuildItems, TimeToNext: 8},
+		},
+	}
+
+	html := gen.generateSlides(slides)
+
+	// Heading alone, then one more item per step
+	if got := strings.Count(html, "<h1"); got != 4 {
+		t.Fatalf("Expected 4 build steps, got %d:\n%s", got, html)
+	}
+	if got := strings.Count(html, `<li style="visibility: hidden">`); got != 3+2+1 {
+		t.Errorf("Expected 6 hidden items across all steps, got %d", got)
+	}
+	if got := strings.Count(html, "<notes>"); got != 4 {
+		t.Errorf("Expected notes on every step, got %d", got)
+	}
+	if got := strings.Count(html, `data-time-to-next="2"`); got != 4 {
+		t.Errorf("Expected time-to-next spread across steps, got %d", got)
+	}
+	if got := strings.Count(html, `id="agenda"`); got != 1 {
+		t.Errorf("Expected the heading id on the first step only, got %d", got)
+	}
+}
+
+func TestGenerateBuildBlocks(t *testing.T) {
+	gen := NewGenerator(Options{Theme: "dark"})
+
+	slides := []*parser.Slide{
+		{
+			Content:  "First point\n\n```go\nfmt.Println()\n```",
+			Metadata: parser.SlideMetadata{Build: parser.BuildBlocks},
+		},
+	}
+
+	html := gen.generateSlides(slides)
+
+	// No static content, so the first step already shows the first block
+	if got := strings.Count(html, "<p>First point</p>"); got != 2 {
+		t.Fatalf("Expected 2 build steps with the paragraph visible, got %d:\n%s", got, html)
+	}
+	if !strings.Contains(html, "<div style=\"visibility: hidden\">\n<pre") {
+		t.Error("Code block should be wrapped and hidden in the first step")
+	}
+	if !strings.Contains(html, "<div>\n<pre") {
+		t.Error("Code block should keep its wrapper when revealed")
+	}
+}
+
+func TestGenerateBuildCells(t *testing.T) {
+	gen := NewGenerator(Options{Theme: "dark"})
+
+	slides := []*parser.Slide{
+		{
+			Content:  "Left\n\nRight",
+			Metadata: parser.SlideMetadata{Layout: "50-50", Build: parser.BuildCells},
+		},
+	}
+
+	html := gen.generateSlides(slides)
+
+	if got := strings.Count(html, `class="layout"`); got != 2 {
+		t.Fatalf("Expected 2 build steps, got %d", got)
+	}
+	if !strings.Contains(html, `<p>Left</p>
+      <p style="visibility: hidden">Right</p>`) {
+		t.Errorf("First step should hide the second cell:\n%s", html)
+	}
+}
+
+func TestGenerateWithoutBuild(t *testing.T) {
+	gen := NewGenerator(Options{Theme: "dark"})
+
+	slides := []*parser.Slide{
+		{Content: "- One\n- Two", Metadata: parser.SlideMetadata{TimeToNext: 5}},
+	}
+
+	html := gen.generateSlides(slides)
+
+	if strings.Contains(html, "visibility") {
+		t.Error("Slides without a build should not hide anything")
+	}
+	if !strings.Contains(html, `data-time-to-next="5"`) {
+		t.Error("Slides without a build should keep their time-to-next")
+	}
+}
+
+func TestGenerateImagesRelativeToSlideFile(t *testing.T) {
+	dir := t.TempDir()
+	moduleDir := filepath.Join(dir, "modules")
+	if err := os.MkdirAll(moduleDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(moduleDir, "chart.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator(Options{Theme: "dark", BasePath: dir})
+
+	slides := []*parser.Slide{
+		{Content: "![chart](chart.png)", File: filepath.Join(moduleDir, "intro.md")},
+	}
+
+	html, err := gen.Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	if !strings.Contains(html, "data:image/png;base64,cG5n") {
+		t.Error("Image should be resolved relative to the slide's source file")
+	}
+}
+
+func TestGenerateCustomTheme(t *testing.T) {
+	dir := t.TempDir()
+	themeDir := filepath.Join(dir, "themes", "acme")
+	if err := os.MkdirAll(themeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	themeFile := filepath.Join(themeDir, "theme.css")
+	if err := os.WriteFile(themeFile, []byte("body { background: #acme01; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator(Options{Theme: "acme", ThemePaths: []string{filepath.Join(dir, "themes")}})
+
+	html, err := gen.Generate([]*parser.Slide{{Content: "# Hello"}})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	if !strings.Contains(html, "#acme01") {
+		t.Error("Custom theme CSS should be inlined")
+	}
+	if !strings.Contains(html, `<body class="acme">`) {
+		t.Error("Body should have the custom theme class")
+	}
+	if deps := gen.Dependencies(); len(deps) != 1 || deps[0] != themeFile {
+		t.Errorf("Dependencies() = %v, want [%s]", deps, themeFile)
+	}
+
+	gen = NewGenerator(Options{Theme: "unknown"})
+	if _, err := gen.Generate([]*parser.Slide{{Content: "# Hello"}}); err == nil {
+		t.Error("Generate() should fail for an unknown theme")
+	}
+}
+
+func TestGenerateFonts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "brand.woff2"), []byte("woff2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator(Options{
+		Theme:    "dark",
+		BasePath: dir,
+		PresentationMetadata: parser.PresentationMetadata{
+			Fonts: []parser.Font{
+				{Family: `Brand "Sans"`, Src: "brand.woff2", Weight: "100 900", Style: "italic"},
+			},
+		},
+	})
+
+	html, err := gen.Generate([]*parser.Slide{{Content: "# Hello"}})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	for _, want := range []string{
+		`font-family: "Brand \22 Sans\22 ";`,
+		`src: url("data:font/woff2;base64,d29mZjI=");`,
+		"font-weight: 100 900;",
+		"font-style: italic;",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Output should contain %q", want)
+		}
+	}
+	if deps := gen.Dependencies(); len(deps) != 1 || deps[0] != filepath.Join(dir, "brand.woff2") {
+		t.Errorf("Dependencies() = %v, want the font file", deps)
+	}
+}
+
+func TestGenerateFontProblems(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "brand.woff2"), []byte("woff2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A font that cannot be subset is embedded whole with a warning
+	gen := NewGenerator(Options{
+		Theme:       "dark",
+		BasePath:    dir,
+		SubsetFonts: true,
+		PresentationMetadata: parser.PresentationMetadata{
+			Fonts: []parser.Font{{Family: "Brand", Src: "brand.woff2"}},
+		},
+	})
+	html, err := gen.Generate([]*parser.Slide{{Content: "# Hello", File: "talk.md"}})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if !strings.Contains(html, "data:font/woff2;base64,d29mZjI=") {
+		t.Error("Font should be embedded without subsetting")
+	}
+	if diags := gen.Diagnostics(); len(diags) != 1 || diags[0].Severity != parser.SeverityWarning || diags[0].File != "talk.md" {
+		t.Errorf("Diagnostics() = %v, want one warning for talk.md", diags)
+	}
+
+	// A missing font fails the build
+	gen = NewGenerator(Options{
+		Theme:    "dark",
+		BasePath: dir,
+		PresentationMetadata: parser.PresentationMetadata{
+			Fonts: []parser.Font{{Family: "Brand", Src: "missing.ttf"}},
+		},
+	})
+	if _, err := gen.Generate([]*parser.Slide{{Content: "# Hello"}}); err == nil {
+		t.Error("Generate() should fail for a missing font")
+	}
+	if diags := gen.Diagnostics(); len(diags) != 1 || !strings.Contains(diags[0].Message, "missing.ttf") {
+		t.Errorf("Diagnostics() = %v, want an error naming the font", diags)
+	}
+}
+
+func TestGenerateHighlighting(t *testing.T) {
+	gen := NewGenerator(Options{Theme: "light"})
+
+	html, err := gen.Generate([]*parser.Slide{
+		{Content: "```go {2} showLineNumbers\npackage main\nfunc main() {}\n```"},
+	})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	if !strings.Contains(html, `<pre class="chroma">`) {
+		t.Error("Code block should be highlighted")
+	}
+	if !strings.Contains(html, `<span class="kn">package</span>`) {
+		t.Error("Keywords should be marked")
+	}
+	if !strings.Contains(html, `<span class="line hl"><span class="ln">2</span>`) {
+		t.Error("Line 2 should be highlighted and numbered")
+	}
+	if strings.Contains(html, `<span class="line hl"><span class="ln">1</span>`) {
+		t.Error("Line 1 should not be highlighted")
+	}
+	// The github style matches the light theme
+	if !strings.Contains(html, ".chroma { background-color: #ffffff; }") {
+		t.Error("Output should include the github style CSS")
+	}
+	if strings.Contains(html, "\n.bg ") {
+		t.Error("The standalone .bg rule should be dropped")
+	}
+}
+
+func TestGenerateHighlightingOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		code  string
+		want  string
+		style bool
+	}{
+		{"no language", Options{}, "```\nplain <text>\n```", "<pre><code>plain &lt;text&gt;\n</code></pre>", false},
+		{"disabled", Options{HighlightStyle: "none"}, "```go {1}\nx := 1\n```", `<pre><code class="language-go">x := 1`, false},
+		{"metadata line numbers", Options{PresentationMetadata: parser.PresentationMetadata{LineNumbers: true}}, "```go\nx := 1\n```", `<span class="ln">1</span>`, true},
+		{"ranges without space", Options{}, "```go{1}\nx := 1\n```", `<span class="line hl">`, true},
+		{"unknown language", Options{}, "```nosuchlang\nx\n```", `<pre class="chroma">`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := NewGenerator(tt.opts)
+			html, err := gen.Generate([]*parser.Slide{{Content: tt.code}})
+			if err != nil {
+				t.Fatalf("Generate() failed: %v", err)
+			}
+			if !strings.Contains(html, tt.want) {
+				t.Errorf("Output should contain %q", tt.want)
+			}
+			if got := strings.Contains(html, ".chroma {"); got != tt.style {
+				t.Errorf("Style CSS included = %v, want %v", got, tt.style)
+			}
+		})
+	}
+}
+
+func TestGenerateHighlightingProblems(t *testing.T) {
+	gen := NewGenerator(Options{})
+	_, err := gen.Generate([]*parser.Slide{
+		{Content: "```go {0,2-1,5,1}\nx := 1\n```", File: "talk.md", StartLine: 7},
+	})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	diags := gen.Diagnostics()
+	if len(diags) != 3 {
+		t.Fatalf("Expected 3 diagnostics, got %d: %v", len(diags), diags)
+	}
+	if diags[0].String() != `talk.md:7: warning: invalid line range "0" in code block` {
+		t.Errorf("Unexpected diagnostic: %s", diags[0])
+	}
+	if !strings.Contains(diags[2].Message, "outside the code block") {
+		t.Errorf("Unexpected diagnostic: %s", diags[2])
+	}
+
+	gen = NewGenerator(Options{HighlightStyle: "nosuchstyle"})
+	if _, err := gen.Generate([]*parser.Slide{{Content: "# Hello"}}); err == nil {
+		t.Error("Generate() should fail for an unknown highlight style")
+	}
+}
+
+func TestGenerateCodeSteps(t *testing.T) {
+	gen := NewGenerator(Options{})
+
+	slides := []*parser.Slide{
+		{
+			Content:  "```go {1|2-3|}\na := 1\nb := 2\nc := 3\n```",
+			Notes:    "Walk through the code",
+			Metadata: parser.SlideMetadata{TimeToNext: 6},
+		},
+	}
+
+	html := gen.generateSlides(slides)
+
+	if got := strings.Count(html, `<div data-time-to-next="2">`); got != 3 {
+		t.Fatalf("Expected 3 steps sharing the slide's time, got %d:\n%s", got, html)
+	}
+	if got := strings.Count(html, "<notes><p>Walk through the code</p></notes>"); got != 3 {
+		t.Errorf("Expected the notes on every step, got %d", got)
+	}
+
+	steps := strings.Split(html, "</div>")[:3]
+	wantHighlighted := []int{1, 2, 0}
+	for i, step := range steps {
+		if got := strings.Count(step, `class="line hl"`); got != wantHighlighted[i] {
+			t.Errorf("Step %d: expected %d highlighted lines, got %d", i+1, wantHighlighted[i], got)
+		}
+	}
+	if !strings.Contains(steps[0], `<span class="line hl"><span class="cl"><span class="nx">a</span>`) {
+		t.Error("First step should highlight line 1")
+	}
+}
+
+func TestGenerateCodeStepsAfterBuild(t *testing.T) {
+	gen := NewGenerator(Options{})
+
+	slides := []*parser.Slide{
+		{
+			Content:  "- One\n- Two\n\n```go {1|2}\na := 1\nb := 2\n```",
+			Metadata: parser.SlideMetadata{Build: parser.BuildItems},
+		},
+	}
+
+	html := gen.generateSlides(slides)
+	steps := strings.Split(strings.TrimSpace(html), "\n  </div>")
+	steps = steps[:len(steps)-1]
+
+	// Three build steps (code counts as static content), then one code step
+	if len(steps) != 4 {
+		t.Fatalf("Expected 4 steps, got %d:\n%s", len(steps), html)
+	}
+	if strings.Contains(steps[3], hiddenStyle) {
+		t.Error("Code steps should reveal every build element")
+	}
+	if !strings.Contains(steps[2], `<span class="line hl"><span class="cl"><span class="nx">a</span>`) {
+		t.Error("Build steps should highlight the first group")
+	}
+	last := steps[3]
+	if hl := strings.Index(last, "line hl"); hl < strings.Index(last, `"nx">a<`) || hl > strings.Index(last, `"nx">b<`) {
+		t.Error("The code step should highlight the second group")
+	}
+}
+
+func TestGenerateMath(t *testing.T) {
+	gen := NewGenerator(Options{})
+
+	html := gen.markdownToHTML("Euler: $e^{i\\pi}+1=0$ costs $5 or $10\n\n$$\n\\sum_{i=1}^n i\n$$\n\n$$x_1$$\n\nA \\$ sign and `$code$`")
+
+	if !strings.Contains(html, `<math xmlns="http://www.w3.org/1998/Math/MathML" display="inline"><semantics><mrow><msup><mi>e</mi>`) {
+		t.Errorf("Inline math should be rendered as MathML:\n%s", html)
+	}
+	if !strings.Contains(html, "costs $5 or $10") {
+		t.Errorf("Prices should stay text:\n%s", html)
+	}
+	if !strings.Contains(html, `display="block"><semantics><mrow><munderover><mo>∑</mo>`) {
+		t.Errorf("Display math should be rendered as block MathML:\n%s", html)
+	}
+	if !strings.Contains(html, `display="block"><semantics><msub><mi>x</mi><mn>1</mn></msub>`) {
+		t.Errorf("Single line display math should be rendered:\n%s", html)
+	}
+	if !strings.Contains(html, "A $ sign and <code>$code$</code>") {
+		t.Errorf("Escaped dollars and code spans should not be math:\n%s", html)
+	}
+	if len(gen.Diagnostics()) != 0 {
+		t.Errorf("Unexpected diagnostics: %v", gen.Diagnostics())
+	}
+}
+
+func TestGenerateMathProblems(t *testing.T) {
+	slides := []*parser.Slide{
+		{Content: "# Math"},
+		{Content: "# Invalid\n\n$\\frac{a}{b$ and $\\nosuch$", File: "talk.md", StartLine: 4, ContentLine: 5},
+		{Content: "$$\nx + y", File: "talk.md", StartLine: 9, ContentLine: 9},
+		{Content: "$\\href{x}{y}$", File: "talk.md", StartLine: 12},
+	}
+
+	gen := NewGenerator(Options{})
+	output, err := gen.Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() should only warn about invalid math: %v", err)
+	}
+	if !strings.Contains(output, `<code class="math-error">$\href{x}{y}$</code>`) {
+		t.Error("Invalid math should be shown as its source")
+	}
+
+	diags := gen.Diagnostics()
+	if len(diags) != 4 {
+		t.Fatalf("Expected 4 diagnostics, got %d: %v", len(diags), diags)
+	}
+	if diags[0].String() != `talk.md:7: warning: invalid math "\\frac{a}{b": missing }` {
+		t.Errorf("Unexpected diagnostic: %s", diags[0])
+	}
+	if !strings.Contains(diags[1].Message, `unknown command \nosuch`) {
+		t.Errorf("Unexpected diagnostic: %s", diags[1])
+	}
+	if diags[2].String() != "talk.md:9: warning: display math is missing its closing $$" {
+		t.Errorf("Unexpected diagnostic: %s", diags[2])
+	}
+	if diags[3].Line != 12 {
+		t.Errorf("Diagnostic without a content line should point at the slide: %s", diags[3])
+	}
+
+	gen = NewGenerator(Options{Strict: true})
+	if _, err := gen.Generate(slides); err == nil {
+		t.Error("Generate() should fail for invalid math in strict mode")
+	}
+}
+
+func TestGenerateDiagrams(t *testing.T) {
+	gen := NewGenerator(Options{Theme: "light"})
+	output, err := gen.Generate([]*parser.Slide{
+		{Content: "# Pipeline\n\n```dot\ndigraph { build -> test -> ship }\n```"},
+		{Content: "```sequence\nAlice->Bob: Hello\n```"},
+	})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	if got := strings.Count(output, `<svg class="diagram"`); got != 2 {
+		t.Errorf("Expected 2 diagrams, got %d", got)
+	}
+	if strings.Contains(output, `class="language-dot"`) {
+		t.Error("Diagram blocks should not be rendered as code")
+	}
+	if !strings.Contains(output, ".diagram .node {") {
+		t.Error("Expected the diagram stylesheet")
+	}
+
+	output, err = gen.Generate([]*parser.Slide{{Content: "# No diagrams"}})
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if strings.Contains(output, ".diagram .node {") {
+		t.Error("The diagram stylesheet should only be included when needed")
+	}
+}
+
+func TestGenerateDiagramProblems(t *testing.T) {
+	slides := []*parser.Slide{
+		{Content: "```flowchart\nA --> B\nA ~~> C\n```", File: "talk.md", StartLine: 12, ContentLine: 12},
+	}
+
+	gen := NewGenerator(Options{})
+	if _, err := gen.Generate(slides); err != nil {
+		t.Fatalf("Generate() should only warn about an invalid diagram: %v", err)
+	}
+	diags := gen.Diagnostics()
+	if len(diags) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %d: %v", len(diags), diags)
+	}
+	if !strings.HasPrefix(diags[0].String(), "talk.md:13: warning: failed to render flowchart diagram: line 2: expected a link") {
+		t.Errorf("Unexpected diagnostic: %s", diags[0])
+	}
+
+	gen = NewGenerator(Options{Strict: true})
+	if _, err := gen.Generate(slides); err == nil {
+		t.Fatal("Generate() should fail for an invalid diagram with Strict")
+	}
+	if diags := gen.Diagnostics(); len(diags) != 1 || diags[0].Severity != parser.SeverityError {
+		t.Errorf("Expected 1 error, got %v", diags)
+	}
+	html := gen.markdownToHTML("```flowchart\nA ~~> C\n```")
+	if !strings.Contains(html, `<pre><code class="language-flowchart">A ~~&gt; C`) {
+		t.Error("An invalid diagram should be shown as code")
+	}
+}
+
+func TestGeneratePDF(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	imagePath := filepath.Join(dir, "chart.png")
+	if err := os.WriteFile(imagePath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator(Options{Theme: "dark", BasePath: dir, NotesPages: true, Title: "Quarterly"})
+	output, err := gen.GeneratePDF([]*parser.Slide{
+		{Content: "# Results\n\n- **Revenue** up\n- *Costs* down\n  1. Travel\n\n```go\nfmt.Println(\"hi\")\n```"},
+		{Content: "![chart](chart.png)\n\nGrowth", Metadata: parser.SlideMetadata{Layout: "50-50"}, Notes: "Mention the *outlier*"},
+		{Content: "| a | b |\n|---|---|\n| 1 | 2 |\n\n> Quote"},
+	})
+	if err != nil {
+		t.Fatalf("GeneratePDF() failed: %v (%v)", err, gen.Diagnostics())
+	}
+
+	pdf := string(output)
+	if !strings.HasPrefix(pdf, "%PDF-") {
+		t.Fatal("Output is not a PDF")
+	}
+	if got := strings.Count(pdf, "<</Type /Page\n"); got != 4 {
+		t.Errorf("Expected 3 slide pages and 1 notes page, got %d", got)
+	}
+	if !strings.Contains(pdf, "/MediaBox [0 0 960.00 600.00]") {
+		t.Error("Expected pages with the default 1.6 aspect ratio")
+	}
+	if !strings.Contains(pdf, "/Subtype /Image") {
+		t.Error("Expected the image to be embedded")
+	}
+	if !strings.Contains(pdf, "\x00Q\x00u\x00a\x00r\x00t\x00e\x00r\x00l\x00y") { // UTF-16
+		t.Error("Expected the document title")
+	}
+	if deps := gen.Dependencies(); len(deps) != 1 || deps[0] != imagePath {
+		t.Errorf("Dependencies() = %v, want [%s]", deps, imagePath)
+	}
+	if diags := gen.Diagnostics(); len(diags) != 0 {
+		t.Errorf("Unexpected diagnostics: %v", diags)
+	}
+
+	gen = NewGenerator(Options{Theme: "dark"})
+	output, err = gen.GeneratePDF([]*parser.Slide{{Content: "# Hello", Notes: "Not printed"}})
+	if err != nil {
+		t.Fatalf("GeneratePDF() failed: %v", err)
+	}
+	if got := strings.Count(string(output), "<</Type /Page\n"); got != 1 {
+		t.Errorf("Notes pages should only be added with NotesPages, got %d pages", got)
+	}
+}
+
+func TestGenerateAspectRatioValidation(t *testing.T) {
+	for ratio, want := range map[string]string{
+		"2":    "BIG_ASPECT_RATIO = 2;",
+		"16:9": "BIG_ASPECT_RATIO = 1.7777777777777777;",
+		"none": "BIG_ASPECT_RATIO = false;",
+	} {
+		html, err := NewGenerator(Options{AspectRatio: ratio}).Generate([]*parser.Slide{{Content: "# Hello"}})
+		if err != nil {
+			t.Fatalf("Generate() failed for aspect ratio %q: %v", ratio, err)
+		}
+		if !strings.Contains(html, want) {
+			t.Errorf("Aspect ratio %q: expected %s", ratio, want)
+		}
+	}
+
+	for _, ratio := range []string{"1; alert(1)", "wide", "0", "-2", "16:0", "Infinity"} {
+		html, err := NewGenerator(Options{AspectRatio: ratio}).Generate([]*parser.Slide{{Content: "# Hello"}})
+		if err == nil {
+			t.Errorf("Generate() should fail for aspect ratio %q", ratio)
+		}
+		if strings.Contains(html, "alert") {
+			t.Errorf("Aspect ratio %q was written to the page", ratio)
+		}
+	}
+}
+
+func TestGeneratePDFAspectRatio(t *testing.T) {
+	for ratio, want := range map[string]string{
+		"2":     "/MediaBox [0 0 960.00 480.00]",
+		"false": "/MediaBox [0 0 960.00 600.00]",
+	} {
+		gen := NewGenerator(Options{AspectRatio: ratio})
+		output, err := gen.GeneratePDF([]*parser.Slide{{Content: "# Hello"}})
+		if err != nil {
+			t.Fatalf("GeneratePDF() failed: %v", err)
+		}
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Aspect ratio %q: expected %s", ratio, want)
+		}
+	}
+
+	gen := NewGenerator(Options{AspectRatio: "wide"})
+	if _, err := gen.GeneratePDF([]*parser.Slide{{Content: "# Hello"}}); err == nil {
+		t.Error("GeneratePDF() should fail for an invalid aspect ratio")
+	}
+}
+
+func TestGeneratePDFProblems(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "logo.svg"), []byte("<svg/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator(Options{BasePath: dir})
+	_, err := gen.GeneratePDF([]*parser.Slide{
+		{Content: "![logo](logo.svg)", File: "talk.md", StartLine: 1},
+		{Content: "![cat](https://example.com/cat.png)", File: "talk.md", StartLine: 5},
+		{Content: "Energy: $E = mc^2$\n\n<div>raw</div>", File: "talk.md", StartLine: 9},
+		{Content: "Hello 世界", Metadata: parser.SlideMetadata{Layout: "grid-template-columns: 1fr 2fr;"}, File: "talk.md", StartLine: 13},
+	})
+	if err != nil {
+		t.Fatalf("GeneratePDF() should only warn: %v", err)
+	}
+
+	var messages []string
+	for _, d := range gen.Diagnostics() {
+		messages = append(messages, d.String())
+	}
+	all := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"talk.md:1: warning: image logo.svg is not embedded in the PDF; only JPEG, PNG and GIF images are",
+		"talk.md:5: warning: image https://example.com/cat.png is not embedded in the PDF; only local images are",
+		"talk.md:9: warning: math is exported as TeX source",
+		"talk.md:9: warning: raw HTML is not exported",
+		`talk.md:13: warning: custom layout "grid-template-columns: 1fr 2fr;" is exported as a single column`,
+		`talk.md:13: warning: "世界" has characters that the built-in PDF fonts cannot show`,
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("Missing diagnostic %q in:\n%s", want, all)
+		}
+	}
+}
+
+func TestThemeColors(t *testing.T) {
+	css, err := assets.GetTheme("dark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	colors := themeColors(css)
+	if colors.background != (pdfColor{0x27, 0x2c, 0x32}) || colors.text != (pdfColor{255, 255, 255}) {
+		t.Errorf("Unexpected dark theme colors: %+v", colors)
+	}
+	if colors.emphasis == nil || *colors.emphasis != (pdfColor{0xfa, 0xdb, 0x03}) {
+		t.Errorf("Expected the dark theme emphasis color, got %v", colors.emphasis)
+	}
+
+	colors = themeColors("/* body { color: red } */ body, html { background: rgb(1, 2, 3) } a { color: #abc }")
+	if colors.background != (pdfColor{1, 2, 3}) || colors.text != (pdfColor{0, 0, 0}) || colors.link != (pdfColor{0xaa, 0xbb, 0xcc}) {
+		t.Errorf("Unexpected colors: %+v", colors)
+	}
+	if colors.emphasis != nil {
+		t.Error("Emphasis should have no color unless the theme sets one")
+	}
+}
+
+func TestDocumentBlocks(t *testing.T) {
+	gen := NewGenerator(Options{})
+	blocks := gen.documentBlocks("# Title\n\nSome **bold** and [a link](https://example.com)\n\n1. One\n   - Nested\n2. Two ![pic](pic.png)")
+
+	if len(blocks) != 3 {
+		t.Fatalf("Expected 3 blocks, got %d: %+v", len(blocks), blocks)
+	}
+	if blocks[0].kind != docHeading || blocks[0].level != 1 || spansText(blocks[0].spans) != "Title" {
+		t.Errorf("Unexpected heading: %+v", blocks[0])
+	}
+	if spansText(blocks[1].spans) != "Some bold and a link" {
+		t.Errorf("Unexpected paragraph text %q", spansText(blocks[1].spans))
+	}
+	if !blocks[1].spans[1].strong || blocks[1].spans[3].link != "https://example.com" {
+		t.Errorf("Unexpected paragraph styles: %+v", blocks[1].spans)
+	}
+
+	list := blocks[2]
+	if list.kind != docList || !list.ordered || len(list.items) != 2 {
+		t.Fatalf("Unexpected list: %+v", list)
+	}
+	if nested := list.items[0].children; len(nested) != 1 || nested[0].kind != docList || nested[0].ordered {
+		t.Errorf("Expected a nested bullet list, got %+v", nested)
+	}
+	if children := list.items[1].children; len(children) != 1 || children[0].kind != docImage || children[0].src != "pic.png" {
+		t.Errorf("Expected the image as a block of the second item, got %+v", children)
+	}
+}
+
+func TestGeneratePPTX(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "chart.png"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := NewGenerator(Options{Theme: "dark", BasePath: dir, AspectRatio: "2"})
+	output, err := gen.GeneratePPTX([]*parser.Slide{
+		{Content: "# Results\n\n- Revenue *up*\n  - Mostly [online](https://example.com)\n- Costs down", Notes: "Mention the **outlier**"},
+		{Content: "## Growth\n\n![chart](chart.png)\n\nUp and to the right", Metadata: parser.SlideMetadata{Layout: "50-50", TimeToNext: 5}},
+	})
+	if err != nil {
+		t.Fatalf("GeneratePPTX() failed: %v (%v)", err, gen.Diagnostics())
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(output), int64(len(output)))
+	if err != nil {
+		t.Fatalf("Output is not a zip file: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = string(data)
+		if strings.HasSuffix(f.Name, ".xml") || strings.HasSuffix(f.Name, ".rels") {
+			d := xml.NewDecoder(bytes.NewReader(data))
+			for {
+				if _, err := d.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("%s is not well-formed: %v", f.Name, err)
+				}
+			}
+		}
+	}
+
+	checks := []struct {
+		part, want string
+	}{
+		{"ppt/presentation.xml", `<p:sldSz cx="12192000" cy="6096000"/>`},
+		{"ppt/presentation.xml", "<p:notesMasterIdLst>"},
+		{"ppt/slideMasters/slideMaster1.xml", `<a:srgbClr val="272C32"/>`},
+		{"ppt/slides/slide1.xml", `<p:ph type="title"/>`},
+		{"ppt/slides/slide1.xml", "<a:t>Results</a:t>"},
+		{"ppt/slides/slide1.xml", `<a:buChar char="•"/>`},
+		{"ppt/slides/slide1.xml", `lvl="1"`},
+		{"ppt/slides/slide1.xml", `<a:srgbClr val="FADB03"/></a:solidFill></a:rPr><a:t>up</a:t>`},
+		{"ppt/slides/_rels/slide1.xml.rels", `Target="https://example.com" TargetMode="External"`},
+		{"ppt/slides/_rels/slide1.xml.rels", "notesSlide1.xml"},
+		{"ppt/notesSlides/notesSlide1.xml", "<a:t>outlier</a:t>"},
+		{"ppt/slides/slide2.xml", `<p:ph idx="1"/>`},
+		{"ppt/slides/slide2.xml", `<p:ph idx="2"/>`},
+		{"ppt/slides/slide2.xml", "<p:pic>"},
+		{"ppt/slides/slide2.xml", `<p:transition advTm="5000"/>`},
+		{"ppt/slides/_rels/slide2.xml.rels", "slideLayout2.xml"},
+		{"ppt/slides/_rels/slide2.xml.rels", `Target="../media/image1.png"`},
+		{"[Content_Types].xml", `<Override PartName="/ppt/slides/slide2.xml"`},
+		{"docProps/core.xml", "<dc:title>Results</dc:title>"},
+	}
+	for _, check := range checks {
+		if !strings.Contains(parts[check.part], check.want) {
+			t.Errorf("%s missing %q:\n%s", check.part, check.want, parts[check.part])
+		}
+	}
+	if _, ok := parts["ppt/media/image1.png"]; !ok {
+		t.Error("Expected the image to be embedded")
+	}
+	if _, ok := parts["ppt/notesSlides/notesSlide2.xml"]; ok {
+		t.Error("Slides without notes should have no notes slide")
+	}
+}
+
+func TestGeneratePPTXProblems(t *testing.T) {
+	gen := NewGenerator(Options{})
+	_, err := gen.GeneratePPTX([]*parser.Slide{
+		{Content: "![cat](https://example.com/cat.png)", File: "talk.md", StartLine: 1},
+		{Content: "```dot\ndigraph { a -> b }\n```", File: "talk.md", StartLine: 5},
+	})
+	if err != nil {
+		t.Fatalf("GeneratePPTX() should only warn: %v", err)
+	}
+
+	var messages []string
+	for _, d := range gen.Diagnostics() {
+		messages = append(messages, d.String())
+	}
+	all := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"talk.md:1: warning: image https://example.com/cat.png is not embedded in the PowerPoint file; only local images are",
+		"talk.md:5: warning: dot diagram is exported as its source",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("Missing diagnostic %q in:\n%s", want, all)
+		}
+	}
+}
+
+func TestLookupBackend(t *testing.T) {
+	if got := strings.Join(BackendNames(), ","); got != "html,reveal,pdf,pptx" {
+		t.Errorf("BackendNames() = %s", got)
+	}
+	for _, name := range BackendNames() {
+		backend, ok := LookupBackend(name)
+		if !ok || backend.Name() != name {
+			t.Errorf("LookupBackend(%q) = %v, %v", name, backend, ok)
+		}
+	}
+	if backend, ok := LookupBackend(""); !ok || backend.Name() != "html" {
+		t.Error("An empty format should select big.js HTML")
+	}
+	if _, ok := LookupBackend("keynote"); ok {
+		t.Error("Unknown formats should not have a backend")
+	}
+
+	backend, _ := LookupBackend("reveal")
+	output, err := backend.Generate(NewGenerator(Options{}), []*parser.Slide{{Content: "# Hi"}})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !strings.Contains(string(output), `<section><h1 id="hi">Hi</h1>`) {
+		t.Errorf("reveal backend should emit sections:\n%s", output)
+	}
+}
+
+func TestGenerateReveal(t *testing.T) {
+	gen := NewGenerator(Options{
+		Theme:       "dark",
+		AspectRatio: "2",
+		PresentationMetadata: parser.PresentationMetadata{
+			Presenter: true,
+			Duration:  20,
+		},
+	})
+
+	html, err := gen.GenerateReveal([]*parser.Slide{
+		{Content: "# Talk"},
+		{
+			Content:  "## Agenda\n\n- One\n- Two",
+			Notes:    "Take it *slow*",
+			Metadata: parser.SlideMetadata{Build: parser.BuildItems, TimeToNext: 9, BodyClass: "agenda"},
+		},
+		{
+			Content:  "Left\n\nRight",
+			Metadata: parser.SlideMetadata{Layout: "50-50", Build: parser.BuildCells},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateReveal() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"<title>Talk</title>",
+		`href="` + DefaultRevealURL + `/dist/theme/black.css"`,
+		"--r-background-color: #272c32;",
+		".reveal em { color: #fadb03; }",
+		".reveal .layout { display: grid; width: 100%; height: 480px; }",
+		`<section data-autoslide="3000" data-state="agenda"><h2 id="agenda">Agenda</h2>`,
+		`<li class="fragment" data-fragment-index="0">One</li>`,
+		`<li class="fragment" data-fragment-index="1">Two</li>`,
+		`<aside class="notes"><p>Take it <em>slow</em></p></aside>`,
+		`<p>Left</p>
+      <p class="fragment" data-fragment-index="0">Right</p>`,
+		"plugin/notes/notes.js",
+		"height: 480,\n      plugins: [RevealNotes],\n      totalTime: 1200",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Output should contain %q:\n%s", want, html)
+		}
+	}
+	if got := strings.Count(html, "<section"); got != 3 {
+		t.Errorf("Expected one section per slide, got %d", got)
+	}
+	if strings.Contains(html, "big.js") || strings.Contains(html, hiddenStyle) {
+		t.Error("reveal.js output should not use big.js")
+	}
+}
+
+func TestGenerateRevealCodeSteps(t *testing.T) {
+	gen := NewGenerator(Options{})
+
+	html, err := gen.GenerateReveal([]*parser.Slide{
+		{
+			Content:  "- One\n- Two\n\n```go {1|2}\na := 1\nb := 2\n```",
+			Metadata: parser.SlideMetadata{Build: parser.BuildItems},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateReveal() error = %v", err)
+	}
+
+	sections := strings.Split(html, "<section")[1:]
+	if len(sections) != 2 {
+		t.Fatalf("Expected a section per code step, got %d:\n%s", len(sections), html)
+	}
+	if !strings.Contains(sections[0], `class="fragment"`) || strings.Contains(sections[0], "data-transition") {
+		t.Error("The first section should show the build as fragments")
+	}
+	if !strings.HasPrefix(sections[1], ` data-transition="none">`) || strings.Contains(sections[1], "fragment") {
+		t.Errorf("The code step should follow without a transition, fully revealed:\n%s", sections[1])
+	}
+}
+
+func TestGenerateRevealCodeStepsHeadingIDs(t *testing.T) {
+	html, err := NewGenerator(Options{}).GenerateReveal([]*parser.Slide{
+		{Content: "## Setup\n\n```go {1|2}\na := 1\nb := 2\n```"},
+	})
+	if err != nil {
+		t.Fatalf("GenerateReveal() error = %v", err)
+	}
+	if got := strings.Count(html, "<h2"); got != 2 {
+		t.Fatalf("Expected the heading on both code steps, got %d", got)
+	}
+	if got := strings.Count(html, `id="setup"`); got != 1 {
+		t.Errorf("Expected the heading id on the first step only, got %d:\n%s", got, html)
+	}
+}
+
+func TestGenerateRevealProblems(t *testing.T) {
+	gen := NewGenerator(Options{Theme: "light", AspectRatio: "false", RevealURL: "reveal/"})
+	html, err := gen.GenerateReveal([]*parser.Slide{
+		{Content: "# Hi", File: "talk.md", StartLine: 1, Metadata: parser.SlideMetadata{BodyStyle: "background: red"}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateReveal() should only warn: %v", err)
+	}
+	if !strings.Contains(html, `href="reveal/dist/theme/white.css"`) {
+		t.Error("Light themes should build on reveal.js's white theme from RevealURL")
+	}
+
+	var messages []string
+	for _, d := range gen.Diagnostics() {
+		messages = append(messages, d.String())
+	}
+	all := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"talk.md: warning: reveal.js slides have a fixed aspect ratio; using 1.6",
+		"talk.md:1: warning: body-style is not supported by reveal.js",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("Missing diagnostic %q in:\n%s", want, all)
+		}
+	}
+}
+
+func TestGenerateSafe(t *testing.T) {
+	content := "# Hi <span style=\"color: red\" onclick=\"x()\">there</span>\n\n" +
+		"<script>alert(1)</script>\n\n" +
+		"[click](javascript:alert(1)) <JavaScript:alert(2)> [ok](https://example.com)\n\n" +
+		"<div class=\"box\"><a href=\" java\tscript:alert(3)\">a</a><font>kept</font><iframe src=\"https://example.com\"></iframe></div>"
+	slides := []*parser.Slide{{Content: content, File: "talk.md", StartLine: 1}}
+
+	unsafe, err := NewGenerator(Options{}).Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !strings.Contains(unsafe, "<script>alert(1)</script>") {
+		t.Error("Raw HTML should be kept without safe mode")
+	}
+	if !strings.Contains(unsafe, "<title>Hi &lt;span style=&quot;color: red&quot;") {
+		t.Error("The title should be escaped")
+	}
+
+	gen := NewGenerator(Options{Safe: true})
+	html, err := gen.Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() should only warn: %v", err)
+	}
+	for _, bad := range []string{"alert(1)", "alert(3)", `onclick="`, "<font", "<iframe", `href="javascript:`, "<a href=\"\">"} {
+		if strings.Contains(html, bad) {
+			t.Errorf("Safe output should not contain %q", bad)
+		}
+	}
+	for _, want := range []string{
+		"Hi <span>there</span>",
+		"<p>click JavaScript:alert(2)",
+		`<a href="https://example.com">ok</a>`,
+		`<div class="box"><a>a</a>kept</div>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Safe output should contain %q", want)
+		}
+	}
+
+	var messages []string
+	for _, d := range gen.Diagnostics() {
+		messages = append(messages, d.String())
+	}
+	all := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"talk.md:1: warning: removed style attribute from <span>",
+		"talk.md:1: warning: removed event handler onclick from <span>",
+		"talk.md:1: warning: removed <script> element",
+		"talk.md:1: warning: removed javascript: URL from link",
+		"talk.md:1: warning: removed javascript: URL from <a>",
+		"talk.md:1: warning: removed <font> tag, keeping its content",
+		"talk.md:1: warning: removed <iframe> element",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("Missing diagnostic %q in:\n%s", want, all)
+		}
+	}
+}
+
+func TestGenerateSafeLocalFiles(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "talk")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Join(root, "secret.png"), filepath.Join(dir, "logo.png")} {
+		if err := os.WriteFile(name, []byte("png"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metadata := parser.PresentationMetadata{Fonts: []parser.Font{{Family: "Secret", Src: "../secret.woff2"}}}
+	slides := []*parser.Slide{{Content: "![](../secret.png)", File: filepath.Join(dir, "talk.md"), StartLine: 1}}
+
+	gen := NewGenerator(Options{BasePath: dir, Safe: true, PresentationMetadata: metadata})
+	if _, err := gen.Generate(slides); err == nil {
+		t.Error("Files outside the presentation's directory should be refused in safe mode")
+	}
+	diagnostics := gen.Diagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected the image and the font to be refused, got %v", diagnostics)
+	}
+	for _, d := range diagnostics {
+		if d.Severity != parser.SeverityError || !strings.Contains(d.Message, "safe mode only allows files in the presentation's directory") {
+			t.Errorf("Unexpected diagnostic: %s", d)
+		}
+	}
+
+	slides[0].Content = "![](logo.png)"
+	html, err := NewGenerator(Options{BasePath: dir, Safe: true}).Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !strings.Contains(html, `src="data:image/png;base64,`) {
+		t.Error("An image in the presentation's directory should be embedded in safe mode")
+	}
+}
+
+func TestGenerateSafeEncodedURLs(t *testing.T) {
+	content := "[a](javascript&#58;alert(1)) [b](&#x6A;avascript:alert(2)) [c](javascript%3Aalert(3))\n\n" +
+		"[d](data&colon;text/html,hi) ![e](data&#58;text/html,hi) ![f](javascript&#x3A;alert(4))"
+	slides := []*parser.Slide{{Content: content, File: "talk.md", StartLine: 1}}
+
+	html, err := NewGenerator(Options{Safe: true}).Generate(slides)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	for _, bad := range []string{`href="javascript:`, `href="data:`, `src="data:text`, `src="javascript:`, "alert(1)", "alert(2)", "alert(4)"} {
+		if strings.Contains(html, bad) {
+			t.Errorf("Safe output should not contain %q", bad)
+		}
+	}
+	// A percent-encoded colon does not make a scheme, so the link is relative
+	if !strings.Contains(html, `<a href="javascript%3Aalert(3)">c</a>`) {
+		t.Error("A percent-encoded colon should leave a relative link")
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		image bool
+		want  bool
+	}{
+		{"https://example.com", false, true},
+		{"mailto:me@example.com", false, true},
+		{"images/cat.png", false, true},
+		{"#slide-2", false, true},
+		{"/a:b", false, true},
+		{"javascript:alert(1)", false, false},
+		{" JavaScript:alert(1)", false, false},
+		{"java\tscript:alert(1)", false, false},
+		{"vbscript:msgbox", false, false},
+		{"data:image/png;base64,AAAA", true, true},
+		{"data:image/png;base64,AAAA", false, false},
+		{"data:image/svg+xml,<svg/>", true, false},
+		{"data:text/html,hi", true, false},
+	}
+	for _, tt := range tests {
+		if got := safeURL(tt.url, tt.image); got != tt.want {
+			t.Errorf("safeURL(%q, %v) = %v, want %v", tt.url, tt.image, got, tt.want)
+		}
+	}
+}
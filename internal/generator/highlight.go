@@ -0,0 +1,283 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	"gobig/internal/diagram"
+	parserPkg "gobig/internal/parser"
+)
+
+// HighlightNone disables syntax highlighting when used as the highlight style
+const HighlightNone = "none"
+
+// defaultHighlightStyles maps built-in themes to the highlight style that
+// matches their colors. Custom themes use the dark theme's style.
+var defaultHighlightStyles = map[string]string{
+	"dark":  "monokai",
+	"light": "github",
+	"white": "github",
+}
+
+// highlightCSS lays out code blocks on slides on top of the chosen style
+const highlightCSS = `.chroma { text-align: left; padding: 0.5em; }
+`
+
+// Regex to match the options of a fenced code block's info string:
+// an optional {ranges} group followed by keywords
+var codeRangesRegex = regexp.MustCompile(`\{([^}]*)\}`)
+
+// codeOptions are the options given in a fenced code block's info string,
+// such as "go {3-5} showLineNumbers" or "go {1-3|5|7-9}" to step through
+// groups of lines
+type codeOptions struct {
+	language    string
+	highlight   [][2]int // 1-based inclusive line ranges to highlight in the current step
+	hasRanges   bool     // Whether the info string has a {ranges} group, possibly empty
+	lineNumbers bool
+}
+
+// highlightStyle returns the name of the highlight style for the presentation
+func (g *Generator) highlightStyle() string {
+	if g.options.HighlightStyle != "" {
+		return g.options.HighlightStyle
+	}
+	if style := g.options.PresentationMetadata.HighlightStyle; style != "" {
+		return style
+	}
+	if style, ok := defaultHighlightStyles[g.options.Theme]; ok {
+		return style
+	}
+	return defaultHighlightStyles["dark"]
+}
+
+// highlightStyleCSS returns the stylesheet for highlighted code blocks, or
+// an empty string if none were rendered
+func (g *Generator) highlightStyleCSS() string {
+	if !g.highlighted {
+		return ""
+	}
+
+	var sb strings.Builder
+	formatter := chromahtml.New(chromahtml.WithClasses(true), chromahtml.WithLineNumbers(true), chromahtml.WithCSSComments(false))
+	if err := formatter.WriteCSS(&sb, styles.Get(g.highlightStyle())); err != nil {
+		return ""
+	}
+
+	// Drop the standalone .bg rule, which would apply outside code blocks
+	var css strings.Builder
+	for _, line := range strings.SplitAfter(sb.String(), "\n") {
+		if !strings.HasPrefix(line, ".bg ") {
+			css.WriteString(line)
+		}
+	}
+	css.WriteString(highlightCSS)
+	return css.String()
+}
+
+// validateHighlightStyle reports an unknown highlight style
+func (g *Generator) validateHighlightStyle() {
+	style := g.highlightStyle()
+	if style == HighlightNone {
+		return
+	}
+	if _, ok := styles.Registry[style]; !ok {
+		g.addDiagnostic(parserPkg.SeverityError, "unknown highlight style %q", style)
+	}
+}
+
+// parseCodeOptions parses the info string of a fenced code block, reporting
+// malformed line ranges. lines is the number of lines of code.
+func (g *Generator) parseCodeOptions(info string, lines int) codeOptions {
+	opts := codeOptions{lineNumbers: g.options.PresentationMetadata.LineNumbers}
+
+	// The ranges may follow the language without a space: go{3-5}
+	rest := info
+	if m := codeRangesRegex.FindStringSubmatchIndex(info); m != nil {
+		// Step-through groups are separated by |: {1-3|5|7-9}. Blocks with
+		// fewer groups than the slide has steps keep their last group.
+		groups := strings.Split(info[m[2]:m[3]], "|")
+		group := groups[len(groups)-1]
+		if g.codeStep < len(groups) {
+			group = groups[g.codeStep]
+		}
+		opts.highlight = g.parseLineRanges(group, lines)
+		opts.hasRanges = true
+		rest = info[:m[0]] + " " + info[m[1]:]
+	}
+
+	for i, field := range strings.Fields(rest) {
+		switch {
+		case i == 0:
+			opts.language = field
+		case field == "showLineNumbers" || field == "linenos":
+			opts.lineNumbers = true
+		}
+	}
+
+	return opts
+}
+
+// codeSteps returns the number of steps needed to walk through the line
+// highlight groups of a slide's code blocks, 1 if none of them have several
+func (g *Generator) codeSteps(slide *parserPkg.Slide) int {
+	if g.highlightStyle() == HighlightNone {
+		return 1
+	}
+
+	steps := 1
+	for _, part := range g.contentParts(slide) {
+		source := []byte(part)
+		doc := g.md.Parser().Parse(text.NewReader(source))
+		_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			block, ok := n.(*ast.FencedCodeBlock)
+			if !entering || !ok || block.Info == nil {
+				return ast.WalkContinue, nil
+			}
+			if m := codeRangesRegex.FindStringSubmatch(string(block.Info.Segment.Value(source))); m != nil {
+				steps = max(steps, strings.Count(m[1], "|")+1)
+			}
+			return ast.WalkSkipChildren, nil
+		})
+	}
+	return steps
+}
+
+// parseLineRanges parses comma separated line numbers and ranges such as
+// "1,3-5", reporting ones that are malformed or outside the code
+func (g *Generator) parseLineRanges(spec string, lines int) [][2]int {
+	var ranges [][2]int
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		from, to, isRange := strings.Cut(part, "-")
+		start, err1 := strconv.Atoi(strings.TrimSpace(from))
+		end, err2 := start, error(nil)
+		if isRange {
+			end, err2 = strconv.Atoi(strings.TrimSpace(to))
+		}
+		if err1 != nil || err2 != nil || start < 1 || end < start {
+			g.addDiagnostic(parserPkg.SeverityWarning, "invalid line range %q in code block", part)
+			continue
+		}
+		if end > lines {
+			g.addDiagnostic(parserPkg.SeverityWarning, "line range %q is outside the code block, which has %d line(s)", part, lines)
+			continue
+		}
+
+		ranges = append(ranges, [2]int{start, end})
+	}
+
+	return ranges
+}
+
+// codeBlockRenderer renders fenced code blocks with syntax highlighting
+type codeBlockRenderer struct {
+	g *Generator
+}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.render)
+}
+
+func (r *codeBlockRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.FencedCodeBlock)
+
+	var code strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		code.Write(segment.Value(source))
+	}
+
+	info := ""
+	if n.Info != nil {
+		info = string(n.Info.Segment.Value(source))
+	}
+	opts := r.g.parseCodeOptions(info, lines.Len())
+
+	if diagram.IsDiagram(opts.language) {
+		return ast.WalkSkipChildren, r.renderDiagram(w, opts.language, code.String())
+	}
+
+	style := r.g.highlightStyle()
+	if style == HighlightNone || (opts.language == "" && !opts.hasRanges && !opts.lineNumbers) {
+		return ast.WalkSkipChildren, r.renderPlain(w, opts.language, code.String())
+	}
+
+	lexer := lexers.Get(opts.language)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code.String())
+	if err != nil {
+		r.g.addDiagnostic(parserPkg.SeverityWarning, "failed to highlight %s code block: %v", opts.language, err)
+		return ast.WalkSkipChildren, r.renderPlain(w, opts.language, code.String())
+	}
+
+	formatter := chromahtml.New(
+		chromahtml.WithClasses(true),
+		chromahtml.WithLineNumbers(opts.lineNumbers),
+		chromahtml.HighlightLines(opts.highlight),
+	)
+	if err := formatter.Format(w, styles.Get(style), iterator); err != nil {
+		return ast.WalkStop, err
+	}
+	_, _ = w.WriteString("\n")
+
+	r.g.highlighted = true
+	return ast.WalkSkipChildren, nil
+}
+
+// renderDiagram renders a diagram code block as inline SVG, or as plain
+// code with a diagnostic if it is invalid
+func (r *codeBlockRenderer) renderDiagram(w util.BufWriter, language, source string) error {
+	svg, err := diagram.Render(language, source)
+	if err != nil {
+		r.g.addProblem(source, "failed to render %s diagram: %v", language, err)
+		return r.renderPlain(w, language, source)
+	}
+	r.g.diagrams = true
+	_, err = w.WriteString(svg + "\n")
+	return err
+}
+
+// diagramCSS returns the stylesheet for diagrams, or an empty string if
+// none were rendered
+func (g *Generator) diagramCSS() string {
+	if !g.diagrams {
+		return ""
+	}
+	return diagram.CSS
+}
+
+// renderPlain renders a code block without highlighting, like goldmark does
+func (r *codeBlockRenderer) renderPlain(w util.BufWriter, language, code string) error {
+	_, _ = w.WriteString("<pre><code")
+	if language != "" {
+		_, _ = fmt.Fprintf(w, ` class="language-%s"`, escapeAttr(language))
+	}
+	_, _ = w.WriteString(">")
+	_, _ = w.WriteString(escapeHTML(code))
+	_, err := w.WriteString("</code></pre>\n")
+	return err
+}
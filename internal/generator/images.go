@@ -0,0 +1,451 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"path/filepath"
+	"strings"
+
+	parserPkg "gobig/internal/parser"
+)
+
+const (
+	defaultImageWidth   = 1920 // Screen width optimized images are scaled for
+	defaultImageQuality = 85   // JPEG quality of optimized images
+	minVariantWidth     = 320  // Narrowest srcset variant
+)
+
+// optimizedImage is a local image prepared for embedding
+type optimizedImage struct {
+	data   []byte
+	image  image.Image // Decoded, upright and scaled image, nil if the image was left as is
+	format string      // "jpeg" or "png"
+	srcset string      // srcset attribute in directory output, set on first use
+}
+
+// optimizeImage downscales a local JPEG or PNG image to fit a slide at the
+// target screen width, turns it upright and re-encodes it without metadata
+// such as EXIF and GPS tags. Color profiles are kept. If the image needs
+// neither scaling nor turning and re-encoding does not make it smaller, the
+// original is kept with its metadata removed. Other images are returned
+// unchanged. Results are cached, as slides with builds are rendered more
+// than once.
+func (g *Generator) optimizeImage(path string, data []byte) *optimizedImage {
+	if cached, ok := g.images[path]; ok {
+		return cached
+	}
+	if g.images == nil {
+		g.images = make(map[string]*optimizedImage)
+	}
+	result := &optimizedImage{data: data}
+	g.images[path] = result
+
+	contentType := detectContentType(path)
+	if !g.options.OptimizeImages || (contentType != "image/jpeg" && contentType != "image/png") {
+		return result
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		g.addDiagnostic(parserPkg.SeverityWarning, "image %s embedded without optimizing: %v", filepath.Base(path), err)
+		return result
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	// Fit the upright image in a slide at the target resolution
+	width := g.options.ImageWidth
+	if width <= 0 {
+		width = defaultImageWidth
+	}
+	height, err := pageHeight(g.options.AspectRatio)
+	if err != nil {
+		height = pdfPageWidth / 1.6
+	}
+	boxW, boxH := float64(width), float64(width)*height/pdfPageWidth
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	uprightW, uprightH := w, h
+	if orientation >= 5 {
+		uprightW, uprightH = h, w
+	}
+	scale := math.Min(1, math.Min(boxW/float64(uprightW), boxH/float64(uprightH)))
+
+	result.format = format
+	if scale == 1 && orientation == 1 {
+		result.image = img
+		stripped := stripImageMetadata(format, data)
+		if encoded := g.encodeImage(img, format, data); len(encoded) < len(stripped) {
+			result.data = encoded
+		} else {
+			result.data = stripped
+		}
+		return result
+	}
+
+	scaled := scaleImage(img, max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale))))
+	result.image = orient(scaled, orientation)
+	result.data = g.encodeImage(result.image, format, data)
+	return result
+}
+
+// imageSrcset returns the srcset of an optimized image in directory output:
+// the image at url followed by copies at half and quarter width, or an
+// empty string if the image is too small for smaller copies
+func (g *Generator) imageSrcset(path string, optimized *optimizedImage, url string) string {
+	if optimized.image == nil {
+		return ""
+	}
+	if optimized.srcset != "" {
+		return optimized.srcset
+	}
+
+	bounds := optimized.image.Bounds()
+	candidates := []string{fmt.Sprintf("%s %dw", url, bounds.Dx())}
+	ext := filepath.Ext(path)
+	name := strings.TrimSuffix(filepath.Base(path), ext)
+	for _, divisor := range []int{2, 4} {
+		w := bounds.Dx() / divisor
+		if w < minVariantWidth {
+			break
+		}
+		h := max(1, bounds.Dy()/divisor)
+		variant := g.encodeImage(scaleImage(optimized.image, w, h), optimized.format, optimized.data)
+		variantURL := g.addAsset(fmt.Sprintf("%s-%dw%s", name, w, ext), variant)
+		candidates = append(candidates, fmt.Sprintf("%s %dw", variantURL, w))
+	}
+	if len(candidates) > 1 {
+		optimized.srcset = strings.Join(candidates, ", ")
+	}
+	return optimized.srcset
+}
+
+// imageQuality returns the JPEG quality of optimized images
+func (g *Generator) imageQuality() int {
+	if g.options.ImageQuality == 0 {
+		return defaultImageQuality
+	}
+	return g.options.ImageQuality
+}
+
+// validateImageOptions reports image optimization options that are out of
+// range
+func (g *Generator) validateImageOptions() {
+	if q := g.options.ImageQuality; q < 0 || q > 100 {
+		g.addDiagnostic(parserPkg.SeverityError, "image quality %d must be between 1 and 100", q)
+	}
+	if g.options.ImageWidth < 0 {
+		g.addDiagnostic(parserPkg.SeverityError, "image width %d must not be negative", g.options.ImageWidth)
+	}
+}
+
+// encodeImage encodes an image in the format it was read from, keeping the
+// color profile of the original file
+func (g *Generator) encodeImage(img image.Image, format string, original []byte) []byte {
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		_ = jpeg.Encode(&buf, img, &jpeg.Options{Quality: min(max(g.imageQuality(), 1), 100)})
+		return insertJPEGSegments(buf.Bytes(), jpegColorSegments(original))
+	}
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	_ = encoder.Encode(&buf, img)
+	return insertPNGChunks(buf.Bytes(), pngColorChunks(original))
+}
+
+// scaleImage resizes an image to w×h pixels by averaging the source pixels
+// each destination pixel covers, which suits the downscaling done here
+func scaleImage(src image.Image, w, h int) *image.RGBA {
+	bounds := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	}
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if sw == w && sh == h {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := max(y0+1, (y+1)*sh/h)
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := max(x0+1, (x+1)*sw/w)
+
+			var sum [4]uint64
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += uint64(row[i])
+					sum[1] += uint64(row[i+1])
+					sum[2] += uint64(row[i+2])
+					sum[3] += uint64(row[i+3])
+				}
+			}
+			n := uint64((x1 - x0) * (y1 - y0))
+			i := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// orient turns an image upright according to its EXIF orientation, from 1
+// (already upright) to 8
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored
+				sx, sy = w-1-x, y
+			case 3: // Upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored upside down
+				sx, sy = x, h-1-y
+			case 5: // Mirrored and turned left
+				sx, sy = y, x
+			case 6: // Turned left, so turn right
+				sx, sy = y, h-1-x
+			case 7: // Mirrored and turned right
+				sx, sy = w-1-y, h-1-x
+			case 8: // Turned right, so turn left
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:sy*src.Stride+sx*4+4])
+		}
+	}
+	return dst
+}
+
+// stripImageMetadata removes metadata from an encoded image without
+// decoding it
+func stripImageMetadata(format string, data []byte) []byte {
+	if format == "jpeg" {
+		return stripJPEGMetadata(data)
+	}
+	return stripPNGMetadata(data)
+}
+
+// jpegSegment is a marker segment of a JPEG file before the image data
+type jpegSegment struct {
+	marker byte
+	data   []byte // Whole segment, including the marker and length
+}
+
+// jpegSegments splits the header of a JPEG file into segments, returning
+// them and the offset where the segments end
+func jpegSegments(data []byte) ([]jpegSegment, int) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0
+	}
+	var segments []jpegSegment
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // Start of scan or end of image
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		segments = append(segments, jpegSegment{marker: marker, data: data[pos:end]})
+		pos = end
+	}
+	return segments, pos
+}
+
+// isJPEGMetadata reports whether a JPEG segment only holds metadata: EXIF
+// and XMP (APP1), IPTC (APP13) and other application data or comments.
+// JFIF (APP0), color profiles (APP2) and Adobe color transforms (APP14)
+// affect how the image looks and are kept.
+func isJPEGMetadata(segment jpegSegment) bool {
+	switch {
+	case segment.marker == 0xFE: // Comment
+		return true
+	case segment.marker >= 0xE1 && segment.marker <= 0xEF:
+		return segment.marker != 0xE2 && segment.marker != 0xEE
+	}
+	return false
+}
+
+// stripJPEGMetadata removes metadata segments from a JPEG file
+func stripJPEGMetadata(data []byte) []byte {
+	segments, end := jpegSegments(data)
+	if end == 0 {
+		return data
+	}
+	out := []byte{0xFF, 0xD8}
+	for _, segment := range segments {
+		if !isJPEGMetadata(segment) {
+			out = append(out, segment.data...)
+		}
+	}
+	return append(out, data[end:]...)
+}
+
+// jpegColorSegments returns the ICC color profile segments of a JPEG file
+func jpegColorSegments(data []byte) [][]byte {
+	segments, _ := jpegSegments(data)
+	var color [][]byte
+	for _, segment := range segments {
+		if segment.marker == 0xE2 && bytes.HasPrefix(segment.data[4:], []byte("ICC_PROFILE\x00")) {
+			color = append(color, segment.data)
+		}
+	}
+	return color
+}
+
+// insertJPEGSegments adds segments to a JPEG file right after its start
+func insertJPEGSegments(data []byte, segments [][]byte) []byte {
+	if len(segments) == 0 || len(data) < 2 {
+		return data
+	}
+	out := append([]byte{}, data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG file, 1 if it has
+// none
+func jpegOrientation(data []byte) int {
+	segments, _ := jpegSegments(data)
+	for _, segment := range segments {
+		if segment.marker != 0xE1 || !bytes.HasPrefix(segment.data[4:], []byte("Exif\x00\x00")) {
+			continue
+		}
+		tiff := segment.data[10:]
+		if len(tiff) < 8 {
+			return 1
+		}
+		var order binary.ByteOrder
+		switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return 1
+		}
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return 1
+		}
+		entries := int(order.Uint16(tiff[ifd:]))
+		for i := 0; i < entries; i++ {
+			entry := ifd + 2 + i*12
+			if entry+12 > len(tiff) {
+				break
+			}
+			if order.Uint16(tiff[entry:]) == 0x0112 { // Orientation
+				if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+					return o
+				}
+			}
+		}
+		return 1
+	}
+	return 1
+}
+
+// pngSignature starts every PNG file
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngMetadataChunks are the PNG chunks that only hold metadata: text,
+// EXIF and modification time
+var pngMetadataChunks = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true}
+
+// pngColorChunkTypes are the PNG chunks that describe the color space, which
+// Go's encoder does not write
+var pngColorChunkTypes = map[string]bool{"iCCP": true, "sRGB": true, "gAMA": true, "cHRM": true}
+
+// pngChunks splits a PNG file into whole chunks, with ok false if it is
+// malformed
+func pngChunks(data []byte) (chunks [][]byte, ok bool) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, false
+	}
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, false
+		}
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) || end < pos {
+			return nil, false
+		}
+		chunks = append(chunks, data[pos:end])
+		pos = end
+	}
+	return chunks, true
+}
+
+// stripPNGMetadata removes metadata chunks from a PNG file
+func stripPNGMetadata(data []byte) []byte {
+	chunks, ok := pngChunks(data)
+	if !ok {
+		return data
+	}
+	out := []byte(pngSignature)
+	for _, chunk := range chunks {
+		if !pngMetadataChunks[string(chunk[4:8])] {
+			out = append(out, chunk...)
+		}
+	}
+	return out
+}
+
+// pngColorChunks returns the color space chunks of a PNG file
+func pngColorChunks(data []byte) [][]byte {
+	chunks, _ := pngChunks(data)
+	var color [][]byte
+	for _, chunk := range chunks {
+		if pngColorChunkTypes[string(chunk[4:8])] {
+			color = append(color, chunk)
+		}
+	}
+	return color
+}
+
+// insertPNGChunks adds chunks to a PNG file right after its header chunk
+func insertPNGChunks(data []byte, chunks [][]byte) []byte {
+	existing, ok := pngChunks(data)
+	if len(chunks) == 0 || !ok || len(existing) == 0 {
+		return data
+	}
+	out := append([]byte(pngSignature), existing[0]...)
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	for _, chunk := range existing[1:] {
+		out = append(out, chunk...)
+	}
+	return out
+}
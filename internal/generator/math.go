@@ -0,0 +1,262 @@
+package generator
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	"gobig/internal/mathml"
+)
+
+// kindMath is the node kind of inline math
+var kindMath = ast.NewNodeKind("Math")
+
+// kindMathBlock is the node kind of display math on lines of its own
+var kindMathBlock = ast.NewNodeKind("MathBlock")
+
+// mathNode is inline math: $...$, or $$...$$ for display math within a
+// paragraph
+type mathNode struct {
+	ast.BaseInline
+	tex     text.Segment
+	display bool
+}
+
+// Kind implements ast.Node
+func (n *mathNode) Kind() ast.NodeKind {
+	return kindMath
+}
+
+// Dump implements ast.Node
+func (n *mathNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": string(n.tex.Value(source))}, nil)
+}
+
+// mathBlockNode is display math between lines starting and ending with $$
+type mathBlockNode struct {
+	ast.BaseBlock
+	closed bool // Whether the closing $$ was found
+}
+
+// Kind implements ast.Node
+func (n *mathBlockNode) Kind() ast.NodeKind {
+	return kindMathBlock
+}
+
+// IsRaw implements ast.Node
+func (n *mathBlockNode) IsRaw() bool {
+	return true
+}
+
+// Dump implements ast.Node
+func (n *mathBlockNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mathExtension adds $...$ and $$...$$ math, rendered to MathML
+type mathExtension struct {
+	g *Generator
+}
+
+// Extend implements goldmark.Extender
+func (e *mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(&mathBlockParser{}, 150)),
+		parser.WithInlineParsers(util.Prioritized(&mathInlineParser{}, 150)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&mathRenderer{g: e.g}, 500)))
+}
+
+// mathInlineParser parses $...$ and $$...$$ within a line. Like pandoc, the
+// opening $ must not be followed by a space and the closing $ must not be
+// preceded by a space or followed by a digit, so prices such as "$5 and
+// $10" stay text.
+type mathInlineParser struct{}
+
+// Trigger implements parser.InlineParser
+func (p *mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse implements parser.InlineParser
+func (p *mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	delim := 1
+	if len(line) > 1 && line[1] == '$' {
+		delim = 2
+	}
+	if delim == 1 && (len(line) < 2 || util.IsSpace(line[1])) {
+		return nil
+	}
+
+	for i := delim; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++ // Escaped character, such as \$
+		case line[i] != '$' || i == delim:
+			continue
+		case delim == 2:
+			if i+1 < len(line) && line[i+1] == '$' {
+				return p.node(block, segment, delim, i, true)
+			}
+		case !util.IsSpace(line[i-1]) && (i+1 == len(line) || !util.IsNumeric(line[i+1])):
+			return p.node(block, segment, delim, i, false)
+		}
+	}
+	return nil
+}
+
+// node returns the math node ending at end, the position of the closing
+// delimiter in the line, and consumes it
+func (p *mathInlineParser) node(block text.Reader, segment text.Segment, delim, end int, display bool) ast.Node {
+	node := &mathNode{
+		tex:     text.NewSegment(segment.Start+delim, segment.Start+end),
+		display: display,
+	}
+	block.Advance(end + delim)
+	return node
+}
+
+// mathBlockParser parses display math on lines of its own: either a single
+// $$...$$ line, or lines between a $$ line and a line ending with $$
+type mathBlockParser struct{}
+
+// Trigger implements parser.BlockParser
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Open implements parser.BlockParser
+func (p *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 {
+		return nil, parser.NoChildren
+	}
+	content := bytes.TrimRight(line[pos:], " \t\r\n")
+	if !bytes.HasPrefix(content, []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+
+	node := &mathBlockNode{}
+	if len(content) == 2 {
+		return node, parser.NoChildren
+	}
+	if len(content) < 4 || !bytes.HasSuffix(content, []byte("$$")) {
+		// Display math followed by text in a paragraph is left to the
+		// inline parser
+		return nil, parser.NoChildren
+	}
+
+	start := segment.Start + pos + 2
+	node.Lines().Append(text.NewSegment(start, start+len(content)-4))
+	node.closed = true
+	reader.Advance(segment.Len() - 1)
+	return node, parser.NoChildren
+}
+
+// Continue implements parser.BlockParser
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	n := node.(*mathBlockNode)
+	if n.closed {
+		return parser.Close
+	}
+
+	line, segment := reader.PeekLine()
+	content := bytes.TrimRight(line, " \t\r\n")
+	if bytes.HasSuffix(content, []byte("$$")) {
+		if len(content) > 2 {
+			n.Lines().Append(text.NewSegment(segment.Start, segment.Start+len(content)-2))
+		}
+		n.closed = true
+		reader.Advance(segment.Len() - 1)
+		return parser.Close
+	}
+
+	n.Lines().Append(segment)
+	reader.Advance(segment.Len() - 1)
+	return parser.Continue | parser.NoChildren
+}
+
+// Close implements parser.BlockParser
+func (p *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+// CanInterruptParagraph implements parser.BlockParser
+func (p *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine implements parser.BlockParser
+func (p *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// mathRenderer renders math nodes as MathML, reporting invalid TeX
+type mathRenderer struct {
+	g *Generator
+}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMath, r.renderMath)
+	reg.Register(kindMathBlock, r.renderMathBlock)
+}
+
+func (r *mathRenderer) renderMath(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*mathNode)
+	r.write(w, string(n.tex.Value(source)), n.display)
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *mathRenderer) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*mathBlockNode)
+
+	var tex strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		tex.Write(segment.Value(source))
+	}
+
+	if !n.closed {
+		r.g.addProblem("$$\n"+tex.String(), "display math is missing its closing $$")
+		r.writeError(w, tex.String(), true)
+	} else {
+		r.write(w, strings.TrimSpace(tex.String()), true)
+	}
+	_, err := w.WriteString("\n")
+	return ast.WalkSkipChildren, err
+}
+
+// write converts TeX to MathML, reporting invalid TeX and showing its
+// escaped source instead
+func (r *mathRenderer) write(w util.BufWriter, tex string, display bool) {
+	math, err := mathml.Convert(tex, display)
+	if err != nil {
+		r.g.addProblem(tex, "invalid math %q: %v", tex, err)
+		r.writeError(w, tex, display)
+		return
+	}
+	_, _ = w.WriteString(math)
+}
+
+// writeError shows the source of math that could not be converted
+func (r *mathRenderer) writeError(w util.BufWriter, tex string, display bool) {
+	delim := "$"
+	if display {
+		delim = "$$"
+	}
+	_, _ = w.WriteString(`<code class="math-error">` + escapeHTML(delim+tex+delim) + "</code>")
+}
@@ -0,0 +1,844 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+
+	"gobig/internal/assets"
+	parserPkg "gobig/internal/parser"
+)
+
+// Page geometry of PDF output, in points
+const (
+	pdfPageWidth  = 960.0
+	pdfMargin     = 0.04 // Fraction of the page width around the content
+	pdfLineHeight = 1.2  // Line height as a multiple of the font size
+	pdfMinFont    = 4.0  // Smallest font size content is shrunk to
+	pdfNotesFont  = 14.0 // Largest font size of notes pages
+)
+
+// pdfFontFamily is the family name TrueType fonts from the presentation
+// metadata are registered under
+const pdfFontFamily = "deck"
+
+// headingScale is the font size of each heading level relative to body
+// text, as in browsers' default stylesheets
+var headingScale = []float64{2, 1.5, 1.17, 1, 0.83, 0.67}
+
+// Regexes to read colors from theme CSS
+var (
+	// cssCommentRegex matches CSS comments
+	cssCommentRegex = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+	// cssRuleRegex matches a simple CSS rule: selectors and declarations
+	cssRuleRegex = regexp.MustCompile(`(?s)([^{}]+)\{([^{}]*)\}`)
+
+	// cssColorRegex matches a color or background declaration
+	cssColorRegex = regexp.MustCompile(`(?i)(?:^|;)\s*(color|background|background-color)\s*:\s*([^;]+)`)
+
+	// cssRGBRegex matches rgb() and rgba() colors
+	cssRGBRegex = regexp.MustCompile(`(?i)^rgba?\(\s*(\d+)\s*[, ]\s*(\d+)\s*[, ]\s*(\d+)`)
+)
+
+// cssNamedColors lists the CSS color keywords that themes commonly use
+var cssNamedColors = map[string]pdfColor{
+	"black":  {0, 0, 0},
+	"white":  {255, 255, 255},
+	"red":    {255, 0, 0},
+	"green":  {0, 128, 0},
+	"blue":   {0, 0, 255},
+	"yellow": {255, 255, 0},
+	"orange": {255, 165, 0},
+	"gray":   {128, 128, 128},
+	"grey":   {128, 128, 128},
+	"silver": {192, 192, 192},
+	"navy":   {0, 0, 128},
+	"purple": {128, 0, 128},
+	"teal":   {0, 128, 128},
+}
+
+// pdfColor is an RGB color
+type pdfColor struct {
+	r, g, b int
+}
+
+// mix returns the color a fraction t of the way from c to other
+func (c pdfColor) mix(other pdfColor, t float64) pdfColor {
+	blend := func(a, b int) int {
+		return int(math.Round(float64(a) + (float64(b)-float64(a))*t))
+	}
+	return pdfColor{blend(c.r, other.r), blend(c.g, other.g), blend(c.b, other.b)}
+}
+
+// pdfColors are the colors of a theme
+type pdfColors struct {
+	background pdfColor
+	text       pdfColor
+	emphasis   *pdfColor // nil if emphasis looks like regular text
+	link       pdfColor
+}
+
+// themeColors reads the body, em and a colors from theme CSS, starting from
+// the colors of a browser's default stylesheet
+func themeColors(css string) pdfColors {
+	colors := pdfColors{
+		background: pdfColor{255, 255, 255},
+		text:       pdfColor{0, 0, 0},
+		link:       pdfColor{0, 0, 238},
+	}
+	for _, rule := range cssRuleRegex.FindAllStringSubmatch(cssCommentRegex.ReplaceAllString(css, ""), -1) {
+		for _, selector := range strings.Split(rule[1], ",") {
+			selector = strings.TrimSpace(selector)
+			for _, decl := range cssColorRegex.FindAllStringSubmatch(rule[2], -1) {
+				c, ok := parseCSSColor(decl[2])
+				if !ok {
+					continue
+				}
+				property := strings.ToLower(decl[1])
+				switch {
+				case (selector == "body" || selector == "html") && property != "color":
+					colors.background = c
+				case selector == "body":
+					colors.text = c
+				case selector == "em" && property == "color":
+					colors.emphasis = &c
+				case selector == "a" && property == "color":
+					colors.link = c
+				}
+			}
+		}
+	}
+	return colors
+}
+
+// parseCSSColor parses a hex, rgb() or named CSS color. Backgrounds such as
+// gradients are parsed from their first color.
+func parseCSSColor(value string) (pdfColor, bool) {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important"))
+	if m := cssRGBRegex.FindStringSubmatch(value); m != nil {
+		r, _ := strconv.Atoi(m[1])
+		g, _ := strconv.Atoi(m[2])
+		b, _ := strconv.Atoi(m[3])
+		return pdfColor{min(r, 255), min(g, 255), min(b, 255)}, true
+	}
+	for _, word := range strings.Fields(value) {
+		if strings.HasPrefix(word, "#") {
+			hex := strings.TrimPrefix(word, "#")
+			if len(hex) == 3 || len(hex) == 4 {
+				hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+			}
+			if len(hex) != 6 && len(hex) != 8 {
+				return pdfColor{}, false
+			}
+			n, err := strconv.ParseUint(hex[:6], 16, 32)
+			if err != nil {
+				return pdfColor{}, false
+			}
+			return pdfColor{int(n >> 16), int(n >> 8 & 0xff), int(n & 0xff)}, true
+		}
+		if c, ok := cssNamedColors[strings.ToLower(word)]; ok {
+			return c, true
+		}
+	}
+	return pdfColor{}, false
+}
+
+// pageHeight returns the page height for an aspect ratio option. A ratio of
+// "false" fills the browser window in HTML, which has no shape on paper, so
+// it gets the default ratio.
+func pageHeight(ratio string) (float64, error) {
+	if ratio == "" {
+		return pdfPageWidth / 1.6, nil
+	}
+	r, err := parseAspectRatio(ratio)
+	if err != nil {
+		return 0, err
+	}
+	if r == 0 {
+		return pdfPageWidth / 1.6, nil
+	}
+	return pdfPageWidth / r, nil
+}
+
+// pdfWriter draws slides on a PDF document
+type pdfWriter struct {
+	g      *Generator
+	pdf    *fpdf.Fpdf
+	colors pdfColors
+	family string              // Family of body text
+	style  string              // Style of body text, "B" for the bold of big.js
+	encode func(string) string // Converts text to Windows-1252 for the built-in fonts
+	images map[string]*fpdf.ImageInfoType
+
+	// Text is measured on a document without pages, as setting the font
+	// of a document adds it to the current page
+	metrics *fpdf.Fpdf
+	widths  map[string]float64 // Width of text at size 1 by font and text
+	font    string             // Font last set for drawing
+}
+
+// pdfItem is something drawn on a page, positioned relative to the top
+// left of the content it belongs to
+type pdfItem struct {
+	x, y, w, h float64
+	text       string // Text with its baseline at y, or empty for boxes
+	family     string
+	style      string
+	size       float64
+	color      pdfColor
+	link       string
+	fill       bool   // Fill the box with color
+	line       bool   // Draw a line from (x, y) to (x+w, y+h)
+	image      string // Name of a registered image filling the box
+}
+
+// GeneratePDF renders slides to a PDF document with one page per slide,
+// without a browser. Text is sized to fill the page like big.js does,
+// builds are shown fully revealed, and with NotesPages each slide with
+// speaker notes is followed by a page of its notes.
+func (g *Generator) GeneratePDF(slides []*parserPkg.Slide) ([]byte, error) {
+	g.begin(slides)
+
+	height, err := pageHeight(g.options.AspectRatio)
+	if err != nil {
+		return nil, err
+	}
+
+	theme, err := assets.LoadThemeWithOptions(g.options.Theme, assets.ThemeOptions{SearchPaths: g.options.ThemePaths, Confine: g.options.Safe})
+	if theme != nil {
+		for _, file := range theme.Files {
+			g.addDependency(file)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get theme: %w", err)
+	}
+
+	init := &fpdf.InitType{UnitStr: "pt", Size: fpdf.SizeType{Wd: pdfPageWidth, Ht: height}}
+	pdf := fpdf.NewCustom(init)
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetCreator("gobig", true)
+	pdf.SetTitle(g.title(slides), true)
+
+	w := &pdfWriter{
+		g:       g,
+		pdf:     pdf,
+		metrics: fpdf.NewCustom(init),
+		widths:  make(map[string]float64),
+		colors:  themeColors(theme.CSS),
+		family:  "Helvetica",
+		style:   "B",
+		encode:  pdf.UnicodeTranslatorFromDescriptor(""),
+		images:  make(map[string]*fpdf.ImageInfoType),
+	}
+	w.loadFonts()
+
+	for i, slide := range slides {
+		g.current = slide
+		w.slidePage(slide, height)
+		if g.options.NotesPages && strings.TrimSpace(slide.Notes) != "" {
+			w.notesPage(slide, i+1, height)
+		}
+		g.current = nil
+	}
+	if len(slides) == 0 {
+		pdf.AddPage()
+	}
+
+	if errors := g.countErrors(); errors > 0 {
+		return nil, fmt.Errorf("%d problem(s) found", errors)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// loadFonts uses the TrueType fonts declared in the presentation metadata
+// for body text, so that text outside of Windows-1252 can be shown. Other
+// font formats cannot be embedded in PDF and fall back to Helvetica.
+func (w *pdfWriter) loadFonts() {
+	family := ""
+	styles := make(map[string]bool)
+	for _, font := range w.g.options.PresentationMetadata.Fonts {
+		if font.Src == "" || (family != "" && font.Family != family) {
+			continue
+		}
+		path := font.Src
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(w.g.options.BasePath, path)
+		}
+		if w.g.refusePath(path, font.Src) {
+			continue
+		}
+		w.g.addDependency(path)
+		if !strings.EqualFold(filepath.Ext(path), ".ttf") {
+			w.g.addDiagnostic(parserPkg.SeverityWarning, "font %s is not a TrueType (.ttf) font and is not used in PDF output", font.Src)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			w.g.addDiagnostic(parserPkg.SeverityError, "failed to read font %s: %v", font.Src, err)
+			continue
+		}
+
+		style := ""
+		if weight, err := strconv.Atoi(font.Weight); (err == nil && weight >= 600) || font.Weight == "bold" {
+			style = "B"
+		}
+		if font.Style == "italic" || font.Style == "oblique" {
+			style += "I"
+		}
+		w.pdf.AddUTF8FontFromBytes(pdfFontFamily, style, data)
+		w.metrics.AddUTF8FontFromBytes(pdfFontFamily, style, data)
+		if w.pdf.Err() || w.metrics.Err() {
+			w.g.addDiagnostic(parserPkg.SeverityWarning, "font %s cannot be used in PDF output: %v", font.Src, w.pdf.Error())
+			w.pdf.ClearError()
+			w.metrics.ClearError()
+			continue
+		}
+		family = font.Family
+		styles[style] = true
+	}
+	if family == "" {
+		return
+	}
+
+	w.family = pdfFontFamily
+	w.style = "B"
+	if !styles["B"] {
+		w.style = ""
+	}
+	if !styles[w.style] {
+		for style := range styles {
+			w.style = style
+			break
+		}
+	}
+}
+
+// slidePage adds the page of a slide, with its content sized to fill the
+// page or each cell of its layout
+func (w *pdfWriter) slidePage(slide *parserPkg.Slide, height float64) {
+	w.pdf.AddPage()
+	w.fillPage(w.colors.background, height)
+
+	margin := pdfPageWidth * pdfMargin
+	area := gridCell{x: margin, y: margin, w: pdfPageWidth - 2*margin, h: height - 2*margin}
+
+	var cells []gridCell
+	var contents [][]docBlock
+	if slide.Metadata.Layout != "" {
+		parts := splitContentForLayout(slide.Content)
+		columns, rows, ok := layoutGrid(slide.Metadata.Layout)
+		if !ok {
+			w.g.addDiagnostic(parserPkg.SeverityWarning, "custom layout %q is exported as a single column", slide.Metadata.Layout)
+		}
+		for i, cell := range layoutCells(columns, rows, len(parts)) {
+			cells = append(cells, gridCell{
+				x: area.x + cell.x*area.w,
+				y: area.y + cell.y*area.h,
+				w: cell.w * area.w,
+				h: cell.h * area.h,
+			})
+			contents = append(contents, w.g.documentBlocks(parts[i]))
+		}
+		if !ok {
+			// Stack the parts like the blocks of a regular slide
+			var blocks []docBlock
+			for _, content := range contents {
+				blocks = append(blocks, content...)
+			}
+			cells, contents = []gridCell{area}, [][]docBlock{blocks}
+		}
+	} else {
+		cells, contents = []gridCell{area}, [][]docBlock{w.g.documentBlocks(slide.Content)}
+	}
+
+	// Cells that are a single image show it as large as the cell allows;
+	// the text of every other cell shares one font size, as on a big slide
+	var textCells []int
+	for i, blocks := range contents {
+		if len(blocks) == 1 && blocks[0].kind == docImage {
+			w.drawImage(blocks[0], cells[i])
+			continue
+		}
+		textCells = append(textCells, i)
+	}
+
+	size := w.fitSize(len(textCells), func(i int) ([]docBlock, gridCell) {
+		return contents[textCells[i]], cells[textCells[i]]
+	}, height)
+	for _, i := range textCells {
+		w.drawCentered(contents[i], cells[i], size, w.colors)
+	}
+}
+
+// notesPage adds a page with the speaker notes of a slide, in black on white
+// so that it prints well whatever the theme
+func (w *pdfWriter) notesPage(slide *parserPkg.Slide, number int, height float64) {
+	w.pdf.AddPage()
+	colors := pdfColors{
+		background: pdfColor{255, 255, 255},
+		text:       pdfColor{0, 0, 0},
+		link:       pdfColor{0, 0, 238},
+	}
+	w.fillPage(colors.background, height)
+
+	margin := pdfPageWidth * pdfMargin
+	heading := []docBlock{{kind: docParagraph, spans: []docSpan{{text: fmt.Sprintf("Notes for slide %d", number)}}}}
+	w.draw(w.layout(heading, margin, margin, pdfPageWidth-2*margin, pdfNotesFont*0.8, colors.text.mix(colors.background, 0.5), colors), 0, 0)
+
+	top := margin + pdfNotesFont*2
+	area := gridCell{x: margin, y: top, w: pdfPageWidth - 2*margin, h: height - top - margin}
+	var blocks []docBlock
+	if w.g.options.PlainNotes {
+		for _, line := range strings.Split(strings.TrimSpace(slide.Notes), "\n") {
+			blocks = append(blocks, docBlock{kind: docParagraph, spans: []docSpan{{text: line}}})
+		}
+	} else {
+		blocks = w.g.documentBlocks(slide.Notes)
+	}
+	size := math.Min(pdfNotesFont, w.fitSize(1, func(int) ([]docBlock, gridCell) { return blocks, area }, height))
+	w.draw(w.layout(blocks, area.x, area.y, area.w, size, colors.text, colors), 0, 0)
+}
+
+// fillPage paints the background of the current page
+func (w *pdfWriter) fillPage(c pdfColor, height float64) {
+	w.pdf.SetFillColor(c.r, c.g, c.b)
+	w.pdf.Rect(0, 0, pdfPageWidth, height, "F")
+}
+
+// fitSize returns the largest font size at which the content of every cell
+// fits the cell, found by bisection
+func (w *pdfWriter) fitSize(n int, cell func(int) ([]docBlock, gridCell), height float64) float64 {
+	fits := func(size float64) bool {
+		for i := 0; i < n; i++ {
+			blocks, area := cell(i)
+			width, h := measure(w.layout(blocks, 0, 0, area.w, size, w.colors.text, w.colors))
+			if width > area.w+0.01 || h > area.h+0.01 {
+				return false
+			}
+		}
+		return true
+	}
+
+	lo, hi := pdfMinFont, height
+	if !fits(lo) {
+		return lo
+	}
+	for hi-lo > 0.5 {
+		mid := (lo + hi) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// drawCentered draws blocks centered in a cell, with their lines aligned on
+// the left
+func (w *pdfWriter) drawCentered(blocks []docBlock, cell gridCell, size float64, colors pdfColors) {
+	items := w.layout(blocks, 0, 0, cell.w, size, colors.text, colors)
+	width, height := measure(items)
+	w.draw(items, cell.x+math.Max(0, cell.w-width)/2, cell.y+math.Max(0, cell.h-height)/2)
+}
+
+// measure returns the size of laid out items
+func measure(items []pdfItem) (float64, float64) {
+	width, height := 0.0, 0.0
+	for _, item := range items {
+		width = math.Max(width, item.x+item.w)
+		height = math.Max(height, item.y+item.h)
+		if item.text != "" {
+			// Text is positioned by its baseline; leave room for descenders
+			height = math.Max(height, item.y+item.size*(pdfLineHeight-0.8))
+		}
+	}
+	return width, height
+}
+
+// draw draws laid out items offset by (dx, dy)
+func (w *pdfWriter) draw(items []pdfItem, dx, dy float64) {
+	for _, item := range items {
+		x, y := item.x+dx, item.y+dy
+		switch {
+		case item.image != "":
+			w.pdf.ImageOptions(item.image, x, y, item.w, item.h, false, fpdf.ImageOptions{}, 0, "")
+		case item.line:
+			w.pdf.SetDrawColor(item.color.r, item.color.g, item.color.b)
+			w.pdf.SetLineWidth(math.Max(0.5, item.size))
+			w.pdf.Line(x, y, x+item.w, y+item.h)
+		case item.fill:
+			w.pdf.SetFillColor(item.color.r, item.color.g, item.color.b)
+			w.pdf.Rect(x, y, item.w, item.h, "F")
+		case item.text != "":
+			if font := fmt.Sprint(item.family, item.style, item.size); font != w.font {
+				w.pdf.SetFont(item.family, item.style, item.size)
+				w.font = font
+			}
+			w.pdf.SetTextColor(item.color.r, item.color.g, item.color.b)
+			w.pdf.Text(x, y, w.convert(item.family, item.text))
+			if item.link != "" {
+				w.pdf.LinkString(x, y-item.size*0.8, item.w, item.size, item.link)
+			}
+		}
+	}
+}
+
+// convert encodes text for a font family, warning about characters that
+// the core fonts cannot show
+func (w *pdfWriter) convert(family, s string) string {
+	if family == pdfFontFamily {
+		return s // TrueType fonts are Unicode
+	}
+	encoded := w.encode(s)
+	// Characters outside of Windows-1252 become dots
+	if strings.Count(encoded, ".") > strings.Count(s, ".") {
+		w.g.addDiagnostic(parserPkg.SeverityWarning, "%q has characters that the built-in PDF fonts cannot show; declare a TrueType font to use them", s)
+	}
+	return encoded
+}
+
+// textWidth returns the width of text in a font
+func (w *pdfWriter) textWidth(family, style string, size float64, s string) float64 {
+	key := family + "\x00" + style + "\x00" + s
+	width, ok := w.widths[key]
+	if !ok {
+		w.metrics.SetFont(family, style, 1)
+		width = w.metrics.GetStringWidth(w.convert(family, s))
+		w.widths[key] = width
+	}
+	return width * size
+}
+
+// layout lays out blocks in a column of the given width starting at (x, y)
+// with body text of the given size
+func (w *pdfWriter) layout(blocks []docBlock, x, y, width, size float64, color pdfColor, colors pdfColors) []pdfItem {
+	l := &pdfLayout{w: w, colors: colors, items: nil}
+	l.blocks(blocks, x, y, width, size, color, 0)
+	return l.items
+}
+
+// pdfLayout collects the items of laid out blocks
+type pdfLayout struct {
+	w      *pdfWriter
+	colors pdfColors
+	items  []pdfItem
+}
+
+// blocks lays out blocks from top to bottom and returns the y below them
+func (l *pdfLayout) blocks(blocks []docBlock, x, y, width, size float64, color pdfColor, depth int) float64 {
+	for i, block := range blocks {
+		if i > 0 {
+			y += size * 0.4
+		}
+		y = l.block(block, x, y, width, size, color, depth)
+	}
+	return y
+}
+
+// block lays out a block and returns the y below it
+func (l *pdfLayout) block(block docBlock, x, y, width, size float64, color pdfColor, depth int) float64 {
+	switch block.kind {
+	case docHeading:
+		scale := headingScale[min(max(block.level, 1), len(headingScale))-1]
+		return l.text(block.spans, x, y, width, size*scale, color)
+	case docParagraph:
+		return l.text(block.spans, x, y, width, size, color)
+	case docList:
+		indent := size * 1.4
+		for i, item := range block.items {
+			if i > 0 {
+				y += size * 0.2
+			}
+			marker := listMarker(block, i, depth)
+			markerWidth := l.w.textWidth(l.w.family, l.w.style, size, marker)
+			l.items = append(l.items, pdfItem{
+				x: x + indent - markerWidth - size*0.4, y: y + size, w: markerWidth,
+				text: marker, family: l.w.family, style: l.w.style, size: size, color: color,
+			})
+			bottom := y + size*pdfLineHeight
+			if len(item.spans) > 0 {
+				bottom = l.text(item.spans, x+indent, y, width-indent, size, color)
+			}
+			if len(item.children) > 0 {
+				bottom = l.blocks(item.children, x+indent, bottom+size*0.2, width-indent, size, color, depth+1)
+			}
+			y = bottom
+		}
+		return y
+	case docCode:
+		codeSize := size * 0.8
+		pad := codeSize * 0.5
+		lines := strings.Split(block.code, "\n")
+		widest := 0.0
+		for _, line := range lines {
+			widest = math.Max(widest, l.w.textWidth("Courier", "", codeSize, expandTabs(line)))
+		}
+		height := float64(len(lines))*codeSize*pdfLineHeight + 2*pad
+		l.items = append(l.items, pdfItem{x: x, y: y, w: widest + 2*pad, h: height, fill: true, color: l.colors.background.mix(color, 0.1)})
+		for i, line := range lines {
+			if line == "" {
+				continue
+			}
+			l.items = append(l.items, pdfItem{
+				x: x + pad, y: y + pad + float64(i)*codeSize*pdfLineHeight + codeSize, w: 0,
+				text: expandTabs(line), family: "Courier", size: codeSize, color: color,
+			})
+		}
+		return y + height
+	case docQuote:
+		indent := size
+		bottom := l.blocks(block.children, x+indent, y, width-indent, size, color, depth)
+		l.items = append(l.items, pdfItem{x: x, y: y, w: size * 0.15, h: bottom - y, fill: true, color: color.mix(l.colors.background, 0.5)})
+		return bottom
+	case docImage:
+		return l.image(block, x, y, width, size)
+	case docTable:
+		return l.table(block, x, y, width, size, color)
+	case docRule:
+		l.items = append(l.items, pdfItem{x: x, y: y + size/2, w: width, line: true, size: size * 0.05, color: color})
+		return y + size
+	}
+	return y
+}
+
+// image lays out an image among text, as tall as a few lines of text
+func (l *pdfLayout) image(block docBlock, x, y, width, size float64) float64 {
+	name, info := l.w.loadImage(block.src)
+	if info == nil {
+		if block.alt == "" {
+			return y
+		}
+		return l.text([]docSpan{{text: block.alt}}, x, y, width, size, l.colors.text)
+	}
+	h := size * 6
+	w := h * info.Width() / info.Height()
+	if w > width {
+		w, h = width, width*info.Height()/info.Width()
+	}
+	l.items = append(l.items, pdfItem{x: x, y: y, w: w, h: h, image: name})
+	return y + h
+}
+
+// table lays out a table with columns as wide as their widest cell, shrunk
+// to the available width if needed
+func (l *pdfLayout) table(block docBlock, x, y, width, size float64, color pdfColor) float64 {
+	columns := 0
+	for _, row := range block.rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 {
+		return y
+	}
+
+	pad := size * 0.3
+	widths := make([]float64, columns)
+	for _, row := range block.rows {
+		for c, cell := range row {
+			widths[c] = math.Max(widths[c], l.spansWidth(cell, size)+2*pad)
+		}
+	}
+	if total := sum(widths); total > width {
+		for c := range widths {
+			widths[c] *= width / total
+		}
+	}
+
+	border := color.mix(l.colors.background, 0.6)
+	for r, row := range block.rows {
+		bottom := y + size*pdfLineHeight
+		cx := x
+		for c := 0; c < columns; c++ {
+			if c < len(row) {
+				bottom = math.Max(bottom, l.text(row[c], cx+pad, y+pad, widths[c]-2*pad, size, color)+pad)
+			}
+			cx += widths[c]
+		}
+		if r == 0 {
+			bottom += pad
+		}
+		l.items = append(l.items, pdfItem{x: x, y: bottom, w: sum(widths), line: true, size: size * 0.04, color: border})
+		y = bottom
+	}
+	return y
+}
+
+// spansWidth returns the width of spans on a single line
+func (l *pdfLayout) spansWidth(spans []docSpan, size float64) float64 {
+	width := 0.0
+	for _, span := range spans {
+		family, style := l.spanFont(span)
+		width += l.w.textWidth(family, style, size, span.text)
+	}
+	return width
+}
+
+// spanFont returns the font family and style of a span
+func (l *pdfLayout) spanFont(span docSpan) (string, string) {
+	if span.code {
+		return "Courier", "B"
+	}
+	return l.w.family, l.w.style
+}
+
+// spanColor returns the color of a span
+func (l *pdfLayout) spanColor(span docSpan, color pdfColor) pdfColor {
+	switch {
+	case span.link != "":
+		return l.colors.link
+	case span.emphasis && l.colors.emphasis != nil:
+		return *l.colors.emphasis
+	}
+	return color
+}
+
+// pdfWord is a word of text with the style of its span
+type pdfWord struct {
+	span  docSpan
+	text  string
+	width float64
+	space bool // Whether a space separates the word from the next one
+	brk   bool // Whether a line break follows the word
+}
+
+// text lays out styled text, wrapping lines at spaces, and returns the y
+// below it
+func (l *pdfLayout) text(spans []docSpan, x, y, width, size float64, color pdfColor) float64 {
+	var words []pdfWord
+	for _, span := range spans {
+		family, style := l.spanFont(span)
+		for i, line := range strings.Split(span.text, "\n") {
+			if i > 0 && len(words) > 0 {
+				words[len(words)-1].brk = true
+			}
+			if strings.TrimLeft(line, " \t") != line && len(words) > 0 {
+				words[len(words)-1].space = true
+			}
+			fields := strings.Fields(line)
+			for j, field := range fields {
+				words = append(words, pdfWord{
+					span:  span,
+					text:  field,
+					width: l.w.textWidth(family, style, size, field),
+					space: j < len(fields)-1 || strings.TrimRight(line, " \t") != line,
+				})
+			}
+		}
+	}
+
+	space := l.w.textWidth(l.w.family, l.w.style, size, " ")
+	lineHeight := size * pdfLineHeight
+	cx, baseline := x, y+size
+	for i, word := range words {
+		if cx > x && cx+word.width > x+width {
+			cx, baseline = x, baseline+lineHeight
+		}
+		family, style := l.spanFont(word.span)
+		l.items = append(l.items, pdfItem{
+			x: cx, y: baseline, w: word.width,
+			text: word.text, family: family, style: style, size: size,
+			color: l.spanColor(word.span, color), link: word.span.link,
+		})
+		cx += word.width
+		if word.space {
+			cx += space
+		}
+		if word.brk && i < len(words)-1 {
+			cx, baseline = x, baseline+lineHeight
+		}
+	}
+	return baseline - size + lineHeight
+}
+
+// loadImage registers a local image with the PDF and returns its name and
+// size, or a nil size if it cannot be used
+func (w *pdfWriter) loadImage(src string) (string, *fpdf.ImageInfoType) {
+	if info, ok := w.images[src]; ok {
+		return src, info
+	}
+	w.images[src] = nil
+
+	if strings.Contains(src, "://") || strings.HasPrefix(src, "data:") {
+		w.g.addDiagnostic(parserPkg.SeverityWarning, "image %s is not embedded in the PDF; only local images are", abbreviate(src))
+		return src, nil
+	}
+
+	path := src
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(w.g.imageDir(), path)
+	}
+	if w.g.refusePath(path, src) {
+		return src, nil
+	}
+	w.g.addDependency(path)
+
+	var imageType string
+	switch detectContentType(path) {
+	case "image/jpeg":
+		imageType = "JPG"
+	case "image/png":
+		imageType = "PNG"
+	case "image/gif":
+		imageType = "GIF"
+	default:
+		w.g.addDiagnostic(parserPkg.SeverityWarning, "image %s is not embedded in the PDF; only JPEG, PNG and GIF images are", src)
+		return src, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		w.g.addDiagnostic(parserPkg.SeverityWarning, "failed to read image %s: %v", src, err)
+		return src, nil
+	}
+	data = w.g.optimizeImage(path, data).data
+	info := w.pdf.RegisterImageOptionsReader(src, fpdf.ImageOptions{ImageType: imageType}, bytes.NewReader(data))
+	if w.pdf.Err() {
+		w.g.addDiagnostic(parserPkg.SeverityWarning, "image %s cannot be embedded in the PDF: %v", src, w.pdf.Error())
+		w.pdf.ClearError()
+		return src, nil
+	}
+	if info.Width() <= 0 || info.Height() <= 0 {
+		return src, nil
+	}
+	w.images[src] = info
+	return src, info
+}
+
+// drawImage draws an image as large as it fits in a cell, centered
+func (w *pdfWriter) drawImage(block docBlock, cell gridCell) {
+	name, info := w.loadImage(block.src)
+	if info == nil {
+		return
+	}
+	scale := math.Min(cell.w/info.Width(), cell.h/info.Height())
+	iw, ih := info.Width()*scale, info.Height()*scale
+	w.pdf.ImageOptions(name, cell.x+(cell.w-iw)/2, cell.y+(cell.h-ih)/2, iw, ih, false, fpdf.ImageOptions{}, 0, "")
+}
+
+// expandTabs replaces tabs with four spaces, as Courier has no tab glyph
+func expandTabs(s string) string {
+	return strings.ReplaceAll(s, "\t", "    ")
+}
+
+// abbreviate shortens long strings, such as data URIs, for messages
+func abbreviate(s string) string {
+	if len(s) > 60 {
+		return s[:57] + "..."
+	}
+	return s
+}
@@ -0,0 +1,863 @@
+package generator
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	_ "image/gif" // Decoders for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gobig/internal/assets"
+	parserPkg "gobig/internal/parser"
+)
+
+// Namespaces of PresentationML parts
+const (
+	pptxNamespaces = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" ` +
+		`xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"`
+	pptxRelationships = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/"
+	pptxContentType   = "application/vnd.openxmlformats-officedocument.presentationml."
+)
+
+// Geometry and type sizes of PowerPoint output
+const (
+	emuPerPoint    = 12700
+	pptxTitleSize  = 40.0 // Default title size in points
+	pptxBodySize   = 28.0 // Largest body text size in points
+	pptxNotesSize  = 12.0 // Size of speaker notes in points
+	pptxCodeFont   = "Courier New"
+	pptxTitleShare = 0.16 // Fraction of the page height taken by titles
+)
+
+// pptxWriter collects the parts of a PowerPoint package
+type pptxWriter struct {
+	g       *Generator
+	colors  pdfColors
+	font    string // Typeface of all text except code
+	width   float64
+	height  float64
+	parts   []pptxPart
+	types   []string          // Override elements of [Content_Types].xml
+	media   map[string]string // Package path of each embedded image by file path
+	images  map[string]image.Config
+	slides  int
+	notes   bool // Whether any slide has speaker notes
+	shapeID int  // Last shape id used on the current slide
+	rels    *pptxRels
+}
+
+// pptxPart is a file in the package
+type pptxPart struct {
+	name string
+	data []byte
+}
+
+// pptxRels collects the relationships of a part
+type pptxRels struct {
+	targets []string // Relationship elements
+	ids     map[string]string
+}
+
+// add returns the id of a relationship, adding it if needed
+func (r *pptxRels) add(kind, target string, external bool) string {
+	key := kind + " " + target
+	if id, ok := r.ids[key]; ok {
+		return id
+	}
+	id := fmt.Sprintf("rId%d", len(r.targets)+1)
+	mode := ""
+	if external {
+		mode = ` TargetMode="External"`
+	}
+	r.targets = append(r.targets, fmt.Sprintf(`<Relationship Id="%s" Type="%s%s" Target="%s"%s/>`, id, pptxRelationships, kind, xmlEscape(target), mode))
+	r.ids[key] = id
+	return id
+}
+
+// xml returns the relationships part
+func (r *pptxRels) xml() string {
+	return xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		strings.Join(r.targets, "") + `</Relationships>`
+}
+
+// newRels returns an empty set of relationships
+func newRels() *pptxRels {
+	return &pptxRels{ids: make(map[string]string)}
+}
+
+// pptxArea is a rectangle of a slide with the content placed in it
+type pptxArea struct {
+	cell   gridCell
+	blocks []docBlock
+}
+
+// GeneratePPTX renders slides to an editable PowerPoint presentation. The
+// first heading of a slide becomes its title and the rest of its content
+// fills a content placeholder, or one per cell for layouts such as 50-50.
+// Images are embedded, speaker notes become PowerPoint notes and, like in
+// PDF output, builds are shown fully revealed.
+func (g *Generator) GeneratePPTX(slides []*parserPkg.Slide) ([]byte, error) {
+	g.begin(slides)
+
+	height, err := pageHeight(g.options.AspectRatio)
+	if err != nil {
+		return nil, err
+	}
+
+	theme, err := assets.LoadThemeWithOptions(g.options.Theme, assets.ThemeOptions{SearchPaths: g.options.ThemePaths, Confine: g.options.Safe})
+	if theme != nil {
+		for _, file := range theme.Files {
+			g.addDependency(file)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get theme: %w", err)
+	}
+
+	w := &pptxWriter{
+		g:      g,
+		colors: themeColors(theme.CSS),
+		font:   "Arial",
+		width:  pdfPageWidth,
+		height: height,
+		media:  make(map[string]string),
+		images: make(map[string]image.Config),
+	}
+	if fonts := g.options.PresentationMetadata.Fonts; len(fonts) > 0 && fonts[0].Family != "" {
+		w.font = fonts[0].Family
+	}
+
+	for _, slide := range slides {
+		g.current = slide
+		w.slide(slide)
+		g.current = nil
+	}
+
+	if errors := g.countErrors(); errors > 0 {
+		return nil, fmt.Errorf("%d problem(s) found", errors)
+	}
+
+	data, err := w.pack(g.title(slides))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write PowerPoint file: %w", err)
+	}
+	return data, nil
+}
+
+// add adds a part to the package, with an override content type if given
+func (w *pptxWriter) add(name, contentType, data string) {
+	w.parts = append(w.parts, pptxPart{name: name, data: []byte(data)})
+	if contentType != "" {
+		w.types = append(w.types, fmt.Sprintf(`<Override PartName="/%s" ContentType="%s"/>`, name, contentType))
+	}
+}
+
+// slide adds a slide, its relationships and its notes to the package
+func (w *pptxWriter) slide(slide *parserPkg.Slide) {
+	w.slides++
+	n := w.slides
+	w.shapeID = 1
+	w.rels = newRels()
+
+	var parts []string
+	columns, rows, named := []float64(nil), []float64(nil), false
+	if slide.Metadata.Layout != "" {
+		parts = splitContentForLayout(slide.Content)
+		columns, rows, named = layoutGrid(slide.Metadata.Layout)
+		if !named {
+			w.g.addDiagnostic(parserPkg.SeverityWarning, "custom layout %q is exported as a single column", slide.Metadata.Layout)
+			parts = []string{strings.Join(parts, "\n\n")}
+		}
+	} else {
+		parts = []string{slide.Content}
+	}
+	var contents [][]docBlock
+	for _, part := range parts {
+		contents = append(contents, w.g.documentBlocks(part))
+	}
+
+	// The first heading becomes the title, and its cell goes if it was all
+	// the cell held
+	var title []docSpan
+	if len(contents) > 0 && len(contents[0]) > 0 && contents[0][0].kind == docHeading {
+		title = contents[0][0].spans
+		contents[0] = contents[0][1:]
+		if len(contents[0]) == 0 && len(contents) > 1 {
+			contents = contents[1:]
+		}
+	}
+
+	margin := w.width * pdfMargin
+	body := gridCell{x: margin, y: margin, w: w.width - 2*margin, h: w.height - 2*margin}
+	titleArea := gridCell{x: margin, y: margin, w: body.w, h: w.height * pptxTitleShare}
+	if title != nil {
+		body.y += titleArea.h + margin/2
+		body.h -= titleArea.h + margin/2
+	}
+
+	var areas []pptxArea
+	if named {
+		for i, cell := range layoutCells(columns, rows, len(contents)) {
+			areas = append(areas, pptxArea{
+				cell:   gridCell{x: body.x + cell.x*body.w, y: body.y + cell.y*body.h, w: cell.w * body.w, h: cell.h * body.h},
+				blocks: contents[i],
+			})
+		}
+	} else if len(contents) > 0 && len(contents[0]) > 0 {
+		areas = []pptxArea{{cell: body, blocks: contents[0]}}
+	}
+
+	layout := 1 // Title and Content
+	if len(areas) >= 2 {
+		layout = 2 // Two Content
+	}
+	w.rels.add("slideLayout", fmt.Sprintf("../slideLayouts/slideLayout%d.xml", layout), false)
+
+	var shapes strings.Builder
+	if title != nil {
+		shapes.WriteString(w.textShape(`<p:ph type="title"/>`, "Title", nil, w.paragraph(title, pptxTitleSize, "")))
+	}
+	for i, area := range areas {
+		placeholder := ""
+		if i < 2 {
+			placeholder = fmt.Sprintf(`<p:ph idx="%d"/>`, i+1)
+		}
+		shapes.WriteString(w.area(area, placeholder))
+	}
+
+	// Speaker notes
+	if strings.TrimSpace(slide.Notes) != "" {
+		w.notes = true
+		w.rels.add("notesSlide", fmt.Sprintf("../notesSlides/notesSlide%d.xml", n), false)
+		w.notesSlide(slide, n)
+	}
+
+	// Auto-advance: slide-level time overrides presentation-level time
+	transition := ""
+	timeToNext := slide.Metadata.TimeToNext
+	if timeToNext == 0 {
+		timeToNext = w.g.options.PresentationMetadata.TimeToNext
+	}
+	if timeToNext > 0 {
+		transition = fmt.Sprintf(`<p:transition advTm="%d"/>`, timeToNext*1000)
+	}
+
+	w.add(fmt.Sprintf("ppt/slides/slide%d.xml", n), pptxContentType+"slide+xml",
+		xml.Header+`<p:sld `+pptxNamespaces+`><p:cSld><p:spTree>`+pptxGroup+shapes.String()+
+			`</p:spTree></p:cSld><p:clrMapOvr><a:masterClrMapping/></p:clrMapOvr>`+transition+`</p:sld>`)
+	w.add(fmt.Sprintf("ppt/slides/_rels/slide%d.xml.rels", n), "", w.rels.xml())
+}
+
+// pptxEmptyParagraph is the paragraph of a text body with no text, which
+// must have at least one
+const pptxEmptyParagraph = `<a:p><a:endParaRPr lang="en-US"/></a:p>`
+
+// pptxGroup is the group properties every shape tree starts with
+const pptxGroup = `<p:nvGrpSpPr><p:cNvPr id="1" name=""/><p:cNvGrpSpPr/><p:nvPr/></p:nvGrpSpPr>` +
+	`<p:grpSpPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="0" cy="0"/><a:chOff x="0" y="0"/><a:chExt cx="0" cy="0"/></a:xfrm></p:grpSpPr>`
+
+// area returns the shapes of a content area: a text shape, in the given
+// placeholder or as a text box, with the area's images and tables beside
+// the text or filling the area if there is no text
+func (w *pptxWriter) area(area pptxArea, placeholder string) string {
+	var text, objects []docBlock
+	for _, block := range area.blocks {
+		if block.kind == docImage || block.kind == docTable {
+			objects = append(objects, block)
+		} else {
+			text = append(text, block)
+		}
+	}
+
+	textCell, objectCell := area.cell, area.cell
+	if len(text) > 0 && len(objects) > 0 {
+		textCell.w = area.cell.w / 2
+		objectCell.x, objectCell.w = area.cell.x+area.cell.w/2, area.cell.w/2
+	}
+
+	var sb strings.Builder
+	if len(text) > 0 {
+		size := w.fitSize(text, textCell)
+		sb.WriteString(w.textShape(placeholder, "Content", &textCell, w.paragraphs(text, size, 0)))
+	}
+	for i, object := range objects {
+		cell := objectCell
+		cell.h = objectCell.h / float64(len(objects))
+		cell.y = objectCell.y + float64(i)*cell.h
+		// An image or table alone fills the placeholder, like one inserted
+		// into it in PowerPoint
+		nvPr := "<p:nvPr/>"
+		if i == 0 && len(text) == 0 && placeholder != "" {
+			nvPr = "<p:nvPr>" + placeholder + "</p:nvPr>"
+		}
+		if object.kind == docImage {
+			sb.WriteString(w.picture(object, cell, nvPr))
+		} else {
+			sb.WriteString(w.table(object, cell, nvPr))
+		}
+	}
+	return sb.String()
+}
+
+// nextID returns a new shape id for the current slide
+func (w *pptxWriter) nextID() int {
+	w.shapeID++
+	return w.shapeID
+}
+
+// textShape returns a shape with paragraphs of text, in a placeholder if
+// one is given and at the position of cell if it is not nil
+func (w *pptxWriter) textShape(placeholder, name string, cell *gridCell, paragraphs string) string {
+	if paragraphs == "" {
+		paragraphs = pptxEmptyParagraph
+	}
+	id := w.nextID()
+	nonVisual := fmt.Sprintf(`<p:cNvPr id="%d" name="%s %d"/>`, id, name, id)
+	if placeholder != "" {
+		nonVisual += `<p:cNvSpPr><a:spLocks noGrp="1"/></p:cNvSpPr><p:nvPr>` + placeholder + `</p:nvPr>`
+	} else {
+		nonVisual += `<p:cNvSpPr txBox="1"/><p:nvPr/>`
+	}
+	shape := ""
+	if cell != nil {
+		shape = xfrm(*cell)
+		if placeholder == "" {
+			shape += `<a:prstGeom prst="rect"><a:avLst/></a:prstGeom>`
+		}
+	}
+	return `<p:sp><p:nvSpPr>` + nonVisual + `</p:nvSpPr><p:spPr>` + shape + `</p:spPr>` +
+		`<p:txBody><a:bodyPr wrap="square"><a:normAutofit/></a:bodyPr><a:lstStyle/>` + paragraphs + `</p:txBody></p:sp>`
+}
+
+// xfrm returns the position and size of a shape
+func xfrm(cell gridCell) string {
+	return fmt.Sprintf(`<a:xfrm><a:off x="%d" y="%d"/><a:ext cx="%d" cy="%d"/></a:xfrm>`, emu(cell.x), emu(cell.y), emu(cell.w), emu(cell.h))
+}
+
+// emu converts points to English Metric Units
+func emu(points float64) int64 {
+	return int64(math.Round(points * emuPerPoint))
+}
+
+// paragraphs returns DrawingML paragraphs for blocks, with list items
+// indented by level
+func (w *pptxWriter) paragraphs(blocks []docBlock, size float64, level int) string {
+	var sb strings.Builder
+	indent := 0.0
+	if level > 0 {
+		indent = float64(level) * size * 1.4
+	}
+	plain := fmt.Sprintf(`<a:pPr marL="%d" indent="0"><a:buNone/></a:pPr>`, emu(indent))
+
+	for _, block := range blocks {
+		switch block.kind {
+		case docHeading:
+			scale := headingScale[min(max(block.level, 1), len(headingScale))-1]
+			sb.WriteString(w.paragraph(block.spans, size*scale, plain))
+		case docParagraph:
+			sb.WriteString(w.paragraph(block.spans, size, plain))
+		case docList:
+			sb.WriteString(w.list(block, size, level))
+		case docCode:
+			for _, line := range strings.Split(block.code, "\n") {
+				sb.WriteString(w.paragraph([]docSpan{{text: expandTabs(line), code: true}}, size*0.8, plain))
+			}
+		case docQuote:
+			sb.WriteString(w.paragraphs(block.children, size, level+1))
+		case docTable:
+			// Tables among other blocks, such as in a quote, become lines of
+			// tab-separated cells
+			for _, row := range block.rows {
+				var spans []docSpan
+				for i, cell := range row {
+					if i > 0 {
+						spans = append(spans, docSpan{text: "\t"})
+					}
+					spans = append(spans, cell...)
+				}
+				sb.WriteString(w.paragraph(spans, size, plain))
+			}
+		case docImage:
+			if block.alt != "" {
+				sb.WriteString(w.paragraph([]docSpan{{text: block.alt}}, size, plain))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// list returns the paragraphs of a list and its nested blocks
+func (w *pptxWriter) list(block docBlock, size float64, level int) string {
+	var sb strings.Builder
+	indent := size * 1.4
+	for i, item := range block.items {
+		bullet := fmt.Sprintf(`<a:buChar char="%s"/>`, xmlEscape(listMarker(block, i, level)))
+		if block.ordered {
+			bullet = `<a:buAutoNum type="arabicPeriod"/>`
+			if block.start > 1 {
+				bullet = fmt.Sprintf(`<a:buAutoNum type="arabicPeriod" startAt="%d"/>`, block.start)
+			}
+		}
+		properties := fmt.Sprintf(`<a:pPr marL="%d" lvl="%d" indent="%d">%s</a:pPr>`,
+			emu(float64(level+1)*indent), min(level, 8), -emu(indent), bullet)
+		sb.WriteString(w.paragraph(item.spans, size, properties))
+		sb.WriteString(w.paragraphs(item.children, size, level+1))
+	}
+	return sb.String()
+}
+
+// paragraph returns a paragraph of styled runs of text at the given size
+func (w *pptxWriter) paragraph(spans []docSpan, size float64, properties string) string {
+	var sb strings.Builder
+	sb.WriteString("<a:p>")
+	sb.WriteString(properties)
+	for _, span := range mergeSpans(spans) {
+		for i, line := range strings.Split(span.text, "\n") {
+			if i > 0 {
+				sb.WriteString("<a:br/>")
+			}
+			if line != "" {
+				sb.WriteString(w.run(span, line, size))
+			}
+		}
+	}
+	sb.WriteString(fmt.Sprintf(`<a:endParaRPr lang="en-US" sz="%d"/></a:p>`, int(math.Round(size*100))))
+	return sb.String()
+}
+
+// run returns a run of text with the style of a span
+func (w *pptxWriter) run(span docSpan, text string, size float64) string {
+	var attrs, children strings.Builder
+	attrs.WriteString(fmt.Sprintf(`lang="en-US" sz="%d"`, int(math.Round(size*100))))
+	if span.link != "" {
+		attrs.WriteString(` u="sng"`)
+	} else if span.emphasis && w.colors.emphasis != nil {
+		children.WriteString(`<a:solidFill>` + srgb(*w.colors.emphasis) + `</a:solidFill>`)
+	}
+	if span.code {
+		children.WriteString(fmt.Sprintf(`<a:latin typeface="%s"/>`, pptxCodeFont))
+	}
+	if span.link != "" {
+		id := w.rels.add("hyperlink", span.link, true)
+		children.WriteString(fmt.Sprintf(`<a:hlinkClick r:id="%s"/>`, id))
+	}
+	return fmt.Sprintf(`<a:r><a:rPr %s>%s</a:rPr><a:t>%s</a:t></a:r>`, attrs.String(), children.String(), xmlEscape(text))
+}
+
+// fitSize returns the largest body text size up to pptxBodySize at which
+// blocks are estimated to fit a cell, so that the deck looks right before
+// PowerPoint applies its own autofit
+func (w *pptxWriter) fitSize(blocks []docBlock, cell gridCell) float64 {
+	for size := pptxBodySize; size > pdfMinFont; size-- {
+		if estimateHeight(blocks, size, cell.w*0.9) <= cell.h*0.9 {
+			return size
+		}
+	}
+	return pdfMinFont
+}
+
+// estimateHeight estimates the height of blocks at a text size from the
+// number of characters on each line, assuming bold characters average
+// 0.6em wide
+func estimateHeight(blocks []docBlock, size, width float64) float64 {
+	lines := func(text string, size, width float64) float64 {
+		count := 0.0
+		for _, line := range strings.Split(text, "\n") {
+			count += math.Max(1, math.Ceil(float64(len([]rune(line)))*0.6*size/math.Max(width, size)))
+		}
+		return count
+	}
+
+	height := 0.0
+	for _, block := range blocks {
+		switch block.kind {
+		case docHeading:
+			scale := headingScale[min(max(block.level, 1), len(headingScale))-1]
+			height += lines(spansText(block.spans), size*scale, width) * size * scale * pdfLineHeight
+		case docParagraph:
+			height += lines(spansText(block.spans), size, width) * size * pdfLineHeight
+		case docList:
+			for _, item := range block.items {
+				height += lines(spansText(item.spans), size, width-size*1.4) * size * pdfLineHeight
+				height += estimateHeight(item.children, size, width-size*1.4)
+			}
+		case docCode:
+			height += float64(strings.Count(block.code, "\n")+1) * size * 0.8 * pdfLineHeight
+		case docQuote:
+			height += estimateHeight(block.children, size, width-size*1.4)
+		case docTable:
+			height += float64(len(block.rows)) * size * pdfLineHeight
+		}
+	}
+	return height
+}
+
+// picture returns a picture shape showing an image as large as it fits in
+// a cell, or nothing if the image cannot be embedded
+func (w *pptxWriter) picture(block docBlock, cell gridCell, nvPr string) string {
+	target, config, ok := w.loadImage(block.src)
+	if !ok {
+		return ""
+	}
+	id := w.rels.add("image", target, false)
+
+	scale := math.Min(cell.w/float64(config.Width), cell.h/float64(config.Height))
+	iw, ih := float64(config.Width)*scale, float64(config.Height)*scale
+	box := gridCell{x: cell.x + (cell.w-iw)/2, y: cell.y + (cell.h-ih)/2, w: iw, h: ih}
+
+	shapeID := w.nextID()
+	return fmt.Sprintf(`<p:pic><p:nvPicPr><p:cNvPr id="%d" name="Picture %d" descr="%s"/><p:cNvPicPr><a:picLocks noGrp="1" noChangeAspect="1"/></p:cNvPicPr>%s</p:nvPicPr>`,
+		shapeID, shapeID, xmlEscape(block.alt), nvPr) +
+		fmt.Sprintf(`<p:blipFill><a:blip r:embed="%s"/><a:stretch><a:fillRect/></a:stretch></p:blipFill>`, id) +
+		`<p:spPr>` + xfrm(box) + `<a:prstGeom prst="rect"><a:avLst/></a:prstGeom></p:spPr></p:pic>`
+}
+
+// loadImage embeds a local image in the package and returns its target
+// relative to a slide and its size, reporting images that cannot be used
+func (w *pptxWriter) loadImage(src string) (string, image.Config, bool) {
+	if strings.Contains(src, "://") || strings.HasPrefix(src, "data:") {
+		w.g.addDiagnostic(parserPkg.SeverityWarning, "image %s is not embedded in the PowerPoint file; only local images are", abbreviate(src))
+		return "", image.Config{}, false
+	}
+
+	path := src
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(w.g.imageDir(), path)
+	}
+	if w.g.refusePath(path, src) {
+		return "", image.Config{}, false
+	}
+	w.g.addDependency(path)
+	if name, ok := w.media[path]; ok {
+		return "../media/" + name, w.images[path], true
+	}
+
+	ext := ""
+	switch detectContentType(path) {
+	case "image/jpeg":
+		ext = "jpeg"
+	case "image/png":
+		ext = "png"
+	case "image/gif":
+		ext = "gif"
+	default:
+		w.g.addDiagnostic(parserPkg.SeverityWarning, "image %s is not embedded in the PowerPoint file; only JPEG, PNG and GIF images are", src)
+		return "", image.Config{}, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		w.g.addDiagnostic(parserPkg.SeverityWarning, "failed to read image %s: %v", src, err)
+		return "", image.Config{}, false
+	}
+	data = w.g.optimizeImage(path, data).data
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		w.g.addDiagnostic(parserPkg.SeverityWarning, "image %s cannot be embedded in the PowerPoint file: %v", src, err)
+		return "", image.Config{}, false
+	}
+
+	name := fmt.Sprintf("image%d.%s", len(w.media)+1, ext)
+	w.media[path] = name
+	w.images[path] = config
+	w.parts = append(w.parts, pptxPart{name: "ppt/media/" + name, data: data})
+	return "../media/" + name, config, true
+}
+
+// table returns a table shape filling the width of a cell
+func (w *pptxWriter) table(block docBlock, cell gridCell, nvPr string) string {
+	columns := 0
+	for _, row := range block.rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 {
+		return ""
+	}
+
+	size := math.Min(pptxBodySize*0.75, cell.h/float64(len(block.rows))/pdfLineHeight/1.6)
+	rowHeight := size * pdfLineHeight * 1.6
+	var sb strings.Builder
+	sb.WriteString(`<a:tbl><a:tblPr firstRow="1" bandRow="1"/><a:tblGrid>`)
+	for i := 0; i < columns; i++ {
+		sb.WriteString(fmt.Sprintf(`<a:gridCol w="%d"/>`, emu(cell.w/float64(columns))))
+	}
+	sb.WriteString(`</a:tblGrid>`)
+	border := `<a:lnB w="12700"><a:solidFill>` + srgb(w.colors.text.mix(w.colors.background, 0.6)) + `</a:solidFill></a:lnB>`
+	for _, row := range block.rows {
+		sb.WriteString(fmt.Sprintf(`<a:tr h="%d">`, emu(rowHeight)))
+		for c := 0; c < columns; c++ {
+			var spans []docSpan
+			if c < len(row) {
+				spans = row[c]
+			}
+			sb.WriteString(`<a:tc><a:txBody><a:bodyPr/><a:lstStyle/>` + w.paragraph(spans, size, "") + `</a:txBody><a:tcPr>` + border + `</a:tcPr></a:tc>`)
+		}
+		sb.WriteString(`</a:tr>`)
+	}
+	sb.WriteString(`</a:tbl>`)
+
+	box := cell
+	box.h = math.Min(cell.h, rowHeight*float64(len(block.rows)))
+	box.y = cell.y + (cell.h-box.h)/2
+	id := w.nextID()
+	return fmt.Sprintf(`<p:graphicFrame><p:nvGraphicFramePr><p:cNvPr id="%d" name="Table %d"/><p:cNvGraphicFramePr><a:graphicFrameLocks noGrp="1"/></p:cNvGraphicFramePr>%s</p:nvGraphicFramePr>`, id, id, nvPr) +
+		fmt.Sprintf(`<p:xfrm><a:off x="%d" y="%d"/><a:ext cx="%d" cy="%d"/></p:xfrm>`, emu(box.x), emu(box.y), emu(box.w), emu(box.h)) +
+		`<a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/table">` + sb.String() + `</a:graphicData></a:graphic></p:graphicFrame>`
+}
+
+// notesSlide adds the notes page of a slide
+func (w *pptxWriter) notesSlide(slide *parserPkg.Slide, n int) {
+	slideRels := w.rels
+	w.rels = newRels()
+	w.rels.add("notesMaster", "../notesMasters/notesMaster1.xml", false)
+	w.rels.add("slide", fmt.Sprintf("../slides/slide%d.xml", n), false)
+
+	var paragraphs string
+	if w.g.options.PlainNotes {
+		for _, line := range strings.Split(strings.TrimSpace(slide.Notes), "\n") {
+			paragraphs += w.paragraph([]docSpan{{text: line}}, pptxNotesSize, "")
+		}
+	} else {
+		paragraphs = w.paragraphs(w.g.documentBlocks(slide.Notes), pptxNotesSize, 0)
+	}
+	if paragraphs == "" {
+		paragraphs = pptxEmptyParagraph
+	}
+
+	w.add(fmt.Sprintf("ppt/notesSlides/notesSlide%d.xml", n), pptxContentType+"notesSlide+xml",
+		xml.Header+`<p:notes `+pptxNamespaces+`><p:cSld><p:spTree>`+pptxGroup+
+			`<p:sp><p:nvSpPr><p:cNvPr id="2" name="Slide Image Placeholder 1"/><p:cNvSpPr><a:spLocks noGrp="1" noRot="1" noChangeAspect="1"/></p:cNvSpPr><p:nvPr><p:ph type="sldImg"/></p:nvPr></p:nvSpPr><p:spPr/></p:sp>`+
+			`<p:sp><p:nvSpPr><p:cNvPr id="3" name="Notes Placeholder 2"/><p:cNvSpPr><a:spLocks noGrp="1"/></p:cNvSpPr><p:nvPr><p:ph type="body" idx="1"/></p:nvPr></p:nvSpPr><p:spPr/>`+
+			`<p:txBody><a:bodyPr/><a:lstStyle/>`+paragraphs+`</p:txBody></p:sp>`+
+			`</p:spTree></p:cSld><p:clrMapOvr><a:masterClrMapping/></p:clrMapOvr></p:notes>`)
+	w.add(fmt.Sprintf("ppt/notesSlides/_rels/notesSlide%d.xml.rels", n), "", w.rels.xml())
+	w.rels = slideRels
+}
+
+// pack adds the presentation, master, layouts and theme to the slides and
+// zips the package
+func (w *pptxWriter) pack(title string) ([]byte, error) {
+	rels := newRels()
+	rels.add("slideMaster", "slideMasters/slideMaster1.xml", false)
+	slideIDs := ""
+	for n := 1; n <= w.slides; n++ {
+		id := rels.add("slide", fmt.Sprintf("slides/slide%d.xml", n), false)
+		slideIDs += fmt.Sprintf(`<p:sldId id="%d" r:id="%s"/>`, 255+n, id)
+	}
+	if slideIDs != "" {
+		slideIDs = "<p:sldIdLst>" + slideIDs + "</p:sldIdLst>"
+	}
+	notesMaster := ""
+	if w.notes {
+		notesMaster = fmt.Sprintf(`<p:notesMasterIdLst><p:notesMasterId r:id="%s"/></p:notesMasterIdLst>`,
+			rels.add("notesMaster", "notesMasters/notesMaster1.xml", false))
+	}
+	rels.add("theme", "theme/theme1.xml", false)
+	rels.add("presProps", "presProps.xml", false)
+	rels.add("viewProps", "viewProps.xml", false)
+	rels.add("tableStyles", "tableStyles.xml", false)
+
+	w.add("ppt/presentation.xml", pptxContentType+"presentation.main+xml",
+		xml.Header+`<p:presentation `+pptxNamespaces+` saveSubsetFonts="1">`+
+			`<p:sldMasterIdLst><p:sldMasterId id="2147483648" r:id="rId1"/></p:sldMasterIdLst>`+notesMaster+slideIDs+
+			fmt.Sprintf(`<p:sldSz cx="%d" cy="%d"/><p:notesSz cx="6858000" cy="9144000"/>`, emu(w.width), emu(w.height))+
+			`</p:presentation>`)
+	w.add("ppt/_rels/presentation.xml.rels", "", rels.xml())
+	w.add("ppt/presProps.xml", pptxContentType+"presProps+xml", xml.Header+`<p:presentationPr `+pptxNamespaces+`/>`)
+	w.add("ppt/viewProps.xml", pptxContentType+"viewProps+xml", xml.Header+`<p:viewPr `+pptxNamespaces+`/>`)
+	w.add("ppt/tableStyles.xml", pptxContentType+"tableStyles+xml",
+		xml.Header+`<a:tblStyleLst xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" def="{5C22544A-7EE6-4342-B048-85BDC9FD1C3A}"/>`)
+
+	w.master()
+	w.add("ppt/theme/theme1.xml", "application/vnd.openxmlformats-officedocument.theme+xml", w.theme(w.colors))
+	if w.notes {
+		w.notesMaster()
+		w.add("ppt/theme/theme2.xml", "application/vnd.openxmlformats-officedocument.theme+xml", w.theme(pdfColors{
+			background: pdfColor{255, 255, 255},
+			text:       pdfColor{0, 0, 0},
+			link:       w.colors.link,
+		}))
+	}
+
+	w.add("docProps/core.xml", "application/vnd.openxmlformats-package.core-properties+xml",
+		xml.Header+`<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/">`+
+			`<dc:title>`+xmlEscape(title)+`</dc:title><dc:creator>gobig</dc:creator></cp:coreProperties>`)
+	w.add("docProps/app.xml", "application/vnd.openxmlformats-officedocument.extended-properties+xml",
+		xml.Header+`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties">`+
+			fmt.Sprintf(`<Application>gobig</Application><Slides>%d</Slides></Properties>`, w.slides))
+
+	root := newRels()
+	root.add("officeDocument", "ppt/presentation.xml", false)
+	root.targets = append(root.targets,
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>`,
+		`<Relationship Id="rId3" Type="`+pptxRelationships+`extended-properties" Target="docProps/app.xml"/>`)
+
+	contentTypes := xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Default Extension="png" ContentType="image/png"/>` +
+		`<Default Extension="jpeg" ContentType="image/jpeg"/>` +
+		`<Default Extension="gif" ContentType="image/gif"/>` +
+		strings.Join(w.types, "") + `</Types>`
+
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	files := append([]pptxPart{
+		{name: "[Content_Types].xml", data: []byte(contentTypes)},
+		{name: "_rels/.rels", data: []byte(root.xml())},
+	}, w.parts...)
+	for _, file := range files {
+		f, err := z.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// master adds the slide master, which carries the theme's background and
+// text styles, and its Title and Content and Two Content layouts
+func (w *pptxWriter) master() {
+	margin := w.width * pdfMargin
+	titleArea := gridCell{x: margin, y: margin, w: w.width - 2*margin, h: w.height * pptxTitleShare}
+	body := gridCell{x: margin, y: margin + titleArea.h + margin/2, w: titleArea.w}
+	body.h = w.height - margin - body.y
+	left, right := body, body
+	left.w = body.w / 2
+	right.x, right.w = body.x+body.w/2, body.w/2
+
+	placeholder := func(id int, name, ph string, cell gridCell, prompt string) string {
+		return fmt.Sprintf(`<p:sp><p:nvSpPr><p:cNvPr id="%d" name="%s"/><p:cNvSpPr><a:spLocks noGrp="1"/></p:cNvSpPr><p:nvPr>%s</p:nvPr></p:nvSpPr>`, id, name, ph) +
+			`<p:spPr>` + xfrm(cell) + `<a:prstGeom prst="rect"><a:avLst/></a:prstGeom></p:spPr>` +
+			`<p:txBody><a:bodyPr><a:normAutofit/></a:bodyPr><a:lstStyle/><a:p><a:r><a:rPr lang="en-US"/><a:t>` + prompt + `</a:t></a:r></a:p></p:txBody></p:sp>`
+	}
+
+	var levels strings.Builder
+	for level := 1; level <= 9; level++ {
+		levels.WriteString(fmt.Sprintf(`<a:lvl%dpPr marL="0" indent="0"><a:spcBef><a:spcPts val="600"/></a:spcBef><a:buNone/><a:defRPr sz="%d" b="1"><a:solidFill><a:schemeClr val="tx1"/></a:solidFill><a:latin typeface="+mn-lt"/></a:defRPr></a:lvl%dpPr>`,
+			level, int(pptxBodySize*100), level))
+	}
+
+	w.add("ppt/slideMasters/slideMaster1.xml", pptxContentType+"slideMaster+xml",
+		xml.Header+`<p:sldMaster `+pptxNamespaces+`><p:cSld>`+
+			`<p:bg><p:bgPr><a:solidFill>`+srgb(w.colors.background)+`</a:solidFill><a:effectLst/></p:bgPr></p:bg><p:spTree>`+pptxGroup+
+			placeholder(2, "Title Placeholder 1", `<p:ph type="title"/>`, titleArea, "Click to edit Master title style")+
+			placeholder(3, "Text Placeholder 2", `<p:ph type="body" idx="1"/>`, body, "Click to edit Master text styles")+
+			`</p:spTree></p:cSld>`+
+			`<p:clrMap bg1="lt1" tx1="dk1" bg2="lt2" tx2="dk2" accent1="accent1" accent2="accent2" accent3="accent3" accent4="accent4" accent5="accent5" accent6="accent6" hlink="hlink" folHlink="folHlink"/>`+
+			`<p:sldLayoutIdLst><p:sldLayoutId id="2147483649" r:id="rId1"/><p:sldLayoutId id="2147483650" r:id="rId2"/></p:sldLayoutIdLst>`+
+			`<p:txStyles><p:titleStyle><a:lvl1pPr><a:defRPr sz="`+fmt.Sprint(int(pptxTitleSize*100))+`" b="1"><a:solidFill><a:schemeClr val="tx1"/></a:solidFill><a:latin typeface="+mj-lt"/></a:defRPr></a:lvl1pPr></p:titleStyle>`+
+			`<p:bodyStyle>`+levels.String()+`</p:bodyStyle>`+
+			`<p:otherStyle><a:defPPr><a:defRPr lang="en-US"/></a:defPPr></p:otherStyle></p:txStyles></p:sldMaster>`)
+	rels := newRels()
+	rels.add("slideLayout", "../slideLayouts/slideLayout1.xml", false)
+	rels.add("slideLayout", "../slideLayouts/slideLayout2.xml", false)
+	rels.add("theme", "../theme/theme1.xml", false)
+	w.add("ppt/slideMasters/_rels/slideMaster1.xml.rels", "", rels.xml())
+
+	layout := func(n int, kind, name, shapes string) {
+		w.add(fmt.Sprintf("ppt/slideLayouts/slideLayout%d.xml", n), pptxContentType+"slideLayout+xml",
+			xml.Header+`<p:sldLayout `+pptxNamespaces+` type="`+kind+`" preserve="1"><p:cSld name="`+name+`"><p:spTree>`+pptxGroup+shapes+
+				`</p:spTree></p:cSld><p:clrMapOvr><a:masterClrMapping/></p:clrMapOvr></p:sldLayout>`)
+		rels := newRels()
+		rels.add("slideMaster", "../slideMasters/slideMaster1.xml", false)
+		w.add(fmt.Sprintf("ppt/slideLayouts/_rels/slideLayout%d.xml.rels", n), "", rels.xml())
+	}
+	layout(1, "obj", "Title and Content",
+		placeholder(2, "Title 1", `<p:ph type="title"/>`, titleArea, "Click to add title")+
+			placeholder(3, "Content Placeholder 2", `<p:ph idx="1"/>`, body, "Click to add text"))
+	layout(2, "twoObj", "Two Content",
+		placeholder(2, "Title 1", `<p:ph type="title"/>`, titleArea, "Click to add title")+
+			placeholder(3, "Content Placeholder 2", `<p:ph sz="half" idx="1"/>`, left, "Click to add text")+
+			placeholder(4, "Content Placeholder 3", `<p:ph sz="half" idx="2"/>`, right, "Click to add text"))
+}
+
+// notesMaster adds the notes master, a portrait page with the slide above
+// the notes
+func (w *pptxWriter) notesMaster() {
+	shape := func(id int, name, ph string, x, y, cx, cy int) string {
+		return fmt.Sprintf(`<p:sp><p:nvSpPr><p:cNvPr id="%d" name="%s"/><p:cNvSpPr><a:spLocks noGrp="1"/></p:cNvSpPr><p:nvPr>%s</p:nvPr></p:nvSpPr>`, id, name, ph) +
+			fmt.Sprintf(`<p:spPr><a:xfrm><a:off x="%d" y="%d"/><a:ext cx="%d" cy="%d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></p:spPr>`, x, y, cx, cy) +
+			`<p:txBody><a:bodyPr/><a:lstStyle/>` + pptxEmptyParagraph + `</p:txBody></p:sp>`
+	}
+	imageHeight := int(5486400 / w.width * w.height)
+
+	w.add("ppt/notesMasters/notesMaster1.xml", pptxContentType+"notesMaster+xml",
+		xml.Header+`<p:notesMaster `+pptxNamespaces+`><p:cSld><p:spTree>`+pptxGroup+
+			shape(2, "Slide Image Placeholder 1", `<p:ph type="sldImg" idx="2"/>`, 685800, 685800, 5486400, imageHeight)+
+			shape(3, "Notes Placeholder 2", `<p:ph type="body" sz="quarter" idx="1"/>`, 685800, 685800+imageHeight+457200, 5486400, 9144000-685800*2-imageHeight-457200)+
+			`</p:spTree></p:cSld>`+
+			`<p:clrMap bg1="lt1" tx1="dk1" bg2="lt2" tx2="dk2" accent1="accent1" accent2="accent2" accent3="accent3" accent4="accent4" accent5="accent5" accent6="accent6" hlink="hlink" folHlink="folHlink"/>`+
+			fmt.Sprintf(`<p:notesStyle><a:lvl1pPr><a:defRPr sz="%d"/></a:lvl1pPr></p:notesStyle></p:notesMaster>`, int(pptxNotesSize*100)))
+	rels := newRels()
+	rels.add("theme", "../theme/theme2.xml", false)
+	w.add("ppt/notesMasters/_rels/notesMaster1.xml.rels", "", rels.xml())
+}
+
+// theme returns a DrawingML theme with the given colors and the font of
+// the deck
+func (w *pptxWriter) theme(colors pdfColors) string {
+	accent := colors.link
+	if colors.emphasis != nil {
+		accent = *colors.emphasis
+	}
+	muted := colors.text.mix(colors.background, 0.5)
+
+	var scheme strings.Builder
+	for _, c := range []struct {
+		name  string
+		color pdfColor
+	}{
+		{"dk1", colors.text},
+		{"lt1", colors.background},
+		{"dk2", muted},
+		{"lt2", colors.background.mix(colors.text, 0.1)},
+		{"accent1", accent},
+		{"accent2", colors.link},
+		{"accent3", muted},
+		{"accent4", accent.mix(colors.background, 0.4)},
+		{"accent5", colors.link.mix(colors.background, 0.4)},
+		{"accent6", muted.mix(colors.background, 0.4)},
+		{"hlink", colors.link},
+		{"folHlink", colors.link},
+	} {
+		scheme.WriteString("<a:" + c.name + ">" + srgb(c.color) + "</a:" + c.name + ">")
+	}
+
+	font := `<a:latin typeface="` + xmlEscape(w.font) + `"/><a:ea typeface=""/><a:cs typeface=""/>`
+	fill := `<a:solidFill><a:schemeClr val="phClr"/></a:solidFill>`
+	return xml.Header + `<a:theme xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" name="gobig"><a:themeElements>` +
+		`<a:clrScheme name="gobig">` + scheme.String() + `</a:clrScheme>` +
+		`<a:fontScheme name="gobig"><a:majorFont>` + font + `</a:majorFont><a:minorFont>` + font + `</a:minorFont></a:fontScheme>` +
+		`<a:fmtScheme name="gobig"><a:fillStyleLst>` + strings.Repeat(fill, 3) + `</a:fillStyleLst>` +
+		`<a:lnStyleLst><a:ln w="6350">` + fill + `</a:ln><a:ln w="12700">` + fill + `</a:ln><a:ln w="19050">` + fill + `</a:ln></a:lnStyleLst>` +
+		`<a:effectStyleLst>` + strings.Repeat(`<a:effectStyle><a:effectLst/></a:effectStyle>`, 3) + `</a:effectStyleLst>` +
+		`<a:bgFillStyleLst>` + strings.Repeat(fill, 3) + `</a:bgFillStyleLst></a:fmtScheme>` +
+		`</a:themeElements><a:objectDefaults/><a:extraClrSchemeLst/></a:theme>`
+}
+
+// srgb returns a DrawingML RGB color
+func srgb(c pdfColor) string {
+	return fmt.Sprintf(`<a:srgbClr val="%02X%02X%02X"/>`, c.r, c.g, c.b)
+}
+
+// xmlEscape escapes text for XML content and attribute values
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
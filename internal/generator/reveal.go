@@ -0,0 +1,265 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	parserPkg "gobig/internal/parser"
+)
+
+// DefaultRevealURL is the reveal.js package loaded by reveal.js output when
+// Options.RevealURL is empty. reveal.js is not embedded, so such decks need
+// network access unless RevealURL points at a local copy.
+const DefaultRevealURL = "https://cdn.jsdelivr.net/npm/reveal.js@5.1.0"
+
+// revealTemplate is the HTML structure of a reveal.js presentation
+const revealTemplate = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1.0, maximum-scale=1.0, user-scalable=no">
+  <title>%s</title>
+  <link rel="stylesheet" href="%s/dist/reveal.css">
+  <link rel="stylesheet" href="%s/dist/theme/%s.css">
+  %s
+</head>
+<body>
+  <div class="reveal">
+    <div class="slides">
+%s
+    </div>
+  </div>
+  <script src="%s/dist/reveal.js"></script>
+%s  <script>
+    Reveal.initialize(%s);
+  </script>
+</body>
+</html>`
+
+// Regexes to read fonts from theme CSS
+var (
+	// cssFontFaceRegex matches an @font-face rule
+	cssFontFaceRegex = regexp.MustCompile(`(?is)@font-face\s*\{[^{}]*\}`)
+
+	// cssFontFamilyRegex matches a font-family declaration
+	cssFontFamilyRegex = regexp.MustCompile(`(?i)(?:^|;)\s*font-family\s*:\s*([^;]+)`)
+)
+
+// GenerateReveal creates a reveal.js presentation from slides. Each slide
+// becomes a section, builds become fragments and step-through code blocks
+// get a section per step. Features reveal.js has no counterpart for are
+// reported as warnings.
+func (g *Generator) GenerateReveal(slides []*parserPkg.Slide) (string, error) {
+	g.begin(slides)
+	g.validateHighlightStyle()
+
+	height, err := pageHeight(g.options.AspectRatio)
+	if err != nil {
+		return "", err
+	}
+	if g.options.AspectRatio == "false" || g.options.AspectRatio == "none" {
+		g.addDiagnostic(parserPkg.SeverityWarning, "reveal.js slides have a fixed aspect ratio; using 1.6")
+	}
+	if g.options.CSP {
+		g.addDiagnostic(parserPkg.SeverityWarning, "a Content-Security-Policy is only added to big.js output")
+	}
+
+	sectionsHTML := g.generateSections(slides)
+
+	theme, fontCSS, err := g.loadHTMLTheme(sectionsHTML)
+	if err != nil {
+		return "", err
+	}
+	if len(theme.Files) > 0 {
+		g.addDiagnostic(parserPkg.SeverityWarning, "only the colors and fonts of theme %s are used with reveal.js", theme.Name)
+	}
+
+	if errors := g.countErrors(); errors > 0 {
+		return "", fmt.Errorf("%d problem(s) found", errors)
+	}
+
+	colors := themeColors(theme.CSS)
+	base := "white"
+	if colors.background.dark() {
+		base = "black"
+	}
+
+	url := strings.TrimSuffix(g.options.RevealURL, "/")
+	if url == "" {
+		url = DefaultRevealURL
+	}
+	url = escapeAttr(url)
+
+	// reveal.js's speaker view takes the place of the presenter view
+	config := fmt.Sprintf("{\n      hash: true,\n      width: %s,\n      height: %s", formatNumber(pdfPageWidth), formatNumber(height))
+	plugins := ""
+	if g.options.Presenter || g.options.PresentationMetadata.Presenter {
+		plugins = fmt.Sprintf("  <script src=\"%s/plugin/notes/notes.js\"></script>\n", url)
+		config += ",\n      plugins: [RevealNotes]"
+		if duration := g.options.PresentationMetadata.Duration; duration > 0 {
+			config += fmt.Sprintf(",\n      totalTime: %d", duration*60)
+		}
+	}
+	config += "\n    }"
+
+	css := g.highlightStyleCSS() + g.diagramCSS() + fontCSS + revealThemeCSS(theme.CSS, colors) + revealLayoutCSS(height)
+
+	return fmt.Sprintf(
+		revealTemplate,
+		escapeHTML(g.title(slides)),
+		url,
+		url,
+		base,
+		g.styleElement("deck.css", css),
+		sectionsHTML,
+		url,
+		plugins,
+		config,
+	), nil
+}
+
+// generateSections converts all slides to reveal.js sections. The first
+// section of a slide shows its build as fragments; step-through code
+// blocks add a section per further step, with the build fully revealed.
+func (g *Generator) generateSections(slides []*parserPkg.Slide) string {
+	var sb strings.Builder
+
+	for _, slide := range slides {
+		steps := g.buildSteps(slide)
+		for i, step := range steps {
+			if step != nil && step.codeStep == 0 {
+				if i > 0 {
+					continue // Shown by the fragments of the first section
+				}
+				step.fragments = true
+			}
+			section := g.generateSection(slide, step, len(steps), i > 0)
+			if i > 0 {
+				section = dropHeadingIDs(section)
+			}
+			sb.WriteString(section)
+			sb.WriteString("\n")
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// generateSection converts a slide, or one step of its step-through code,
+// to a reveal.js section. Sections continuing a slide appear without a
+// transition.
+func (g *Generator) generateSection(slide *parserPkg.Slide, build *buildState, steps int, continued bool) string {
+	g.current = slide
+	g.codeStep = 0
+	if build != nil {
+		g.codeStep = build.codeStep
+	}
+	defer func() { g.current, g.codeStep = nil, 0 }()
+
+	var sb strings.Builder
+	sb.WriteString("      <section")
+
+	if timeToNext := g.timeToNext(slide); timeToNext > 0 {
+		// Like big.js steps, every fragment and section of the slide gets
+		// an even share of its time
+		milliseconds := math.Round(float64(timeToNext) * 1000 / float64(steps))
+		sb.WriteString(fmt.Sprintf(` data-autoslide="%s"`, formatNumber(milliseconds)))
+	}
+	if continued {
+		sb.WriteString(` data-transition="none"`)
+	}
+
+	// reveal.js adds a section's state to the classes of the body
+	if slide.Metadata.BodyClass != "" {
+		sb.WriteString(fmt.Sprintf(` data-state="%s"`, escapeAttr(slide.Metadata.BodyClass)))
+	}
+	if slide.Metadata.BodyStyle != "" {
+		g.addDiagnostic(parserPkg.SeverityWarning, "body-style is not supported by reveal.js")
+	}
+
+	sb.WriteString(">")
+	sb.WriteString(g.slideContent(slide, build))
+
+	if slide.Notes != "" {
+		sb.WriteString(fmt.Sprintf("\n        <aside class=\"notes\">%s</aside>", g.notesToHTML(slide.Notes)))
+	}
+
+	sb.WriteString("\n      </section>")
+
+	return sb.String()
+}
+
+// revealThemeCSS carries the colors and fonts of a theme over to the
+// variables of reveal.js themes
+func revealThemeCSS(css string, colors pdfColors) string {
+	css = cssCommentRegex.ReplaceAllString(css, "")
+
+	var sb strings.Builder
+	for _, face := range cssFontFaceRegex.FindAllString(css, -1) {
+		sb.WriteString(face)
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(":root {\n")
+	sb.WriteString(fmt.Sprintf("  --r-background-color: %s;\n", colors.background.hex()))
+	sb.WriteString(fmt.Sprintf("  --r-main-color: %s;\n", colors.text.hex()))
+	sb.WriteString(fmt.Sprintf("  --r-heading-color: %s;\n", colors.text.hex()))
+	sb.WriteString(fmt.Sprintf("  --r-link-color: %s;\n", colors.link.hex()))
+	sb.WriteString(fmt.Sprintf("  --r-link-color-hover: %s;\n", colors.link.hex()))
+	sb.WriteString("  --r-heading-text-transform: none;\n")
+	if font := themeFont(css); font != "" {
+		sb.WriteString(fmt.Sprintf("  --r-main-font: %s;\n", font))
+		sb.WriteString(fmt.Sprintf("  --r-heading-font: %s;\n", font))
+	}
+	sb.WriteString("}\n")
+
+	if colors.emphasis != nil {
+		sb.WriteString(fmt.Sprintf(".reveal em { color: %s; }\n", colors.emphasis.hex()))
+	}
+	return sb.String()
+}
+
+// themeFont returns the font-family of a theme's body, or an empty string
+// if it has none
+func themeFont(css string) string {
+	font := ""
+	for _, rule := range cssRuleRegex.FindAllStringSubmatch(cssFontFaceRegex.ReplaceAllString(css, ""), -1) {
+		for _, selector := range strings.Split(rule[1], ",") {
+			selector = strings.TrimSpace(selector)
+			if selector != "body" && selector != "html" {
+				continue
+			}
+			for _, decl := range cssFontFamilyRegex.FindAllStringSubmatch(rule[2], -1) {
+				font = strings.TrimSpace(decl[1])
+			}
+		}
+	}
+	return font
+}
+
+// revealLayoutCSS lays out the cells of layout slides like big.css does, on
+// a slide of the given height
+func revealLayoutCSS(height float64) string {
+	return fmt.Sprintf(`.reveal .layout { display: grid; width: 100%%; height: %spx; }
+.reveal .layout div { display: flex; align-items: center; }
+.reveal .layout img { object-fit: contain; width: 100%%; height: 100%%; margin: 0; }
+`, formatNumber(height))
+}
+
+// dark reports whether light text is needed to read on the color
+func (c pdfColor) dark() bool {
+	return 0.299*float64(c.r)+0.587*float64(c.g)+0.114*float64(c.b) < 128
+}
+
+// hex returns the color in CSS hex notation
+func (c pdfColor) hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.r, c.g, c.b)
+}
+
+// formatNumber formats a number with at most two decimals
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,258 @@
+package generator
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+	"golang.org/x/net/html"
+
+	parserPkg "gobig/internal/parser"
+)
+
+// safeTags are the elements raw HTML may use in safe mode, with the
+// attributes each may have besides safeGlobalAttributes
+var safeTags = map[string][]string{
+	"a": {"href"}, "abbr": nil, "b": nil, "bdi": nil, "bdo": nil, "blockquote": {"cite"},
+	"br": nil, "caption": nil, "center": nil, "cite": nil, "code": nil, "col": {"span"},
+	"colgroup": {"span"}, "dd": nil, "del": {"cite", "datetime"}, "details": {"open"},
+	"dfn": nil, "div": nil, "dl": nil, "dt": nil, "em": nil, "figcaption": nil, "figure": nil,
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil, "hr": nil, "i": nil,
+	"img": {"src", "alt", "width", "height"}, "ins": {"cite", "datetime"}, "kbd": nil,
+	"li": {"value"}, "mark": nil, "ol": {"start", "type", "reversed"}, "p": nil, "pre": nil,
+	"q": {"cite"}, "rp": nil, "rt": nil, "ruby": nil, "s": nil, "samp": nil, "small": nil,
+	"span": nil, "strong": nil, "sub": nil, "summary": nil, "sup": nil, "table": nil,
+	"tbody": nil, "td": {"colspan", "rowspan", "align"}, "tfoot": nil,
+	"th": {"colspan", "rowspan", "align", "scope"}, "thead": nil, "time": {"datetime"},
+	"tr": nil, "u": nil, "ul": nil, "var": nil, "wbr": nil,
+}
+
+// safeGlobalAttributes are the attributes every allowed element may have
+var safeGlobalAttributes = []string{"class", "title", "lang", "dir"}
+
+// urlAttributes are the attributes that hold URLs, checked by safeURL
+var urlAttributes = []string{"href", "src", "cite"}
+
+// droppedElements are removed together with their content in safe mode.
+// Other elements outside the allowlist are removed keeping their content.
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true, "frameset": true,
+	"object": true, "embed": true, "applet": true, "template": true, "noscript": true,
+	"noembed": true, "noframes": true, "textarea": true, "select": true, "title": true,
+	"xmp": true, "plaintext": true, "svg": true, "math": true,
+}
+
+// Regex to match data URIs of raster images, the only data URIs allowed in
+// safe mode
+var safeDataURIRegex = regexp.MustCompile(`(?i)^data:image/(?:png|jpeg|gif|webp)[;,]`)
+
+// sanitizeHTML reduces raw HTML from a slide to the elements, attributes
+// and URLs allowed in safe mode, reporting what it removes
+func (g *Generator) sanitizeHTML(raw []byte) []byte {
+	var out bytes.Buffer
+	z := html.NewTokenizer(bytes.NewReader(raw))
+	skip, depth := "", 0 // Element whose content is being dropped
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		token := z.Token()
+
+		if skip != "" {
+			switch {
+			case tt == html.StartTagToken && token.Data == skip:
+				depth++
+			case tt == html.EndTagToken && token.Data == skip:
+				if depth--; depth == 0 {
+					skip = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case html.TextToken:
+			out.WriteString(html.EscapeString(token.Data))
+
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			allowed, ok := safeTags[token.Data]
+			switch {
+			case ok && tt != html.EndTagToken:
+				token.Attr = g.safeAttributes(token.Data, token.Attr, allowed)
+				out.WriteString(token.String())
+			case ok:
+				out.WriteString(token.String())
+			case tt == html.EndTagToken:
+				// Reported with the start tag
+			case droppedElements[token.Data]:
+				g.addDiagnostic(parserPkg.SeverityWarning, "removed <%s> element", token.Data)
+				if tt == html.StartTagToken {
+					skip, depth = token.Data, 1
+				}
+			default:
+				g.addDiagnostic(parserPkg.SeverityWarning, "removed <%s> tag, keeping its content", token.Data)
+			}
+
+			// Comments and doctypes are dropped silently
+		}
+	}
+	return out.Bytes()
+}
+
+// safeAttributes returns the attributes of an allowed element that safe
+// mode keeps, reporting the others
+func (g *Generator) safeAttributes(tag string, attrs []html.Attribute, allowed []string) []html.Attribute {
+	var kept []html.Attribute
+	for _, attr := range attrs {
+		switch {
+		case strings.HasPrefix(attr.Key, "on"):
+			g.addDiagnostic(parserPkg.SeverityWarning, "removed event handler %s from <%s>", attr.Key, tag)
+		case !slices.Contains(safeGlobalAttributes, attr.Key) && !slices.Contains(allowed, attr.Key):
+			g.addDiagnostic(parserPkg.SeverityWarning, "removed %s attribute from <%s>", attr.Key, tag)
+		case slices.Contains(urlAttributes, attr.Key) && !safeURL(attr.Val, tag == "img"):
+			scheme, _ := urlScheme(attr.Val)
+			g.addDiagnostic(parserPkg.SeverityWarning, "removed %s: URL from <%s>", scheme, tag)
+		default:
+			kept = append(kept, html.Attribute{Key: attr.Key, Val: attr.Val})
+		}
+	}
+	return kept
+}
+
+// sanitizeLinks removes Markdown links and images with URLs that safe mode
+// does not allow, keeping the text of links
+func (g *Generator) sanitizeLinks(doc ast.Node, source []byte) {
+	var unsafe []ast.Node
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link:
+			if !safeURL(linkURL(n.Destination), false) {
+				unsafe = append(unsafe, n)
+			}
+		case *ast.Image:
+			if !safeURL(linkURL(n.Destination), true) {
+				unsafe = append(unsafe, n)
+			}
+		case *ast.AutoLink:
+			if !safeURL(linkURL(n.URL(source)), false) {
+				unsafe = append(unsafe, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, n := range unsafe {
+		parent := n.Parent()
+		switch n := n.(type) {
+		case *ast.Link:
+			scheme, _ := urlScheme(linkURL(n.Destination))
+			g.addDiagnostic(parserPkg.SeverityWarning, "removed %s: URL from link", scheme)
+			for child := n.FirstChild(); child != nil; child = n.FirstChild() {
+				parent.InsertBefore(parent, n, child)
+			}
+			parent.RemoveChild(parent, n)
+		case *ast.Image:
+			scheme, _ := urlScheme(linkURL(n.Destination))
+			g.addDiagnostic(parserPkg.SeverityWarning, "removed %s: URL from image", scheme)
+			parent.RemoveChild(parent, n)
+		case *ast.AutoLink:
+			scheme, _ := urlScheme(linkURL(n.URL(source)))
+			g.addDiagnostic(parserPkg.SeverityWarning, "removed %s: URL from link", scheme)
+			parent.ReplaceChild(parent, n, ast.NewString(n.Label(source)))
+		}
+	}
+}
+
+// linkURL returns the URL of a Markdown link or image destination as the
+// browser sees it. Destinations may hold character references, which the
+// renderer decodes, so "javascript&#58;" is a javascript: URL.
+func linkURL(destination []byte) string {
+	return html.UnescapeString(string(destination))
+}
+
+// safeURL reports whether safe mode allows a URL: relative URLs, http,
+// https and mailto URLs, and for images data URIs of raster images
+func safeURL(url string, image bool) bool {
+	scheme, ok := urlScheme(url)
+	if !ok {
+		return true
+	}
+	switch scheme {
+	case "http", "https", "mailto":
+		return true
+	case "data":
+		return image && safeDataURIRegex.MatchString(strings.TrimSpace(url))
+	}
+	return false
+}
+
+// urlScheme returns the lower-case scheme of a URL, with ok false for
+// relative URLs. Like browsers, it ignores white space and control
+// characters, so "java\tscript:" is a javascript: URL.
+func urlScheme(url string) (scheme string, ok bool) {
+	var sb strings.Builder
+	for _, r := range url {
+		switch {
+		case r <= ' ':
+			continue
+		case r == ':':
+			return strings.ToLower(sb.String()), true
+		case r == '/' || r == '?' || r == '#':
+			return "", false
+		}
+		sb.WriteRune(r)
+	}
+	return "", false
+}
+
+// safeHTMLRenderer renders raw HTML through the safe mode allowlist
+type safeHTMLRenderer struct {
+	g *Generator
+}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *safeHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindHTMLBlock, r.renderHTMLBlock)
+	reg.Register(ast.KindRawHTML, r.renderRawHTML)
+}
+
+func (r *safeHTMLRenderer) renderHTMLBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.HTMLBlock)
+	var raw bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		raw.Write(segment.Value(source))
+	}
+	if n.HasClosure() {
+		raw.Write(n.ClosureLine.Value(source))
+	}
+	_, err := w.Write(r.g.sanitizeHTML(raw.Bytes()))
+	return ast.WalkSkipChildren, err
+}
+
+func (r *safeHTMLRenderer) renderRawHTML(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	n := node.(*ast.RawHTML)
+	var raw bytes.Buffer
+	for i := 0; i < n.Segments.Len(); i++ {
+		segment := n.Segments.At(i)
+		raw.Write(segment.Value(source))
+	}
+	_, err := w.Write(r.g.sanitizeHTML(raw.Bytes()))
+	return ast.WalkSkipChildren, err
+}
@@ -2,6 +2,9 @@ package generator
 
 import (
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 )
 
 // htmlTemplate is the base HTML structure for the presentation
@@ -10,46 +13,78 @@ const htmlTemplate = `<!DOCTYPE html>
 <head>
   <meta charset="utf-8">
   <meta name="viewport" content="width=device-width, initial-scale=1.0, maximum-scale=1.0, user-scalable=0" />
-  <title>%s</title>
-  <style>
-%s
-  </style>
-  <style>
-%s
-  </style>
+  %s<title>%s</title>
+  %s
+  %s
+  %s
+  %s
   %s
-  <script>
-%s
-  </script>
 </head>
 <body class="%s">
 %s
 </body>
 </html>`
 
-// generateHTML generates the complete HTML document
-func generateHTML(title, bigCSS, themeCSS, customCSS, bigJS, theme, slides string) string {
+// generateHTML generates the complete HTML document. The stylesheets and
+// scripts are complete elements, inline or referring to assets.
+func generateHTML(csp, title, bigCSS, themeCSS, customCSS, bigJS, extraJS, theme, slides string) string {
 	return fmt.Sprintf(
 		htmlTemplate,
+		csp,       // %s - Content-Security-Policy meta element and indentation
 		title,     // %s - title
-		bigCSS,    // %s - big.css
-		themeCSS,  // %s - theme CSS
+		bigCSS,    // %s - big.css element
+		themeCSS,  // %s - theme CSS element
 		customCSS, // %s - aspect ratio script
-		bigJS,     // %s - big.js
+		bigJS,     // %s - big.js element
+		extraJS,   // %s - optional scripts (presenter view)
 		theme,     // %s - body class (theme)
 		slides,    // %s - slides HTML
 	)
 }
 
-// aspectRatioScript generates the aspect ratio configuration script
-func aspectRatioScript(ratio string) string {
+// parseAspectRatio parses an aspect ratio option: a number such as "1.6",
+// a ratio of width to height such as "16:9", or "false" or "none" for
+// slides that fill the window, which returns 0
+func parseAspectRatio(ratio string) (float64, error) {
+	if ratio == "false" || ratio == "none" {
+		return 0, nil
+	}
+	var r float64
+	var err error
+	if width, height, ok := strings.Cut(ratio, ":"); ok {
+		var w, h float64
+		if w, err = strconv.ParseFloat(strings.TrimSpace(width), 64); err == nil {
+			h, err = strconv.ParseFloat(strings.TrimSpace(height), 64)
+		}
+		r = w / h
+	} else {
+		r, err = strconv.ParseFloat(strings.TrimSpace(ratio), 64)
+	}
+	if err != nil || !(r > 0) || math.IsInf(r, 0) {
+		return 0, fmt.Errorf("invalid aspect ratio %q: use a number, width:height, or false", ratio)
+	}
+	return r, nil
+}
+
+// aspectRatioScript generates the script setting the aspect ratio of big.js
+// slides, or returns an error if the ratio is invalid
+func (g *Generator) aspectRatioScript(ratio string) (string, error) {
 	if ratio == "" || ratio == "1.6" {
-		return "" // Default is 1.6, no need to override
+		return "", nil // Default is 1.6, no need to override
 	}
 
-	if ratio == "false" || ratio == "none" {
-		return "<script>BIG_ASPECT_RATIO = false;</script>"
+	r, err := parseAspectRatio(ratio)
+	if err != nil {
+		return "", err
 	}
+	if r == 0 {
+		return g.inlineScript("BIG_ASPECT_RATIO = false;"), nil
+	}
+	return g.inlineScript("BIG_ASPECT_RATIO = " + strconv.FormatFloat(r, 'f', -1, 64) + ";"), nil
+}
 
-	return fmt.Sprintf("<script>BIG_ASPECT_RATIO = %s;</script>", ratio)
+// presenterScript generates the presenter view script element, configured
+// with the planned talk duration in minutes (0 for none)
+func (g *Generator) presenterScript(presenterElement string, durationMinutes int) string {
+	return g.inlineScript(fmt.Sprintf("GOBIG_PRESENTER_DURATION = %d;", durationMinutes*60)) + "\n  " + presenterElement
 }
@@ -0,0 +1,737 @@
+// Package mathml converts LaTeX math to MathML.
+//
+// It supports the commonly used subset of TeX math: identifiers, numbers
+// and operators, subscripts and superscripts, fractions, roots, accents,
+// Greek letters and symbols, font commands such as \mathbb, \left and
+// \right delimiters, text, spacing, and matrix-like environments such as
+// pmatrix, cases and aligned.
+package mathml
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Convert converts TeX math to a MathML <math> element. display selects
+// block layout, as for $$...$$, instead of inline layout, as for $...$.
+// The TeX source is kept as an annotation.
+func Convert(tex string, display bool) (string, error) {
+	p := &parser{src: []rune(tex), display: display}
+
+	rows, err := p.parseRows(stopEnd)
+	if err != nil {
+		return "", err
+	}
+
+	// Line breaks outside of an environment stack centered lines
+	body := mrow(rows[0].cells[0])
+	if len(rows) > 1 || len(rows[0].cells) > 1 {
+		if len(rows[0].cells) > 1 {
+			return "", fmt.Errorf("& is only allowed inside an environment such as aligned or matrix")
+		}
+		body = table(rows, "", false)
+	}
+
+	mode := "inline"
+	if display {
+		mode = "block"
+	}
+	return fmt.Sprintf(`<math xmlns="http://www.w3.org/1998/Math/MathML" display="%s"><semantics>%s<annotation encoding="application/x-tex">%s</annotation></semantics></math>`,
+		mode, body, html.EscapeString(tex)), nil
+}
+
+// tokenKind is the kind of a TeX token
+type tokenKind int
+
+const (
+	tokenEOF     tokenKind = iota
+	tokenCommand           // \name or \c for a single non-letter c
+	tokenChar              // Any other character
+)
+
+// token is a TeX token
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+// stopKind says what ends a row being parsed
+type stopKind int
+
+const (
+	stopEnd   stopKind = iota // End of input
+	stopBrace                 // Closing }
+	stopRight                 // \right
+	stopEnv                   // \end
+)
+
+// row is one line of a table, split into cells by &
+type row struct {
+	cells [][]string
+}
+
+// parser converts TeX to MathML by recursive descent
+type parser struct {
+	src     []rune
+	pos     int
+	display bool
+	variant string // Active font command, e.g. "bb" inside \mathbb{...}
+}
+
+// peek returns the next token without consuming it
+func (p *parser) peek() token {
+	pos := p.pos
+	t := p.next()
+	p.pos = pos
+	return t
+}
+
+// next consumes and returns the next token, skipping whitespace
+func (p *parser) next() token {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		return token{kind: tokenEOF}
+	}
+
+	c := p.src[p.pos]
+	p.pos++
+	if c != '\\' {
+		return token{kind: tokenChar, value: string(c)}
+	}
+
+	if p.pos >= len(p.src) {
+		return token{kind: tokenCommand, value: " "}
+	}
+	start := p.pos
+	if !isLetter(p.src[p.pos]) {
+		p.pos++
+		return token{kind: tokenCommand, value: string(p.src[start:p.pos])}
+	}
+	for p.pos < len(p.src) && isLetter(p.src[p.pos]) {
+		p.pos++
+	}
+	return token{kind: tokenCommand, value: string(p.src[start:p.pos])}
+}
+
+// isLetter reports whether r can be part of a command name
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// parseRows parses rows separated by \\ and cells separated by & until
+// the given stop, which is left unconsumed except at the end of input
+func (p *parser) parseRows(stop stopKind) ([]row, error) {
+	rows := []row{{}}
+	var cell []string
+
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokenEOF:
+			if stop != stopEnd {
+				return nil, p.unterminated(stop)
+			}
+		case t.kind == tokenChar && t.value == "}":
+			if stop != stopBrace {
+				return nil, fmt.Errorf("unexpected }")
+			}
+		case t.kind == tokenCommand && t.value == "right":
+			if stop != stopRight {
+				return nil, fmt.Errorf(`\right without a matching \left`)
+			}
+		case t.kind == tokenCommand && t.value == "end":
+			if stop != stopEnv {
+				return nil, fmt.Errorf(`\end without a matching \begin`)
+			}
+		case t.kind == tokenChar && t.value == "&":
+			p.next()
+			rows[len(rows)-1].cells = append(rows[len(rows)-1].cells, cell)
+			cell = nil
+			continue
+		case t.kind == tokenCommand && (t.value == "\\" || t.value == "cr"):
+			p.next()
+			rows[len(rows)-1].cells = append(rows[len(rows)-1].cells, cell)
+			rows = append(rows, row{})
+			cell = nil
+			continue
+		case t.kind == tokenCommand && (t.value == "displaystyle" || t.value == "textstyle"):
+			// Style switches apply to the rest of the group
+			p.next()
+			rest, err := p.parseRow(stop)
+			if err != nil {
+				return nil, err
+			}
+			cell = append(cell, fmt.Sprintf(`<mstyle displaystyle="%t">%s</mstyle>`, t.value == "displaystyle", strings.Join(rest, "")))
+			continue
+		default:
+			element, err := p.parseScripted()
+			if err != nil {
+				return nil, err
+			}
+			cell = append(cell, element)
+			continue
+		}
+
+		rows[len(rows)-1].cells = append(rows[len(rows)-1].cells, cell)
+		// A trailing \\ does not start a new row
+		if last := rows[len(rows)-1]; len(rows) > 1 && len(last.cells) == 1 && len(last.cells[0]) == 0 {
+			rows = rows[:len(rows)-1]
+		}
+		return rows, nil
+	}
+}
+
+// parseRow parses a row without line breaks or cells
+func (p *parser) parseRow(stop stopKind) ([]string, error) {
+	rows, err := p.parseRows(stop)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > 1 || len(rows[0].cells) > 1 {
+		return nil, fmt.Errorf(`& and \\ are only allowed inside an environment such as aligned or matrix`)
+	}
+	return rows[0].cells[0], nil
+}
+
+// unterminated returns the error for input that ends before stop
+func (p *parser) unterminated(stop stopKind) error {
+	switch stop {
+	case stopBrace:
+		return fmt.Errorf("missing }")
+	case stopRight:
+		return fmt.Errorf(`\left without a matching \right`)
+	default:
+		return fmt.Errorf(`\begin without a matching \end`)
+	}
+}
+
+// parseScripted parses an atom followed by any subscript and superscript
+func (p *parser) parseScripted() (string, error) {
+	base, limits, err := p.parseAtom()
+	if err != nil {
+		return "", err
+	}
+
+	var sub, sup, primes string
+	for {
+		t := p.peek()
+		if t.kind != tokenChar || (t.value != "_" && t.value != "^" && t.value != "'") {
+			break
+		}
+		p.next()
+
+		if t.value == "'" {
+			primes += "<mo>′</mo>"
+			continue
+		}
+
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", err
+		}
+		if t.value == "_" {
+			if sub != "" {
+				return "", fmt.Errorf("double subscript")
+			}
+			sub = arg
+		} else {
+			if sup != "" {
+				return "", fmt.Errorf("double superscript")
+			}
+			sup = arg
+		}
+	}
+	// Primes are superscripts that come before any other superscript
+	if primes != "" {
+		if sup == "" && strings.Count(primes, "<mo>") == 1 {
+			sup = primes
+		} else {
+			sup = "<mrow>" + primes + sup + "</mrow>"
+		}
+	}
+
+	under, over, both := "msub", "msup", "msubsup"
+	if limits && p.display {
+		under, over, both = "munder", "mover", "munderover"
+	}
+	switch {
+	case sub != "" && sup != "":
+		return fmt.Sprintf("<%s>%s%s%s</%s>", both, base, sub, sup, both), nil
+	case sub != "":
+		return fmt.Sprintf("<%s>%s%s</%s>", under, base, sub, under), nil
+	case sup != "":
+		return fmt.Sprintf("<%s>%s%s</%s>", over, base, sup, over), nil
+	}
+	return base, nil
+}
+
+// parseArgument parses a command or script argument: a group or a single
+// token
+func (p *parser) parseArgument() (string, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenEOF:
+		return "", fmt.Errorf("missing argument at end of input")
+	case t.kind == tokenChar && (t.value == "}" || t.value == "&" || t.value == "^" || t.value == "_"):
+		return "", fmt.Errorf("missing argument before %s", t.value)
+	case t.kind == tokenChar && unicode.IsDigit([]rune(t.value)[0]):
+		// Like TeX, an argument without braces is one digit: \frac12
+		p.next()
+		return "<mn>" + p.styled(t.value) + "</mn>", nil
+	}
+	element, _, err := p.parseAtom()
+	return element, err
+}
+
+// parseGroup parses a {...} group and returns its elements
+func (p *parser) parseGroup() ([]string, error) {
+	if t := p.next(); t.kind != tokenChar || t.value != "{" {
+		return nil, fmt.Errorf("expected {")
+	}
+	elements, err := p.parseRow(stopBrace)
+	if err != nil {
+		return nil, err
+	}
+	p.next()
+	return elements, nil
+}
+
+// parseRawGroup returns the text of a {...} group without parsing it
+func (p *parser) parseRawGroup() (string, error) {
+	if t := p.next(); t.kind != tokenChar || t.value != "{" {
+		return "", fmt.Errorf("expected {")
+	}
+	depth := 1
+	start := p.pos
+	for ; p.pos < len(p.src); p.pos++ {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				text := string(p.src[start:p.pos])
+				p.pos++
+				return text, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("missing }")
+}
+
+// parseAtom parses a single element. limits reports whether scripts on it
+// go below and above in display mode, as for \sum.
+func (p *parser) parseAtom() (element string, limits bool, err error) {
+	t := p.next()
+
+	if t.kind == tokenChar {
+		c := []rune(t.value)[0]
+		switch {
+		case c == '{':
+			elements, err := p.parseRow(stopBrace)
+			if err != nil {
+				return "", false, err
+			}
+			p.next()
+			return mrow(elements), false, nil
+		case c == '_' || c == '^':
+			// A script with nothing before it applies to an empty base
+			p.pos--
+			return "<mrow></mrow>", false, nil
+		case unicode.IsDigit(c):
+			number := t.value
+			for p.pos < len(p.src) && (unicode.IsDigit(p.src[p.pos]) ||
+				(p.src[p.pos] == '.' && p.pos+1 < len(p.src) && unicode.IsDigit(p.src[p.pos+1]))) {
+				number += string(p.src[p.pos])
+				p.pos++
+			}
+			return "<mn>" + p.styled(number) + "</mn>", false, nil
+		case unicode.IsLetter(c):
+			return p.identifier(t.value), false, nil
+		case c == '~':
+			return `<mspace width="0.333em"></mspace>`, false, nil
+		case c == '$' || c == '#' || c == '%':
+			return "", false, fmt.Errorf("unexpected %s", t.value)
+		}
+		return operator(charOperators, t.value), false, nil
+	}
+
+	name := t.value
+	if name == "" || name == " " {
+		return `<mspace width="0.333em"></mspace>`, false, nil
+	}
+
+	if s, ok := identifiers[name]; ok {
+		return p.identifier(s), false, nil
+	}
+	if s, ok := uprightIdentifiers[name]; ok {
+		return `<mi mathvariant="normal">` + s + "</mi>", false, nil
+	}
+	if s, ok := operators[name]; ok {
+		return "<mo>" + html.EscapeString(s) + "</mo>", false, nil
+	}
+	if s, ok := largeOperators[name]; ok {
+		return "<mo>" + s + "</mo>", !strings.Contains(name, "int"), nil
+	}
+	if slices.Contains(functions, name) {
+		return "<mi>" + name + "</mi><mo>&#x2061;</mo>", false, nil
+	}
+	if slices.Contains(limitFunctions, name) {
+		text := map[string]string{"limsup": "lim sup", "liminf": "lim inf"}[name]
+		if text == "" {
+			text = name
+		}
+		return "<mo>" + text + "</mo>", true, nil
+	}
+	if width, ok := spaces[name]; ok {
+		return fmt.Sprintf(`<mspace width="%s"></mspace>`, width), false, nil
+	}
+	if variant, ok := fontCommands[name]; ok {
+		return p.parseStyled(variant)
+	}
+	if accent, ok := accents[name]; ok {
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		if accent.under {
+			return fmt.Sprintf(`<munder accentunder="true">%s<mo stretchy="%t">%s</mo></munder>`, arg, accent.stretchy, accent.mark), false, nil
+		}
+		return fmt.Sprintf(`<mover accent="true">%s<mo stretchy="%t">%s</mo></mover>`, arg, accent.stretchy, accent.mark), false, nil
+	}
+	if size, ok := bigDelimiters[name]; ok {
+		delim, err := p.parseDelimiter()
+		if err != nil {
+			return "", false, err
+		}
+		return fmt.Sprintf(`<mo minsize="%s" maxsize="%s">%s</mo>`, size, size, delim), false, nil
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "binom", "dbinom", "tbinom":
+		num, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		den, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		frac := fmt.Sprintf("<mfrac>%s%s</mfrac>", num, den)
+		if strings.HasSuffix(name, "binom") {
+			frac = fmt.Sprintf(`<mrow><mo>(</mo><mfrac linethickness="0">%s%s</mfrac><mo>)</mo></mrow>`, num, den)
+		}
+		switch name[0] {
+		case 'd':
+			frac = `<mstyle displaystyle="true">` + frac + "</mstyle>"
+		case 't':
+			frac = `<mstyle displaystyle="false">` + frac + "</mstyle>"
+		}
+		return frac, false, nil
+
+	case "sqrt":
+		var index string
+		if t := p.peek(); t.kind == tokenChar && t.value == "[" {
+			p.next()
+			var elements []string
+			for {
+				t := p.peek()
+				if t.kind == tokenEOF {
+					return "", false, fmt.Errorf("missing ] after root index")
+				}
+				if t.kind == tokenChar && t.value == "]" {
+					p.next()
+					break
+				}
+				element, err := p.parseScripted()
+				if err != nil {
+					return "", false, err
+				}
+				elements = append(elements, element)
+			}
+			index = mrow(elements)
+		}
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		if index != "" {
+			return fmt.Sprintf("<mroot>%s%s</mroot>", arg, index), false, nil
+		}
+		return fmt.Sprintf("<msqrt>%s</msqrt>", arg), false, nil
+
+	case "text", "textrm", "textnormal", "mbox", "textit", "textbf":
+		text, err := p.parseRawGroup()
+		if err != nil {
+			return "", false, err
+		}
+		text = unescapeText(text)
+		// Keep spaces at the edges, which MathML would otherwise trim
+		text = strings.ReplaceAll(html.EscapeString(text), " ", "&#xA0;")
+		switch name {
+		case "textit":
+			return `<mtext mathvariant="italic">` + text + "</mtext>", false, nil
+		case "textbf":
+			return `<mtext mathvariant="bold">` + text + "</mtext>", false, nil
+		}
+		return "<mtext>" + text + "</mtext>", false, nil
+
+	case "operatorname", "operatorname*":
+		text, err := p.parseRawGroup()
+		if err != nil {
+			return "", false, err
+		}
+		return "<mi>" + html.EscapeString(strings.TrimSpace(text)) + "</mi><mo>&#x2061;</mo>", false, nil
+
+	case "left":
+		open, err := p.parseDelimiter()
+		if err != nil {
+			return "", false, err
+		}
+		elements, err := p.parseRow(stopRight)
+		if err != nil {
+			return "", false, err
+		}
+		p.next() // \right
+		close, err := p.parseDelimiter()
+		if err != nil {
+			return "", false, err
+		}
+		return fenced(open, mrow(elements), close), false, nil
+
+	case "begin":
+		return p.parseEnvironment()
+
+	case "overset", "stackrel", "underset":
+		top, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		base, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		if name == "underset" {
+			return fmt.Sprintf("<munder>%s%s</munder>", base, top), false, nil
+		}
+		return fmt.Sprintf("<mover>%s%s</mover>", base, top), false, nil
+
+	case "overbrace", "underbrace":
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		if name == "underbrace" {
+			return fmt.Sprintf(`<munder>%s<mo stretchy="true">⏟</mo></munder>`, arg), true, nil
+		}
+		return fmt.Sprintf(`<mover>%s<mo stretchy="true">⏞</mo></mover>`, arg), true, nil
+
+	case "not":
+		arg, _, err := p.parseAtom()
+		if err != nil {
+			return "", false, err
+		}
+		if !strings.HasPrefix(arg, "<mo>") {
+			return "", false, fmt.Errorf(`\not must be followed by a relation`)
+		}
+		// Overlay the relation with a long solidus
+		return strings.Replace(arg, "</mo>", "\u0338</mo>", 1), false, nil
+
+	case "pmod":
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", false, err
+		}
+		return fmt.Sprintf(`<mspace width="1em"></mspace><mo>(</mo><mi>mod</mi><mspace width="0.333em"></mspace>%s<mo>)</mo>`, arg), false, nil
+
+	case "bmod", "mod":
+		return "<mo>mod</mo>", false, nil
+	}
+
+	return "", false, fmt.Errorf(`unknown command \%s`, name)
+}
+
+// parseStyled parses the argument of a font command such as \mathbb
+func (p *parser) parseStyled(variant string) (string, bool, error) {
+	previous := p.variant
+	p.variant = variant
+	defer func() { p.variant = previous }()
+
+	arg, err := p.parseArgument()
+	return arg, false, err
+}
+
+// identifier returns an identifier element for s in the active font
+func (p *parser) identifier(s string) string {
+	if p.variant == "normal" {
+		return `<mi mathvariant="normal">` + html.EscapeString(s) + "</mi>"
+	}
+	return "<mi>" + p.styled(s) + "</mi>"
+}
+
+// styled maps letters and digits of s to the active font's Unicode
+// mathematical alphanumeric symbols
+func (p *parser) styled(s string) string {
+	if p.variant == "" || p.variant == "normal" {
+		return html.EscapeString(s)
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		sb.WriteRune(styleRune(r, p.variant))
+	}
+	return html.EscapeString(sb.String())
+}
+
+// parseDelimiter parses the delimiter after \left, \right or \big
+func (p *parser) parseDelimiter() (string, error) {
+	t := p.next()
+	if t.kind == tokenEOF {
+		return "", fmt.Errorf("missing delimiter at end of input")
+	}
+	if t.kind == tokenChar {
+		if t.value == "." {
+			return "", nil
+		}
+		if strings.Contains("()[]|/<>", t.value) {
+			return html.EscapeString(delimiterChar(t.value)), nil
+		}
+	}
+	if t.kind == tokenCommand {
+		if s, ok := delimiters[t.value]; ok {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("invalid delimiter %s", tokenText(t))
+}
+
+// delimiterChar maps a delimiter character to the symbol it stands for
+func delimiterChar(c string) string {
+	switch c {
+	case "<":
+		return "⟨"
+	case ">":
+		return "⟩"
+	}
+	return c
+}
+
+// parseEnvironment parses \begin{name}...\end{name}
+func (p *parser) parseEnvironment() (string, bool, error) {
+	name, err := p.parseRawGroup()
+	if err != nil {
+		return "", false, err
+	}
+	env, ok := environments[name]
+	if !ok {
+		return "", false, fmt.Errorf("unknown environment %s", name)
+	}
+
+	// Skip the column specification of array
+	if name == "array" {
+		if _, err := p.parseRawGroup(); err != nil {
+			return "", false, err
+		}
+	}
+
+	rows, err := p.parseRows(stopEnv)
+	if err != nil {
+		return "", false, err
+	}
+	p.next() // \end
+	end, err := p.parseRawGroup()
+	if err != nil {
+		return "", false, err
+	}
+	if end != name {
+		return "", false, fmt.Errorf(`\begin{%s} ended by \end{%s}`, name, end)
+	}
+
+	return fenced(env.open, table(rows, env.align, env.alternate), env.close), false, nil
+}
+
+// fenced wraps body in stretchy fences, leaving out empty ones
+func fenced(open, body, close string) string {
+	if open == "" && close == "" {
+		return body
+	}
+	var sb strings.Builder
+	sb.WriteString("<mrow>")
+	if open != "" {
+		sb.WriteString(`<mo fence="true" stretchy="true">` + open + "</mo>")
+	}
+	sb.WriteString(body)
+	if close != "" {
+		sb.WriteString(`<mo fence="true" stretchy="true">` + close + "</mo>")
+	}
+	sb.WriteString("</mrow>")
+	return sb.String()
+}
+
+// table renders rows as an mtable. align is the column alignment; with
+// alternate set, columns alternate between right and left alignment, as
+// in aligned.
+func table(rows []row, align string, alternate bool) string {
+	var sb strings.Builder
+	sb.WriteString("<mtable")
+	if alternate {
+		sb.WriteString(` columnalign="right left right left right left" columnspacing="0em 2em 0em 2em 0em"`)
+	} else if align != "" {
+		sb.WriteString(fmt.Sprintf(` columnalign="%s"`, align))
+	}
+	sb.WriteString(">")
+	for _, r := range rows {
+		sb.WriteString("<mtr>")
+		for _, cell := range r.cells {
+			sb.WriteString("<mtd>")
+			sb.WriteString(strings.Join(cell, ""))
+			sb.WriteString("</mtd>")
+		}
+		sb.WriteString("</mtr>")
+	}
+	sb.WriteString("</mtable>")
+	return sb.String()
+}
+
+// mrow wraps elements in an mrow unless there is exactly one
+func mrow(elements []string) string {
+	if len(elements) == 1 {
+		return elements[0]
+	}
+	return "<mrow>" + strings.Join(elements, "") + "</mrow>"
+}
+
+// operator returns an operator element for a character, mapped through
+// table if it has an entry
+func operator(table map[string]string, c string) string {
+	if s, ok := table[c]; ok {
+		c = s
+	}
+	return "<mo>" + html.EscapeString(c) + "</mo>"
+}
+
+// tokenText returns a token as it appears in the source
+func tokenText(t token) string {
+	if t.kind == tokenCommand {
+		return `\` + t.value
+	}
+	return t.value
+}
+
+// unescapeText resolves the escapes allowed in \text
+func unescapeText(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.ContainsRune(`{}$%&#_ \`, rune(s[i+1])) {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,88 @@
+package mathml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name    string
+		tex     string
+		display bool
+		want    []string
+	}{
+		{"Superscript", `x^2`, false, []string{"<msup><mi>x</mi><mn>2</mn></msup>"}},
+		{"Fraction", `\frac{a}{b}`, false, []string{"<mfrac><mi>a</mi><mi>b</mi></mfrac>"}},
+		{"Fraction digits", `\frac12`, false, []string{"<mfrac><mn>1</mn><mn>2</mn></mfrac>"}},
+		{"Sum inline", `\sum_{i=1}^n i`, false, []string{"<msubsup><mo>∑</mo>"}},
+		{"Sum display", `\sum_{i=1}^n i`, true, []string{"<munderover><mo>∑</mo>", `display="block"`}},
+		{"Limit display", `\lim_{x\to 0} f(x)`, true, []string{"<munder><mo>lim</mo>", "<mo>→</mo>"}},
+		{"Prime", `f'(x)`, false, []string{"<msup><mi>f</mi><mo>′</mo></msup>"}},
+		{"Greek", `e^{i\pi}+1=0`, false, []string{"<mi>π</mi>", "<mo>+</mo>", "<mn>0</mn>"}},
+		{"Number", `3.14r`, false, []string{"<mn>3.14</mn><mi>r</mi>"}},
+		{"Blackboard", `\mathbb{R}^n`, false, []string{"<mi>ℝ</mi>"}},
+		{"Bold", `\mathbf{v}`, false, []string{"<mi>𝐯</mi>"}},
+		{"Root", `\sqrt[3]{x}`, false, []string{"<mroot><mi>x</mi><mn>3</mn></mroot>"}},
+		{"Text", `x \text{if } y`, false, []string{"<mtext>if&#xA0;</mtext>"}},
+		{"Negation", `a \not= b`, false, []string{"<mo>=\u0338</mo>"}},
+		{"Fences", `\left(\frac12\right)`, false, []string{`<mo fence="true" stretchy="true">(</mo><mfrac>`}},
+		{"Matrix", `\begin{pmatrix}a&b\\c&d\end{pmatrix}`, true, []string{
+			`<mo fence="true" stretchy="true">(</mo><mtable>`,
+			"<mtr><mtd><mi>c</mi></mtd><mtd><mi>d</mi></mtd></mtr>",
+		}},
+		{"Cases", `\begin{cases}1 & x>0\\0 & \text{otherwise}\end{cases}`, true, []string{
+			`<mtable columnalign="left left">`,
+			"<mo>&gt;</mo>",
+			"</mtable></mrow>",
+		}},
+		{"Line break", `a \\ b`, true, []string{"<mtable><mtr><mtd><mi>a</mi></mtd></mtr><mtr>"}},
+		{"Annotation", `a<b`, false, []string{`<annotation encoding="application/x-tex">a&lt;b</annotation>`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Convert(tt.tex, tt.display)
+			if err != nil {
+				t.Fatalf("Convert(%q) failed: %v", tt.tex, err)
+			}
+			if !strings.HasPrefix(got, `<math xmlns="http://www.w3.org/1998/Math/MathML"`) {
+				t.Errorf("Convert(%q) = %q, want a math element", tt.tex, got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("Convert(%q) = %q, want it to contain %q", tt.tex, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []struct {
+		tex  string
+		want string
+	}{
+		{`\foo`, `unknown command \foo`},
+		{`{x`, "missing }"},
+		{`x}`, "unexpected }"},
+		{`x^`, "missing argument"},
+		{`x^2^3`, "double superscript"},
+		{`\left( x`, `\left without a matching \right`},
+		{`x \right)`, `\right without a matching \left`},
+		{`\begin{matrix} a \end{pmatrix}`, `\begin{matrix} ended by \end{pmatrix}`},
+		{`\begin{foo} a \end{foo}`, "unknown environment foo"},
+		{`a & b`, "only allowed inside an environment"},
+	}
+
+	for _, tt := range tests {
+		_, err := Convert(tt.tex, false)
+		if err == nil {
+			t.Errorf("Convert(%q) succeeded, want an error", tt.tex)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Convert(%q) error = %q, want it to contain %q", tt.tex, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package mathml
+
+// identifiers maps commands to symbols rendered as identifiers
+var identifiers = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ",
+	"varepsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ",
+	"iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ",
+	"pi": "π", "varpi": "ϖ", "rho": "ρ", "varrho": "ϱ", "sigma": "σ",
+	"varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ", "varphi": "φ",
+	"chi": "χ", "psi": "ψ", "omega": "ω",
+	"ell": "ℓ", "hbar": "ℏ", "imath": "ı", "jmath": "ȷ", "wp": "℘",
+}
+
+// uprightIdentifiers maps commands to symbols rendered as upright
+// identifiers, like capital Greek letters in TeX
+var uprightIdentifiers = map[string]string{
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ",
+	"Pi": "Π", "Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ",
+	"Omega": "Ω",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "emptyset": "∅",
+	"varnothing": "∅", "aleph": "ℵ", "Re": "ℜ", "Im": "ℑ",
+	"top": "⊤", "bot": "⊥", "angle": "∠", "triangle": "△", "surd": "√",
+}
+
+// operators maps commands to operator symbols
+var operators = map[string]string{
+	// Binary operators
+	"pm": "±", "mp": "∓", "times": "×", "div": "÷", "cdot": "⋅", "ast": "∗",
+	"star": "⋆", "circ": "∘", "bullet": "∙", "oplus": "⊕", "ominus": "⊖",
+	"otimes": "⊗", "odot": "⊙", "cap": "∩", "cup": "∪", "setminus": "∖",
+	"wedge": "∧", "land": "∧", "vee": "∨", "lor": "∨", "neg": "¬", "lnot": "¬",
+	"dagger": "†", "ddagger": "‡", "amalg": "⨿",
+	// Relations
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠",
+	"approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅",
+	"propto": "∝", "ll": "≪", "gg": "≫", "subset": "⊂", "supset": "⊃",
+	"subseteq": "⊆", "supseteq": "⊇", "in": "∈", "notin": "∉", "ni": "∋",
+	"perp": "⊥", "parallel": "∥", "mid": "∣", "prec": "≺", "succ": "≻",
+	"preceq": "⪯", "succeq": "⪰", "doteq": "≐", "models": "⊨", "vdash": "⊢",
+	"dashv": "⊣", "coloneqq": "≔", "lt": "<", "gt": ">",
+	// Arrows
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←",
+	"leftrightarrow": "↔", "Rightarrow": "⇒", "Leftarrow": "⇐",
+	"Leftrightarrow": "⇔", "implies": "⟹", "impliedby": "⟸", "iff": "⟺",
+	"mapsto": "↦", "uparrow": "↑", "downarrow": "↓", "updownarrow": "↕",
+	"Uparrow": "⇑", "Downarrow": "⇓", "longrightarrow": "⟶",
+	"longleftarrow": "⟵", "longmapsto": "⟼", "hookrightarrow": "↪",
+	"rightleftharpoons": "⇌", "nearrow": "↗", "searrow": "↘",
+	// Other symbols
+	"forall": "∀", "exists": "∃", "nexists": "∄", "therefore": "∴",
+	"because": "∵", "ldots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱",
+	"dots": "…", "prime": "′", "colon": ":", "vert": "|", "Vert": "‖",
+	"|": "‖", "langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋",
+	"lceil": "⌈", "rceil": "⌉", "backslash": "∖",
+	"{": "{", "}": "}", "$": "$", "%": "%", "&": "&", "#": "#", "_": "_",
+}
+
+// largeOperators maps commands to operators that take limits. Scripts on
+// them go below and above in display mode, except for integrals.
+var largeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬",
+	"iiint": "∭", "oint": "∮", "bigcup": "⋃", "bigcap": "⋂",
+	"bigoplus": "⨁", "bigotimes": "⨂", "bigodot": "⨀", "bigvee": "⋁",
+	"bigwedge": "⋀", "bigsqcup": "⨆",
+}
+
+// functions are rendered as upright names, such as sin
+var functions = []string{
+	"sin", "cos", "tan", "cot", "sec", "csc", "arcsin", "arccos", "arctan",
+	"sinh", "cosh", "tanh", "coth", "log", "ln", "lg", "exp", "deg", "dim",
+	"ker", "hom", "arg", "gcd", "Pr",
+}
+
+// limitFunctions are functions whose subscripts go below in display mode
+var limitFunctions = []string{
+	"lim", "limsup", "liminf", "max", "min", "sup", "inf", "det", "argmax", "argmin",
+}
+
+// spaces maps spacing commands to widths
+var spaces = map[string]string{
+	",": "0.1667em", "thinspace": "0.1667em", ":": "0.2222em", ">": "0.2222em",
+	"medspace": "0.2222em", ";": "0.2778em", "thickspace": "0.2778em",
+	"!": "-0.1667em", "negthinspace": "-0.1667em", "quad": "1em",
+	"qquad": "2em", " ": "0.333em", "enspace": "0.5em",
+}
+
+// fontCommands maps font commands to the variants used by styleRune
+var fontCommands = map[string]string{
+	"mathrm": "normal", "mathup": "normal", "mathbf": "bold", "boldsymbol": "bold",
+	"bm": "bold", "mathit": "italic", "mathbb": "bb", "mathcal": "cal",
+	"mathscr": "cal", "mathfrak": "frak", "mathsf": "sf", "mathtt": "tt",
+}
+
+// accent describes an accent command
+type accent struct {
+	mark     string
+	under    bool // Placed below instead of above
+	stretchy bool // Stretches to the width of its argument
+}
+
+// accents maps accent commands to their marks
+var accents = map[string]accent{
+	"hat": {mark: "^"}, "widehat": {mark: "^", stretchy: true},
+	"bar": {mark: "¯"}, "overline": {mark: "¯", stretchy: true},
+	"vec": {mark: "→"}, "overrightarrow": {mark: "→", stretchy: true},
+	"overleftarrow": {mark: "←", stretchy: true},
+	"tilde":         {mark: "~"}, "widetilde": {mark: "~", stretchy: true},
+	"dot": {mark: "˙"}, "ddot": {mark: "¨"}, "check": {mark: "ˇ"},
+	"breve": {mark: "˘"}, "acute": {mark: "´"}, "grave": {mark: "`"},
+	"underline": {mark: "_", under: true, stretchy: true},
+}
+
+// bigDelimiters maps delimiter sizing commands to sizes
+var bigDelimiters = map[string]string{
+	"big": "1.2em", "bigl": "1.2em", "bigr": "1.2em", "bigm": "1.2em",
+	"Big": "1.8em", "Bigl": "1.8em", "Bigr": "1.8em", "Bigm": "1.8em",
+	"bigg": "2.4em", "biggl": "2.4em", "biggr": "2.4em", "biggm": "2.4em",
+	"Bigg": "3em", "Biggl": "3em", "Biggr": "3em", "Biggm": "3em",
+}
+
+// delimiters maps delimiter commands to symbols
+var delimiters = map[string]string{
+	"{": "{", "}": "}", "|": "‖", "langle": "⟨", "rangle": "⟩",
+	"lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉", "vert": "|",
+	"Vert": "‖", "lvert": "|", "rvert": "|", "lVert": "‖", "rVert": "‖",
+	"backslash": "∖", "uparrow": "↑", "downarrow": "↓",
+}
+
+// charOperators maps characters to the operator symbols they stand for
+var charOperators = map[string]string{
+	"-": "−", "*": "∗",
+}
+
+// environment describes a matrix-like environment
+type environment struct {
+	open, close string // Fences around the table
+	align       string // Column alignment
+	alternate   bool   // Columns alternate right and left, as in aligned
+}
+
+// environments maps environment names to their layout
+var environments = map[string]environment{
+	"matrix":      {},
+	"smallmatrix": {},
+	"array":       {},
+	"pmatrix":     {open: "(", close: ")"},
+	"bmatrix":     {open: "[", close: "]"},
+	"Bmatrix":     {open: "{", close: "}"},
+	"vmatrix":     {open: "|", close: "|"},
+	"Vmatrix":     {open: "‖", close: "‖"},
+	"cases":       {open: "{", align: "left left"},
+	"aligned":     {alternate: true},
+	"align":       {alternate: true},
+	"align*":      {alternate: true},
+	"gathered":    {},
+	"gather":      {},
+	"gather*":     {},
+	"split":       {alternate: true},
+}
+
+// alphabet gives the first code points of a mathematical alphanumeric
+// style, 0 if the style has no such characters
+type alphabet struct {
+	upper, lower, digit rune
+}
+
+// alphabets maps font variants to their Unicode mathematical alphabets
+var alphabets = map[string]alphabet{
+	"bold":   {upper: 0x1D400, lower: 0x1D41A, digit: 0x1D7CE},
+	"italic": {upper: 0x1D434, lower: 0x1D44E},
+	"bb":     {upper: 0x1D538, lower: 0x1D552, digit: 0x1D7D8},
+	"cal":    {upper: 0x1D49C, lower: 0x1D4B6},
+	"frak":   {upper: 0x1D504, lower: 0x1D51E},
+	"sf":     {upper: 0x1D5A0, lower: 0x1D5BA, digit: 0x1D7E2},
+	"tt":     {upper: 0x1D670, lower: 0x1D68A, digit: 0x1D7F6},
+}
+
+// alphabetExceptions lists letters encoded outside of their mathematical
+// alphabet, in the Letterlike Symbols block
+var alphabetExceptions = map[string]map[rune]rune{
+	"italic": {'h': 'ℎ'},
+	"bb":     {'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ'},
+	"cal": {'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ',
+		'R': 'ℛ', 'e': 'ℯ', 'g': 'ℊ', 'o': 'ℴ'},
+	"frak": {'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ'},
+}
+
+// styleRune returns r in the mathematical alphabet of variant, or r itself
+// if the alphabet has no such character
+func styleRune(r rune, variant string) rune {
+	if s, ok := alphabetExceptions[variant][r]; ok {
+		return s
+	}
+	a := alphabets[variant]
+	switch {
+	case r >= 'A' && r <= 'Z' && a.upper != 0:
+		return a.upper + r - 'A'
+	case r >= 'a' && r <= 'z' && a.lower != 0:
+		return a.lower + r - 'a'
+	case r >= '0' && r <= '9' && a.digit != 0:
+		return a.digit + r - '0'
+	}
+	return r
+}
@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Declaration is a CSS declaration such as "grid-template-columns: 1fr 2fr"
+type Declaration struct {
+	Property string
+	Value    string
+}
+
+// String returns the declaration as CSS, e.g. "gap: 1em;"
+func (d Declaration) String() string {
+	return d.Property + ": " + d.Value + ";"
+}
+
+// gridProperties are the properties custom layouts may set
+var gridProperties = []string{
+	"grid", "grid-template", "grid-template-columns", "grid-template-rows", "grid-template-areas",
+	"grid-auto-columns", "grid-auto-rows", "grid-auto-flow",
+	"gap", "row-gap", "column-gap", "grid-gap", "grid-row-gap", "grid-column-gap",
+	"align-items", "justify-items", "place-items", "align-content", "justify-content", "place-content",
+}
+
+// Regexes to check CSS declarations
+var (
+	// cssPropertyRegex matches a property name, including custom properties
+	cssPropertyRegex = regexp.MustCompile(`^-{0,2}[a-z][a-z0-9-]*$`)
+
+	// cssFunctionRegex matches the name of a function call in a value
+	cssFunctionRegex = regexp.MustCompile(`(?i)([a-z-]+)\s*\(`)
+
+	// cssURLRegex matches the argument of url()
+	cssURLRegex = regexp.MustCompile(`(?i)url\(\s*['"]?([^'")]*)`)
+)
+
+// ParseDeclarations parses a list of CSS declarations such as a body-style,
+// returning an error if it is anything else. Values may not contain
+// characters that end a declaration block or a style attribute, escapes,
+// comments, or script: expression() is rejected, and so is url() unless
+// its URL is relative or uses http or https.
+func ParseDeclarations(css string) ([]Declaration, error) {
+	var declarations []Declaration
+	for _, part := range splitDeclarations(css) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		property, value, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("%q is not a CSS declaration", part)
+		}
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+		if !cssPropertyRegex.MatchString(property) {
+			return nil, fmt.Errorf("%q is not a CSS property", property)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("%s has no value", property)
+		}
+		if err := checkCSSValue(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", property, err)
+		}
+		declarations = append(declarations, Declaration{Property: property, Value: value})
+	}
+	if len(declarations) == 0 {
+		return nil, fmt.Errorf("no CSS declarations")
+	}
+	return declarations, nil
+}
+
+// GridDeclarations parses a custom layout, which must be CSS declarations
+// of grid properties such as "grid-template-columns: 1fr 2fr;"
+func GridDeclarations(layout string) ([]Declaration, error) {
+	declarations, err := ParseDeclarations(layout)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range declarations {
+		if !slices.Contains(gridProperties, d.Property) {
+			return nil, fmt.Errorf("%s is not a grid property", d.Property)
+		}
+	}
+	return declarations, nil
+}
+
+// splitDeclarations splits CSS at the semicolons outside of strings
+func splitDeclarations(css string) []string {
+	var parts []string
+	var quote rune
+	start := 0
+	for i, r := range css {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ';':
+			parts = append(parts, css[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, css[start:])
+}
+
+// checkCSSValue returns an error if a declaration value could escape its
+// declaration or load script
+func checkCSSValue(value string) error {
+	if strings.ContainsAny(value, "{}<>\\@") || strings.Contains(value, "/*") {
+		return fmt.Errorf("invalid value %q", value)
+	}
+
+	depth := 0
+	var quote rune
+	for _, r := range value {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			if depth--; depth < 0 {
+				return fmt.Errorf("unbalanced parentheses in %q", value)
+			}
+		}
+	}
+	if quote != 0 {
+		return fmt.Errorf("unterminated string in %q", value)
+	}
+	if depth != 0 {
+		return fmt.Errorf("unbalanced parentheses in %q", value)
+	}
+
+	for _, match := range cssFunctionRegex.FindAllStringSubmatch(value, -1) {
+		if strings.EqualFold(match[1], "expression") {
+			return fmt.Errorf("expression() is not allowed")
+		}
+	}
+	for _, match := range cssURLRegex.FindAllStringSubmatch(value, -1) {
+		url := strings.ToLower(strings.TrimSpace(match[1]))
+		scheme, _, ok := strings.Cut(url, ":")
+		if ok && !strings.ContainsAny(scheme, "/?#") && scheme != "http" && scheme != "https" {
+			return fmt.Errorf("%s: URLs are not allowed", scheme)
+		}
+	}
+	return nil
+}
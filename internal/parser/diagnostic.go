@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Severity indicates how serious a diagnostic is
+type Severity int
+
+const (
+	SeverityWarning Severity = iota
+	SeverityError
+)
+
+// String returns the lowercase name of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	default:
+		return "warning"
+	}
+}
+
+// Diagnostic is a problem found in the source, tied to a location
+type Diagnostic struct {
+	Severity Severity
+	File     string // Source file name, empty when parsing a string
+	Line     int    // 1-based line number, 0 if unknown
+	Column   int    // 1-based column number, 0 if unknown
+	Message  string
+}
+
+// String formats the diagnostic compiler-style, e.g.
+// talk.md:42:3: unknown layout "50-05"
+func (d Diagnostic) String() string {
+	file := d.File
+	if file == "" {
+		file = "<input>"
+	}
+
+	location := file
+	if d.Line > 0 {
+		location += ":" + strconv.Itoa(d.Line)
+		if d.Column > 0 {
+			location += ":" + strconv.Itoa(d.Column)
+		}
+	}
+
+	if d.Severity == SeverityWarning {
+		return fmt.Sprintf("%s: warning: %s", location, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", location, d.Message)
+}
+
+// Regex to pull the line number out of yaml.v3 error messages
+var yamlLineRegex = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// splitYAMLError separates the relative line number from a yaml.v3 error
+// message. The returned line is 0 if the message has none.
+func splitYAMLError(msg string) (int, string) {
+	matches := yamlLineRegex.FindStringSubmatch(msg)
+	if len(matches) < 3 {
+		return 0, msg
+	}
+	line, _ := strconv.Atoi(matches[1])
+	return line, matches[2]
+}
@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gobig/internal/assets"
+)
+
+// Regex to match an include directive on its own line: <!-- include: path -->
+var includeRegex = regexp.MustCompile(`^\s*<!--\s*include:\s*(.*?)\s*-->\s*$`)
+
+// lineOrigin is the file and 1-based line a line of parsed content came from
+type lineOrigin struct {
+	file string
+	line int
+}
+
+// locate maps a 1-based line of the content being parsed back to its source
+func (p *Parser) locate(line int) lineOrigin {
+	if line >= 1 && line <= len(p.origins) {
+		return p.origins[line-1]
+	}
+	return lineOrigin{file: p.filename, line: line}
+}
+
+// loadFile reads filename and splices in the files it includes, returning
+// the combined content and the origin of each of its lines. stack holds the
+// files currently being included, outermost first, to detect cycles.
+// Problems with include directives are recorded as diagnostics.
+func (p *Parser) loadFile(filename string, stack []string) (string, []lineOrigin, error) {
+	p.files = append(p.files, filename)
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", nil, err
+	}
+
+	content := string(data)
+	if len(stack) > 0 {
+		content = p.dropIncludedFrontmatter(filename, content)
+	}
+	stack = append(stack, filename)
+
+	var sb strings.Builder
+	var origins []lineOrigin
+	var state blockState
+
+	for i, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		lineNum := i + 1
+
+		if !state.inBlock() {
+			if m := includeRegex.FindStringSubmatch(line); m != nil {
+				column := strings.Index(line, "<!--") + 1
+				included, includedOrigins, ok := p.include(filename, lineNum, column, m[1], stack)
+				if ok {
+					sb.WriteString(included)
+					origins = append(origins, includedOrigins...)
+				}
+				continue
+			}
+		}
+
+		state.update(line)
+		sb.WriteString(line)
+		sb.WriteString("\n")
+		origins = append(origins, lineOrigin{file: filename, line: lineNum})
+	}
+
+	return sb.String(), origins, nil
+}
+
+// include loads the file named by an include directive at the given
+// position, resolving it relative to the including file
+func (p *Parser) include(from string, line, column int, target string, stack []string) (string, []lineOrigin, bool) {
+	fail := func(format string, args ...interface{}) (string, []lineOrigin, bool) {
+		p.diagnostics = append(p.diagnostics, Diagnostic{
+			Severity: SeverityError,
+			File:     from,
+			Line:     line,
+			Column:   column,
+			Message:  fmt.Sprintf(format, args...),
+		})
+		return "", nil, false
+	}
+
+	if target == "" {
+		return fail("include directive is missing a file name")
+	}
+
+	path := target
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(from), path)
+	}
+
+	if p.options.Safe && !assets.WithinDir(filepath.Dir(stack[0]), path) {
+		return fail("cannot include %s: safe mode only allows files in the presentation's directory", target)
+	}
+
+	for i, file := range stack {
+		if sameFile(file, path) {
+			cycle := append(append([]string{}, stack[i:]...), path)
+			return fail("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	content, origins, err := p.loadFile(path, stack)
+	if err != nil {
+		return fail("failed to include %s: %v", target, err)
+	}
+	return content, origins, true
+}
+
+// dropIncludedFrontmatter removes presentation frontmatter from an included
+// file, keeping its lines, since only the top-level files configure the
+// presentation
+func (p *Parser) dropIncludedFrontmatter(filename, content string) string {
+	loc := presentationFrontmatterRegex.FindStringIndex(content)
+	if loc == nil {
+		return content
+	}
+
+	start := strings.Index(content[loc[0]:], "<!--") + loc[0]
+	pos := positionOf(content, start, position{line: 1, column: 1})
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: SeverityWarning,
+		File:     filename,
+		Line:     pos.line,
+		Column:   pos.column,
+		Message:  "presentation metadata in an included file is ignored",
+	})
+
+	match := content[loc[0]:loc[1]]
+	return content[:loc[0]] + strings.Repeat("\n", strings.Count(match, "\n")) + content[loc[1]:]
+}
+
+// sameFile reports whether two paths refer to the same file
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
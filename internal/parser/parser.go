@@ -1,10 +1,11 @@
 package parser
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
-	"os"
+	"reflect"
 	"regexp"
+	"slices"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -19,43 +20,91 @@ var (
 
 	// Regex to match any HTML comment
 	htmlCommentRegex = regexp.MustCompile(`(?s)<!--(.*?)-->`)
+
+	// Regex to match the body of an explicit notes comment: <!-- notes ... -->
+	notesCommentRegex = regexp.MustCompile(`(?s)^\s*notes\s(.*)$`)
+
+	// Regex to match a notes trailer line: "???", "Note:" or "Notes:" on its own
+	notesTrailerRegex = regexp.MustCompile(`^(?:\?\?\?|Notes?:)$`)
 )
 
+// Options configures parser behavior
+type Options struct {
+	Strict bool // Report metadata problems as errors instead of warnings
+	Safe   bool // Refuse to include files outside the directory of the including top-level file, for untrusted Markdown
+}
+
 // Parser handles parsing markdown files into slides
 type Parser struct {
+	options              Options
 	slides               []*Slide
 	presentationMetadata PresentationMetadata
+	diagnostics          []Diagnostic
+	filename             string
+	files                []string     // Every file read, including included ones
+	origins              []lineOrigin // Source of each line being parsed, nil for a plain string
 }
 
-// NewParser creates a new parser instance
+// position is a 1-based line and column in the source file
+type position struct {
+	line   int
+	column int
+}
+
+// offset returns the position of a YAML node located at the given relative
+// line and column of a document that starts at p
+func (p position) offset(line, column int) position {
+	if line <= 1 {
+		return position{line: p.line, column: p.column + column - 1}
+	}
+	return position{line: p.line + line - 1, column: column}
+}
+
+// NewParser creates a new parser instance with default options
 func NewParser() *Parser {
+	return NewParserWithOptions(Options{})
+}
+
+// NewParserWithOptions creates a new parser instance with the given options
+func NewParserWithOptions(opts Options) *Parser {
 	return &Parser{
+		options:              opts,
 		slides:               make([]*Slide, 0),
 		presentationMetadata: PresentationMetadata{},
 	}
 }
 
-// ParseFile reads and parses a markdown file
+// ParseFile reads and parses a markdown file, splicing in any files it
+// includes. It may be called several times to concatenate files into one
+// presentation.
 func (p *Parser) ParseFile(filename string) error {
-	content, err := os.ReadFile(filename)
+	p.filename = filename
+	content, origins, err := p.loadFile(filename, nil)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
-	return p.ParseString(string(content))
+	p.origins = origins
+	defer func() { p.origins = nil }()
+	return p.parse(content)
 }
 
 // ParseString parses markdown content from a string
 func (p *Parser) ParseString(content string) error {
+	return p.parse(content)
+}
+
+// parse parses markdown content whose lines come from p.origins
+func (p *Parser) parse(content string) error {
 	// Extract presentation-level frontmatter first
 	content = p.extractPresentationFrontmatter(content)
 
 	// Split on horizontal rules (---)
 	// We need to be careful to only split on standalone ---
-	slideContents := splitOnHorizontalRule(content)
+	sections := splitOnHorizontalRule(content)
 
-	for _, slideContent := range slideContents {
-		slide, err := p.parseSlide(slideContent)
+	for _, sec := range sections {
+		slide, err := p.parseSlide(sec)
 		if err != nil {
 			return fmt.Errorf("failed to parse slide: %w", err)
 		}
@@ -83,139 +132,416 @@ func (p *Parser) GetPresentationMetadata() PresentationMetadata {
 	return p.presentationMetadata
 }
 
+// GetFiles returns every file read so far, including included files and
+// ones that could not be read
+func (p *Parser) GetFiles() []string {
+	return p.files
+}
+
+// GetDiagnostics returns the warnings and errors collected while parsing
+func (p *Parser) GetDiagnostics() []Diagnostic {
+	return p.diagnostics
+}
+
+// HasErrors reports whether any error-severity diagnostics were collected
+func (p *Parser) HasErrors() bool {
+	for _, d := range p.diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// addDiagnostic records a diagnostic at the given position in the content
+// being parsed
+func (p *Parser) addDiagnostic(severity Severity, pos position, format string, args ...interface{}) {
+	origin := p.locate(pos.line)
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: severity,
+		File:     origin.file,
+		Line:     origin.line,
+		Column:   pos.column,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// addProblem records a metadata problem, which is an error in strict mode
+// and a warning otherwise
+func (p *Parser) addProblem(pos position, format string, args ...interface{}) {
+	severity := SeverityWarning
+	if p.options.Strict {
+		severity = SeverityError
+	}
+	p.addDiagnostic(severity, pos, format, args...)
+}
+
 // extractPresentationFrontmatter extracts and parses presentation-level YAML frontmatter
 func (p *Parser) extractPresentationFrontmatter(content string) string {
-	matches := presentationFrontmatterRegex.FindStringSubmatch(content)
-	if len(matches) > 1 {
-		yamlContent := matches[1]
+	loc := presentationFrontmatterRegex.FindStringSubmatchIndex(content)
+	if loc == nil {
+		return content
+	}
 
-		// Parse YAML
-		err := yaml.Unmarshal([]byte(yamlContent), &p.presentationMetadata)
-		if err != nil {
-			// If YAML parsing fails, just ignore the frontmatter
-			fmt.Fprintf(os.Stderr, "Warning: failed to parse presentation metadata: %v\n", err)
-		}
+	yamlContent := content[loc[2]:loc[3]]
+	pos := positionOf(content, loc[2], position{line: 1, column: 1})
+
+	// Parse YAML; on failure the frontmatter is ignored
+	root := p.decodeFrontmatter(yamlContent, pos, "presentation", &p.presentationMetadata)
+	if root != nil {
+		p.validateNonNegative(root, pos, "time-to-next", p.presentationMetadata.TimeToNext)
+		p.validateNonNegative(root, pos, "duration", p.presentationMetadata.Duration)
+		p.validateComments(root, pos, p.presentationMetadata.Comments)
+		p.validateFonts(root, pos, p.presentationMetadata.Fonts)
 
-		// Remove frontmatter from content
-		content = presentationFrontmatterRegex.ReplaceAllString(content, "")
+		if p.presentationMetadata.Keys == nil {
+			p.presentationMetadata.Keys = make(map[string]bool)
+		}
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			p.presentationMetadata.Keys[root.Content[i].Value] = true
+		}
 	}
 
-	return content
+	// Remove frontmatter from content, keeping its lines so that slide
+	// positions still match the source file
+	match := content[loc[0]:loc[1]]
+	return content[:loc[0]] + strings.Repeat("\n", strings.Count(match, "\n")) + content[loc[1]:]
 }
 
 // parseSlide parses a single slide's content
-func (p *Parser) parseSlide(content string) (*Slide, error) {
+func (p *Parser) parseSlide(sec section) (*Slide, error) {
+	start := p.locate(sec.startLine)
 	slide := &Slide{
-		Metadata: SlideMetadata{},
+		Metadata:  SlideMetadata{},
+		File:      start.file,
+		StartLine: start.line,
+		EndLine:   p.locate(sec.endLine).line,
 	}
 
 	// Extract frontmatter
-	content = p.extractFrontmatter(content, slide)
+	content := p.extractFrontmatter(sec.content, sec.startLine, slide)
 
 	// Extract speaker notes
 	content = p.extractNotes(content, slide)
 
 	// Remaining content is the slide content
 	slide.Content = strings.TrimSpace(content)
+	slide.ContentLine = slide.StartLine
+	if first, _, _ := strings.Cut(slide.Content, "\n"); first != "" {
+		if i := strings.Index(sec.content, first); i >= 0 {
+			lines := strings.Count(strings.TrimLeft(sec.content[:i], " \t\r\n"), "\n")
+			slide.ContentLine = p.locate(sec.startLine + lines).line
+		}
+	}
 
 	return slide, nil
 }
 
 // extractFrontmatter extracts and parses YAML frontmatter from slide content
-func (p *Parser) extractFrontmatter(content string, slide *Slide) string {
-	matches := slideFrontmatterRegex.FindStringSubmatch(content)
-	if len(matches) > 1 {
-		yamlContent := matches[1]
+// starting at the given line
+func (p *Parser) extractFrontmatter(content string, startLine int, slide *Slide) string {
+	loc := slideFrontmatterRegex.FindStringSubmatchIndex(content)
+	if loc == nil {
+		return content
+	}
 
-		// Parse YAML
-		err := yaml.Unmarshal([]byte(yamlContent), &slide.Metadata)
-		if err != nil {
-			// If YAML parsing fails, just ignore the frontmatter
-			fmt.Fprintf(os.Stderr, "Warning: failed to parse slide metadata: %v\n", err)
+	yamlContent := content[loc[2]:loc[3]]
+	pos := positionOf(content, loc[2], position{line: startLine, column: 1})
+
+	// Parse YAML; on failure the frontmatter is ignored
+	root := p.decodeFrontmatter(yamlContent, pos, "slide", &slide.Metadata)
+	if root != nil {
+		p.validateSlideMetadata(root, pos, slide.Metadata)
+	}
+
+	// Remove frontmatter from content
+	return slideFrontmatterRegex.ReplaceAllString(content, "")
+}
+
+// decodeFrontmatter decodes YAML frontmatter starting at pos into out,
+// recording any problems as diagnostics. It returns the document's root
+// mapping node, or nil if the frontmatter could not be parsed.
+func (p *Parser) decodeFrontmatter(yamlContent string, pos position, kind string, out interface{}) *yaml.Node {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(yamlContent), &doc); err != nil {
+		line, msg := splitYAMLError(err.Error())
+		p.addProblem(pos.offset(line, 1), "failed to parse %s metadata: %s", kind, msg)
+		return nil
+	}
+
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+
+	if root.Kind != yaml.MappingNode {
+		p.addProblem(pos.offset(root.Line, root.Column), "%s metadata must be a mapping of keys to values", kind)
+		return nil
+	}
+
+	p.checkKnownKeys(root, pos, kind, out)
+
+	if err := root.Decode(out); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			p.addProblem(pos, "failed to parse %s metadata: %v", kind, err)
+			return nil
+		}
+		for _, e := range typeErr.Errors {
+			line, msg := splitYAMLError(e)
+			p.addProblem(pos.offset(line, 1), "invalid %s metadata: %s", kind, msg)
+		}
+	}
+
+	return root
+}
+
+// checkKnownKeys reports mapping keys that do not correspond to a yaml
+// field of out, which yaml.Unmarshal would otherwise silently ignore
+func (p *Parser) checkKnownKeys(root *yaml.Node, pos position, kind string, out interface{}) {
+	known := yamlFieldNames(out)
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i]
+		if slices.Contains(known, key.Value) {
+			continue
 		}
 
-		// Remove frontmatter from content
-		content = slideFrontmatterRegex.ReplaceAllString(content, "")
+		keyPos := pos.offset(key.Line, key.Column)
+		if suggestion := closestMatch(key.Value, known); suggestion != "" {
+			p.addProblem(keyPos, "unknown %s metadata key %q (did you mean %q?)", kind, key.Value, suggestion)
+		} else {
+			p.addProblem(keyPos, "unknown %s metadata key %q", kind, key.Value)
+		}
 	}
+}
 
-	return content
+// validateNonNegative reports a negative value for the given metadata key
+func (p *Parser) validateNonNegative(root *yaml.Node, pos position, key string, n int) {
+	if n >= 0 {
+		return
+	}
+	if value := mappingValue(root, key); value != nil {
+		pos = pos.offset(value.Line, value.Column)
+	}
+	p.addProblem(pos, "%s must not be negative, got %d", key, n)
+}
+
+// validateComments reports an unknown comment handling mode
+func (p *Parser) validateComments(root *yaml.Node, pos position, mode string) {
+	switch mode {
+	case "", CommentsNotes, CommentsDrop, CommentsKeep:
+		return
+	}
+	if value := mappingValue(root, "comments"); value != nil {
+		pos = pos.offset(value.Line, value.Column)
+	}
+	p.addProblem(pos, "comments must be %q, %q or %q, got %q", CommentsNotes, CommentsDrop, CommentsKeep, mode)
 }
 
-// extractNotes extracts speaker notes from HTML comments
-// This is called AFTER extractFrontmatter, so all remaining comments are notes
+// validateFonts reports font entries with unknown keys or without the
+// family and src needed to embed them
+func (p *Parser) validateFonts(root *yaml.Node, pos position, fonts []Font) {
+	value := mappingValue(root, "fonts")
+	if value == nil || value.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for i, entry := range value.Content {
+		if entry.Kind != yaml.MappingNode || i >= len(fonts) {
+			continue
+		}
+		p.checkKnownKeys(entry, pos, "font", &Font{})
+
+		entryPos := pos.offset(entry.Line, entry.Column)
+		if fonts[i].Family == "" {
+			p.addProblem(entryPos, "font is missing a family")
+		}
+		if fonts[i].Src == "" {
+			p.addProblem(entryPos, "font is missing a src")
+		}
+	}
+}
+
+// validateSlideMetadata reports metadata values that will not render as intended
+func (p *Parser) validateSlideMetadata(root *yaml.Node, pos position, metadata SlideMetadata) {
+	if value := mappingValue(root, "layout"); value != nil && value.Kind == yaml.ScalarNode && !IsValidLayout(value.Value) {
+		if strings.Contains(value.Value, ":") {
+			_, err := GridDeclarations(value.Value)
+			p.addProblem(pos.offset(value.Line, value.Column), "invalid layout: %v", err)
+		} else {
+			p.addProblem(pos.offset(value.Line, value.Column), "unknown layout %q", value.Value)
+		}
+	}
+	if value := mappingValue(root, "body-style"); value != nil && value.Kind == yaml.ScalarNode && value.Value != "" {
+		if _, err := ParseDeclarations(value.Value); err != nil {
+			p.addProblem(pos.offset(value.Line, value.Column), "invalid body-style: %v", err)
+		}
+	}
+
+	p.validateNonNegative(root, pos, "time-to-next", metadata.TimeToNext)
+
+	if value := mappingValue(root, "build"); value != nil {
+		valuePos := pos.offset(value.Line, value.Column)
+		switch metadata.Build {
+		case BuildItems, BuildBlocks:
+		case BuildCells:
+			if metadata.Layout == "" {
+				p.addProblem(valuePos, "build %q requires a layout", metadata.Build)
+			}
+		default:
+			p.addProblem(valuePos, "build must be %q, %q or %q, got %q", BuildItems, BuildBlocks, BuildCells, metadata.Build)
+		}
+	}
+}
+
+// extractNotes extracts speaker notes from the slide. Notes come from
+// explicit <!-- notes ... --> comments, a trailer section introduced by a
+// "???", "Note:" or "Notes:" line, and, depending on the presentation's
+// comments setting, bare HTML comments.
+// This is called AFTER extractFrontmatter, so slide frontmatter is gone.
 func (p *Parser) extractNotes(content string, slide *Slide) string {
 	var notes []string
 
-	matches := htmlCommentRegex.FindAllStringSubmatch(content, -1)
-	for _, match := range matches {
-		if len(match) > 1 {
-			noteContent := strings.TrimSpace(match[1])
-			// Only add non-empty notes
-			if noteContent != "" {
-				notes = append(notes, noteContent)
-			}
+	content, trailer := splitNotesTrailer(content)
+
+	// Comments in code blocks are part of the code
+	replace := func(comment string) string {
+		body := htmlCommentRegex.FindStringSubmatch(comment)[1]
+
+		if m := notesCommentRegex.FindStringSubmatch(body); m != nil {
+			notes = appendNote(notes, m[1])
+			return ""
+		}
+
+		switch p.presentationMetadata.Comments {
+		case CommentsKeep:
+			return comment
+		case CommentsDrop:
+			return ""
+		default:
+			notes = appendNote(notes, body)
+			return ""
 		}
 	}
+	var sb strings.Builder
+	for _, segment := range splitCode(content) {
+		if segment.code {
+			sb.WriteString(segment.text)
+		} else {
+			sb.WriteString(htmlCommentRegex.ReplaceAllStringFunc(segment.text, replace))
+		}
+	}
+	content = sb.String()
+
+	notes = appendNote(notes, trailer)
 
 	if len(notes) > 0 {
 		slide.Notes = strings.Join(notes, "\n")
 	}
 
-	// Remove all HTML comments from content
-	content = htmlCommentRegex.ReplaceAllString(content, "")
-
 	return content
 }
 
-// splitOnHorizontalRule splits content on standalone horizontal rules (---)
-func splitOnHorizontalRule(content string) []string {
-	var slides []string
-	var currentSlide strings.Builder
+// appendNote adds a trimmed note to notes, skipping empty ones
+func appendNote(notes []string, note string) []string {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return notes
+	}
+	return append(notes, note)
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(content))
+// splitNotesTrailer splits slide content at the first top-level line that
+// is just "???", "Note:" or "Notes:". Everything after it is returned as
+// notes; a line such as "Note: the demo needs wifi" stays on the slide.
+func splitNotesTrailer(content string) (string, string) {
+	var state blockState
+	offset := 0
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if !state.inBlock() && indentWidth(trimmed) < 4 {
+			if notesTrailerRegex.MatchString(strings.TrimSpace(trimmed)) {
+				return content[:offset], content[offset+len(line):]
+			}
+		}
+		state.update(trimmed)
+		offset += len(line)
+	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	return content, ""
+}
 
-		// Check if line is a horizontal rule (3 or more dashes, possibly with spaces)
-		trimmed := strings.TrimSpace(line)
-		if isHorizontalRule(trimmed) {
-			// Save current slide if it has content
-			slideContent := currentSlide.String()
-			if strings.TrimSpace(slideContent) != "" {
-				slides = append(slides, slideContent)
-			}
-			currentSlide.Reset()
-		} else {
-			currentSlide.WriteString(line)
-			currentSlide.WriteString("\n")
+// positionOf returns the source position of byte offset idx in content,
+// where content itself starts at start
+func positionOf(content string, idx int, start position) position {
+	before := content[:idx]
+	line := strings.Count(before, "\n")
+	if line == 0 {
+		return position{line: start.line, column: start.column + idx}
+	}
+	return position{line: start.line + line, column: idx - strings.LastIndex(before, "\n")}
+}
+
+// mappingValue returns the value node for key in a YAML mapping, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
 		}
 	}
+	return nil
+}
+
+// yamlFieldNames returns the yaml tag names of the struct pointed to by v
+func yamlFieldNames(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
 
-	// Add the last slide
-	slideContent := currentSlide.String()
-	if strings.TrimSpace(slideContent) != "" {
-		slides = append(slides, slideContent)
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("yaml")
+		name := strings.Split(tag, ",")[0]
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
 	}
+	return names
+}
 
-	return slides
+// closestMatch returns the candidate within edit distance 2 of s, or ""
+func closestMatch(s string, candidates []string) string {
+	best, bestDistance := "", 3
+	for _, candidate := range candidates {
+		if d := editDistance(s, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
 }
 
-// isHorizontalRule checks if a line is a horizontal rule
-func isHorizontalRule(line string) bool {
-	// Must be at least 3 dashes, with optional spaces
-	if len(line) < 3 {
-		return false
+// editDistance computes the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
 	}
 
-	// Check if it's only dashes and spaces
-	for _, ch := range line {
-		if ch != '-' && ch != ' ' {
-			return false
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
 		}
+		prev, curr = curr, prev
 	}
 
-	// Count dashes
-	dashCount := strings.Count(line, "-")
-	return dashCount >= 3
+	return prev[len(b)]
 }
@@ -1,6 +1,9 @@
 package parser
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -144,6 +147,10 @@ More content.`
 		t.Errorf("Expected time-to-next 5, got %d", metadata.TimeToNext)
 	}
 
+	if !metadata.IsSet("title") || metadata.IsSet("presenter") {
+		t.Errorf("Expected only the given keys to be set, got %v", metadata.Keys)
+	}
+
 	slides := p.GetSlides()
 	if len(slides) != 2 {
 		t.Fatalf("Expected 2 slides, got %d", len(slides))
@@ -190,3 +197,744 @@ func TestSlideDetectType(t *testing.T) {
 		t.Errorf("Expected SlideTypeContent, got %v", slideType)
 	}
 }
+
+func TestSplitOnHorizontalRuleIgnoresCodeAndHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{
+			name:    "backtick fence with info string",
+			content: "# YAML\n\n```yaml\n---\nkey: value\n---\n```\n\n---\n\n# Next",
+			want:    2,
+		},
+		{
+			name:    "tilde fence",
+			content: "~~~\n---\n~~~\n\n---\n\n# Next",
+			want:    2,
+		},
+		{
+			name:    "longer fence contains shorter fence",
+			content: "````markdown\n```\n---\n```\n````\n\n---\n\n# Next",
+			want:    2,
+		},
+		{
+			name:    "mismatched fence character does not close",
+			content: "```\n~~~\n---\n```\n\n---\n\n# Next",
+			want:    2,
+		},
+		{
+			name:    "indented code",
+			content: "# Diff\n\n    ---\n    +++\n\n---\n\n# Next",
+			want:    2,
+		},
+		{
+			name:    "html comment",
+			content: "# Slide\n\n<!--\n---\n-->\n\n---\n\n# Next",
+			want:    2,
+		},
+		{
+			name:    "html block",
+			content: "<div>\n---\n</div>\n\n---\n\n# Next",
+			want:    2,
+		},
+		{
+			name:    "pre block with blank lines",
+			content: "<pre>\n\n---\n\n</pre>\n\n---\n\n# Next",
+			want:    2,
+		},
+		{
+			name:    "inline backticks are not a fence",
+			content: "Use ``` for code\n\n---\n\n# Next",
+			want:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitOnHorizontalRule(tt.content)
+			if len(got) != tt.want {
+				t.Errorf("splitOnHorizontalRule() returned %d slides, want %d: %v", len(got), tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseStringLongLine(t *testing.T) {
+	image := "![logo](data:image/png;base64," + strings.Repeat("A", 100*1024) + ")"
+	p := NewParser()
+	if err := p.ParseString("# One\n\n" + image + "\n\n---\n\n# Two\n"); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+
+	slides := p.GetSlides()
+	if len(slides) != 2 {
+		t.Fatalf("Expected 2 slides, got %d", len(slides))
+	}
+	if !strings.HasSuffix(slides[0].Content, image) || slides[1].Content != "# Two" {
+		t.Errorf("A line over 64 KiB should be kept whole, got slides of %d and %d bytes", len(slides[0].Content), len(slides[1].Content))
+	}
+}
+
+func TestParseStringKeepsFencedRules(t *testing.T) {
+	p := NewParser()
+	content := "# Config\n\n```yaml\n---\nname: demo\n```\n\n---\n\n# Done"
+
+	if err := p.ParseString(content); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+
+	slides := p.GetSlides()
+	if len(slides) != 2 {
+		t.Fatalf("Expected 2 slides, got %d", len(slides))
+	}
+
+	if slides[0].Content != "# Config\n\n```yaml\n---\nname: demo\n```" {
+		t.Errorf("First slide content mismatch: got %q", slides[0].Content)
+	}
+}
+
+func TestParseStringSlidePositions(t *testing.T) {
+	p := NewParser()
+	content := `<!-- presentation
+title: Positions
+-->
+
+# First
+
+Line two
+---
+
+# Second`
+
+	if err := p.ParseString(content); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+
+	slides := p.GetSlides()
+	if len(slides) != 2 {
+		t.Fatalf("Expected 2 slides, got %d", len(slides))
+	}
+
+	if slides[0].StartLine != 5 || slides[0].EndLine != 7 {
+		t.Errorf("First slide lines = %d-%d, want 5-7", slides[0].StartLine, slides[0].EndLine)
+	}
+
+	if slides[1].StartLine != 10 || slides[1].EndLine != 10 {
+		t.Errorf("Second slide lines = %d-%d, want 10-10", slides[1].StartLine, slides[1].EndLine)
+	}
+}
+
+func TestParseContentLine(t *testing.T) {
+	p := NewParser()
+	content := `# First
+---
+
+<!-- slide
+layout: 50-50
+-->
+
+Left
+
+Right`
+
+	if err := p.ParseString(content); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+
+	slides := p.GetSlides()
+	if len(slides) != 2 {
+		t.Fatalf("Expected 2 slides, got %d", len(slides))
+	}
+	if slides[0].ContentLine != 1 {
+		t.Errorf("First slide content line = %d, want 1", slides[0].ContentLine)
+	}
+	if slides[1].ContentLine != 8 {
+		t.Errorf("Second slide content line = %d, want 8", slides[1].ContentLine)
+	}
+}
+
+func TestParseStringDiagnostics(t *testing.T) {
+	p := NewParser()
+	p.filename = "talk.md"
+	content := `# First
+
+---
+
+<!-- slide
+class: wide
+layout: 50-05
+-->
+
+# Second
+
+---
+
+<!-- slide
+time-to-next: soon
+-->
+
+# Third`
+
+	if err := p.ParseString(content); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+
+	diagnostics := p.GetDiagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %v", len(diagnostics), diagnostics)
+	}
+
+	if got := diagnostics[0].String(); got != `talk.md:7:9: warning: unknown layout "50-05"` {
+		t.Errorf("Unexpected layout diagnostic: %s", got)
+	}
+
+	if diagnostics[1].Line != 15 || !strings.Contains(diagnostics[1].Message, "cannot unmarshal") {
+		t.Errorf("Unexpected type diagnostic: %s", diagnostics[1])
+	}
+
+	if p.HasErrors() {
+		t.Error("Warnings should not count as errors")
+	}
+
+	if p.GetSlides()[1].File != "talk.md" {
+		t.Errorf("Expected slide file 'talk.md', got %q", p.GetSlides()[1].File)
+	}
+}
+
+func TestParseStringInvalidYAMLDiagnostic(t *testing.T) {
+	p := NewParser()
+	content := `<!-- presentation
+title: [unclosed
+-->
+
+# Slide`
+
+	if err := p.ParseString(content); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+
+	diagnostics := p.GetDiagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %d: %v", len(diagnostics), diagnostics)
+	}
+
+	if diagnostics[0].Severity != SeverityWarning || diagnostics[0].Line < 2 {
+		t.Errorf("Unexpected diagnostic: %s", diagnostics[0])
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	tests := []struct {
+		d    Diagnostic
+		want string
+	}{
+		{Diagnostic{Severity: SeverityError, File: "talk.md", Line: 42, Column: 3, Message: "bad"}, "talk.md:42:3: bad"},
+		{Diagnostic{Severity: SeverityWarning, File: "talk.md", Line: 1, Message: "odd"}, "talk.md:1: warning: odd"},
+		{Diagnostic{Severity: SeverityError, Message: "no file"}, "<input>: no file"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.d.String(); got != tt.want {
+			t.Errorf("Diagnostic.String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestParseStringUnknownKeys(t *testing.T) {
+	p := NewParser()
+	content := `<!-- presentation
+time-to-nxt: 5
+-->
+
+<!-- slide
+layot: 50-50
+colour: red
+-->
+
+# Slide`
+
+	if err := p.ParseString(content); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+
+	diagnostics := p.GetDiagnostics()
+	if len(diagnostics) != 3 {
+		t.Fatalf("Expected 3 diagnostics, got %d: %v", len(diagnostics), diagnostics)
+	}
+
+	want := []string{
+		`<input>:2:1: warning: unknown presentation metadata key "time-to-nxt" (did you mean "time-to-next"?)`,
+		`<input>:6:1: warning: unknown slide metadata key "layot" (did you mean "layout"?)`,
+		`<input>:7:1: warning: unknown slide metadata key "colour"`,
+	}
+	for i, w := range want {
+		if got := diagnostics[i].String(); got != w {
+			t.Errorf("diagnostic %d = %q, want %q", i, got, w)
+		}
+	}
+
+	if p.HasErrors() {
+		t.Error("Unknown keys should only be warnings outside strict mode")
+	}
+}
+
+func TestParseStringStrict(t *testing.T) {
+	p := NewParserWithOptions(Options{Strict: true})
+	content := `<!-- slide
+layout: 50-05
+time-to-next: -3
+-->
+
+# Slide
+
+---
+
+<!-- slide
+layout: "grid-template-columns: 1fr 2fr;"
+time-to-next: 4
+-->
+
+# Custom layout is fine`
+
+	if err := p.ParseString(content); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+
+	if !p.HasErrors() {
+		t.Fatal("Strict mode should report errors")
+	}
+
+	diagnostics := p.GetDiagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %v", len(diagnostics), diagnostics)
+	}
+
+	for _, d := range diagnostics {
+		if d.Severity != SeverityError {
+			t.Errorf("Expected error severity in strict mode: %s", d)
+		}
+	}
+
+	if diagnostics[1].Line != 3 || !strings.Contains(diagnostics[1].Message, "negative") {
+		t.Errorf("Unexpected time-to-next diagnostic: %s", diagnostics[1])
+	}
+}
+
+func TestParseStringNotesSyntax(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantContent string
+		wantNotes   string
+	}{
+		{
+			name:        "explicit notes comment",
+			content:     "# Slide\n\n<!-- notes\nSay hello\n-->",
+			wantContent: "# Slide",
+			wantNotes:   "Say hello",
+		},
+		{
+			name:        "question mark trailer",
+			content:     "# Slide\n\nVisible\n\n???\n\n- first point\n- second point",
+			wantContent: "# Slide\n\nVisible",
+			wantNotes:   "- first point\n- second point",
+		},
+		{
+			name:        "note trailer",
+			content:     "# Slide\n\nNote:\nMention the demo\nand the survey",
+			wantContent: "# Slide",
+			wantNotes:   "Mention the demo\nand the survey",
+		},
+		{
+			name:        "note paragraph is content",
+			content:     "# Slide\n\nNote: the demo needs wifi\n\nNotes: bring a cable",
+			wantContent: "# Slide\n\nNote: the demo needs wifi\n\nNotes: bring a cable",
+			wantNotes:   "",
+		},
+		{
+			name:        "comments in code are content",
+			content:     "# Slide\n\n```html\n<!-- keep me -->\n<p>hi</p>\n```\n\n    <!-- indented -->\n\n<!-- a note -->",
+			wantContent: "# Slide\n\n```html\n<!-- keep me -->\n<p>hi</p>\n```\n\n    <!-- indented -->",
+			wantNotes:   "a note",
+		},
+		{
+			name:        "notes comment in code is content",
+			content:     "~~~\n<!-- notes\nnot a note\n-->\n~~~",
+			wantContent: "~~~\n<!-- notes\nnot a note\n-->\n~~~",
+			wantNotes:   "",
+		},
+		{
+			name:        "trailer inside code fence is content",
+			content:     "```\n???\nNote: x\n```",
+			wantContent: "```\n???\nNote: x\n```",
+			wantNotes:   "",
+		},
+		{
+			name:        "bare comment and trailer are combined",
+			content:     "# Slide\n\n<!-- from comment -->\n\n???\nfrom trailer",
+			wantContent: "# Slide",
+			wantNotes:   "from comment\nfrom trailer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParser()
+			if err := p.ParseString(tt.content); err != nil {
+				t.Fatalf("ParseString() failed: %v", err)
+			}
+
+			slide := p.GetSlides()[0]
+			if slide.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", slide.Content, tt.wantContent)
+			}
+			if slide.Notes != tt.wantNotes {
+				t.Errorf("Notes = %q, want %q", slide.Notes, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func TestParseStringCommentsSetting(t *testing.T) {
+	body := `
+
+# Slide
+
+<!-- TODO: add a chart -->
+
+<!-- notes
+Real note
+-->`
+
+	tests := []struct {
+		mode        string
+		wantContent string
+	}{
+		{"drop", "# Slide"},
+		{"keep", "# Slide\n\n<!-- TODO: add a chart -->"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			p := NewParser()
+			content := "<!-- presentation\ncomments: " + tt.mode + "\n-->" + body
+			if err := p.ParseString(content); err != nil {
+				t.Fatalf("ParseString() failed: %v", err)
+			}
+
+			slide := p.GetSlides()[0]
+			if strings.TrimSpace(slide.Content) != tt.wantContent {
+				t.Errorf("Content = %q, want %q", slide.Content, tt.wantContent)
+			}
+			if slide.Notes != "Real note" {
+				t.Errorf("Notes = %q, want %q", slide.Notes, "Real note")
+			}
+		})
+	}
+
+	p := NewParserWithOptions(Options{Strict: true})
+	if err := p.ParseString("<!-- presentation\ncomments: hide\n-->\n# Slide"); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+	if !p.HasErrors() {
+		t.Error("Unknown comments mode should be reported in strict mode")
+	}
+}
+
+func TestParseStringBuildValidation(t *testing.T) {
+	p := NewParserWithOptions(Options{Strict: true})
+	content := `<!-- slide
+build: items
+-->
+
+- One
+
+---
+
+<!-- slide
+build: cells
+-->
+
+No layout
+
+---
+
+<!-- slide
+build: bullets
+-->
+
+Typo`
+
+	if err := p.ParseString(content); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+
+	diagnostics := p.GetDiagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %v", len(diagnostics), diagnostics)
+	}
+	if !strings.Contains(diagnostics[0].Message, "requires a layout") {
+		t.Errorf("Unexpected diagnostic: %s", diagnostics[0])
+	}
+	if diagnostics[1].Line != 18 {
+		t.Errorf("Expected build diagnostic on line 18, got %s", diagnostics[1])
+	}
+
+	if p.GetSlides()[0].Metadata.Build != BuildItems {
+		t.Errorf("Expected build %q, got %q", BuildItems, p.GetSlides()[0].Metadata.Build)
+	}
+}
+
+func TestParseStringStyleValidation(t *testing.T) {
+	p := NewParser()
+	p.filename = "talk.md"
+	content := `<!-- slide
+layout: "grid-template-columns: 1fr 2fr; gap: 1em"
+body-style: "background: #222 url(bg.png); color: white !important"
+-->
+
+Fine
+
+---
+
+<!-- slide
+layout: "width: 100%; grid-template-columns: 1fr"
+body-style: "color: red\"><script>alert(1)</script>"
+-->
+
+Broken`
+
+	if err := p.ParseString(content); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+
+	diagnostics := p.GetDiagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %v", len(diagnostics), diagnostics)
+	}
+	if got := diagnostics[0].String(); got != "talk.md:11:9: warning: invalid layout: width is not a grid property" {
+		t.Errorf("Unexpected layout diagnostic: %s", got)
+	}
+	if got := diagnostics[1].String(); !strings.HasPrefix(got, "talk.md:12:13: warning: invalid body-style: color: invalid value") {
+		t.Errorf("Unexpected body-style diagnostic: %s", got)
+	}
+}
+
+func TestParseDeclarations(t *testing.T) {
+	tests := []struct {
+		css  string
+		want string // Declarations joined by spaces, empty for an error
+	}{
+		{"color: red", "color: red;"},
+		{"  COLOR : red ;; background:#000;", "color: red; background: #000;"},
+		{`font-family: "A;B", serif`, `font-family: "A;B", serif;`},
+		{"background: url(https://example.com/a.png)", "background: url(https://example.com/a.png);"},
+		{"background: url('img/a.png')", "background: url('img/a.png');"},
+		{"--accent: rebeccapurple", "--accent: rebeccapurple;"},
+		{"", ""},
+		{"red", ""},
+		{"color:", ""},
+		{"color: red } body { color: blue", ""},
+		{"color: red</style>", ""},
+		{`content: "\22"`, ""},
+		{"color: red /* x */", ""},
+		{"width: expression(alert(1))", ""},
+		{"background: url(javascript:alert(1))", ""},
+		{"background: url( 'data:text/html,x')", ""},
+		{"width: calc(100% - 1em", ""},
+		{`content: "open`, ""},
+		{"co lor: red", ""},
+	}
+	for _, tt := range tests {
+		declarations, err := ParseDeclarations(tt.css)
+		var got []string
+		for _, d := range declarations {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, " ") != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("ParseDeclarations(%q) = %q, %v; want %q", tt.css, got, err, tt.want)
+		}
+	}
+}
+
+func TestIsValidLayout(t *testing.T) {
+	tests := []struct {
+		layout string
+		want   bool
+	}{
+		{"50-50", true},
+		{"grid-template-columns: 1fr 2fr;", true},
+		{`grid-template-areas: "a b" "c d"; gap: 2%`, true},
+		{"grid-template-columns: repeat(3, minmax(0, 1fr))", true},
+		{"50-05", false},
+		{"display: none", false},
+		{`grid-template-columns: 1fr"><script>`, false},
+	}
+	for _, tt := range tests {
+		if got := IsValidLayout(tt.layout); got != tt.want {
+			t.Errorf("IsValidLayout(%q) = %v, want %v", tt.layout, got, tt.want)
+		}
+	}
+}
+
+func TestParseStringFonts(t *testing.T) {
+	p := NewParser()
+	content := `<!-- presentation
+subset-fonts: true
+fonts:
+  - family: Brand
+    src: fonts/brand.woff2
+    weight: 700
+  - family: Brand
+    source: fonts/brand-italic.woff2
+-->
+
+# Slide`
+
+	if err := p.ParseString(content); err != nil {
+		t.Fatalf("ParseString() failed: %v", err)
+	}
+
+	metadata := p.GetPresentationMetadata()
+	if !metadata.SubsetFonts || len(metadata.Fonts) != 2 {
+		t.Fatalf("Unexpected metadata: %+v", metadata)
+	}
+	if metadata.Fonts[0].Weight != "700" {
+		t.Errorf("Expected weight %q, got %q", "700", metadata.Fonts[0].Weight)
+	}
+
+	diagnostics := p.GetDiagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %v", len(diagnostics), diagnostics)
+	}
+	if !strings.Contains(diagnostics[0].Message, `unknown font metadata key "source"`) || diagnostics[0].Line != 8 {
+		t.Errorf("Unexpected diagnostic: %s", diagnostics[0])
+	}
+	if !strings.Contains(diagnostics[1].Message, "missing a src") || diagnostics[1].Line != 7 {
+		t.Errorf("Unexpected diagnostic: %s", diagnostics[1])
+	}
+}
+
+func TestParseFileIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "talk.md"), "# Main\n\n---\n\n<!-- include: modules/intro.md -->\n\n---\n\n# End\n")
+	writeFile(t, filepath.Join(dir, "modules", "intro.md"), "# Intro\n\n---\n\n<!-- slide\nlayout: 50-05\n-->\n\n# Intro 2\n")
+
+	p := NewParser()
+	if err := p.ParseFile(filepath.Join(dir, "talk.md")); err != nil {
+		t.Fatalf("ParseFile() failed: %v", err)
+	}
+
+	slides := p.GetSlides()
+	if len(slides) != 4 {
+		t.Fatalf("Expected 4 slides, got %d", len(slides))
+	}
+
+	intro := filepath.Join(dir, "modules", "intro.md")
+	if slides[2].File != intro || slides[2].StartLine != 5 {
+		t.Errorf("Included slide location = %s:%d, want %s:5", slides[2].File, slides[2].StartLine, intro)
+	}
+	if slides[3].File != filepath.Join(dir, "talk.md") || slides[3].StartLine != 9 {
+		t.Errorf("Slide after include location = %s:%d, want talk.md:9", slides[3].File, slides[3].StartLine)
+	}
+
+	diagnostics := p.GetDiagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].File != intro || diagnostics[0].Line != 6 {
+		t.Errorf("Expected layout diagnostic at %s:6, got %v", intro, diagnostics)
+	}
+
+	if len(p.GetFiles()) != 2 {
+		t.Errorf("Expected 2 files read, got %v", p.GetFiles())
+	}
+}
+
+func TestParseFileIncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.md"), "# A\n\n<!-- include: b.md -->\n\n<!-- include: missing.md -->\n")
+	writeFile(t, filepath.Join(dir, "b.md"), "# B\n\n<!-- include: a.md -->\n")
+
+	p := NewParser()
+	if err := p.ParseFile(filepath.Join(dir, "a.md")); err != nil {
+		t.Fatalf("ParseFile() failed: %v", err)
+	}
+
+	if !p.HasErrors() {
+		t.Fatal("Include cycle and missing include should be errors")
+	}
+
+	diagnostics := p.GetDiagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %v", len(diagnostics), diagnostics)
+	}
+	if !strings.Contains(diagnostics[0].Message, "include cycle") || diagnostics[0].Line != 3 {
+		t.Errorf("Unexpected cycle diagnostic: %s", diagnostics[0])
+	}
+	if !strings.Contains(diagnostics[1].Message, "missing.md") || diagnostics[1].Line != 5 {
+		t.Errorf("Unexpected missing file diagnostic: %s", diagnostics[1])
+	}
+}
+
+func TestParseFileSafeIncludes(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "talk")
+	writeFile(t, filepath.Join(root, "secret.txt"), "# Secret\n")
+	writeFile(t, filepath.Join(dir, "talk.md"), "# Main\n\n<!-- include: modules/intro.md -->\n\n<!-- include: ../secret.txt -->\n")
+	writeFile(t, filepath.Join(dir, "modules", "intro.md"), "# Intro\n\n<!-- include: ../../secret.txt -->\n")
+
+	p := NewParserWithOptions(Options{Safe: true})
+	if err := p.ParseFile(filepath.Join(dir, "talk.md")); err != nil {
+		t.Fatalf("ParseFile() failed: %v", err)
+	}
+
+	diagnostics := p.GetDiagnostics()
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %v", len(diagnostics), diagnostics)
+	}
+	for _, d := range diagnostics {
+		if d.Severity != SeverityError || !strings.Contains(d.Message, "safe mode only allows files in the presentation's directory") {
+			t.Errorf("Unexpected diagnostic: %s", d)
+		}
+	}
+	for _, slide := range p.GetSlides() {
+		if strings.Contains(slide.Content, "Secret") {
+			t.Error("A file outside the presentation's directory should not be included in safe mode")
+		}
+	}
+	if !strings.Contains(p.GetSlides()[0].Content, "# Intro") {
+		t.Error("A file in the presentation's directory should be included in safe mode")
+	}
+}
+
+func TestParseFileMultiple(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "one.md"), "<!-- presentation\ntitle: Workshop\n-->\n\n# One\n")
+	writeFile(t, filepath.Join(dir, "two.md"), "# Two\n")
+
+	p := NewParser()
+	for _, name := range []string{"one.md", "two.md"} {
+		if err := p.ParseFile(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("ParseFile(%s) failed: %v", name, err)
+		}
+	}
+
+	slides := p.GetSlides()
+	if len(slides) != 2 || slides[1].Content != "# Two" || slides[1].StartLine != 1 {
+		t.Fatalf("Unexpected slides: %+v", slides)
+	}
+	if p.GetPresentationMetadata().Title != "Workshop" {
+		t.Errorf("Expected title from the first file, got %q", p.GetPresentationMetadata().Title)
+	}
+}
+
+// writeFile creates a file and its parent directories for a test
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,19 +7,85 @@ type SlideMetadata struct {
 	BodyStyle  string `yaml:"body-style"`   // Custom body styling for this slide
 	BodyClass  string `yaml:"body-class"`   // Custom body class for this slide
 	TimeToNext int    `yaml:"time-to-next"` // Auto-advance time in seconds
+	Build      string `yaml:"build"`        // Reveal "items", "blocks" or layout "cells" one step at a time
 }
 
+// Values for SlideMetadata.Build
+const (
+	BuildItems  = "items"  // Reveal list items one at a time
+	BuildBlocks = "blocks" // Reveal paragraphs and other top-level blocks, headings stay visible
+	BuildCells  = "cells"  // Reveal layout cells one at a time
+)
+
 // PresentationMetadata represents presentation-level metadata
 type PresentationMetadata struct {
-	Title      string `yaml:"title"`        // Presentation title
-	TimeToNext int    `yaml:"time-to-next"` // Default auto-advance time for all slides
+	Title          string   `yaml:"title"`           // Presentation title
+	TimeToNext     int      `yaml:"time-to-next"`    // Default auto-advance time for all slides
+	Presenter      bool     `yaml:"presenter"`       // Include the presenter view
+	Duration       int      `yaml:"duration"`        // Planned talk length in minutes, shown by the presenter timer
+	Comments       string   `yaml:"comments"`        // What to do with bare HTML comments: "notes", "drop" or "keep"
+	Themes         []string `yaml:"themes"`          // Directories searched for themes given by name, relative to the presentation file
+	Fonts          []Font   `yaml:"fonts"`           // Font files to embed as @font-face rules
+	SubsetFonts    bool     `yaml:"subset-fonts"`    // Reduce embedded fonts to the glyphs used in the deck
+	HighlightStyle string   `yaml:"highlight-style"` // Syntax highlighting style for code blocks, "none" to disable
+	LineNumbers    bool     `yaml:"line-numbers"`    // Show line numbers in every highlighted code block
+
+	Keys map[string]bool `yaml:"-"` // Keys given in the frontmatter, which tell a value set to false from an unset one
+}
+
+// IsSet reports whether the frontmatter gave a value for key, e.g. "presenter"
+func (m PresentationMetadata) IsSet(key string) bool {
+	return m.Keys[key]
+}
+
+// Font declares a font file to embed in the presentation
+type Font struct {
+	Family string `yaml:"family"` // CSS font-family name
+	Src    string `yaml:"src"`    // Path to a woff2, woff, ttf or otf file, relative to the presentation file
+	Weight string `yaml:"weight"` // CSS font-weight, e.g. "400", "bold" or "100 900"
+	Style  string `yaml:"style"`  // CSS font-style, e.g. "normal" or "italic"
 }
 
+// Values for PresentationMetadata.Comments
+const (
+	CommentsNotes = "notes" // Bare comments become speaker notes (default)
+	CommentsDrop  = "drop"  // Bare comments are removed from the output
+	CommentsKeep  = "keep"  // Bare comments stay in the slide HTML, invisible to the audience
+)
+
 // Slide represents a single presentation slide
 type Slide struct {
-	Metadata SlideMetadata // Parsed frontmatter
-	Content  string        // Raw markdown content (without frontmatter)
-	Notes    string        // Speaker notes extracted from HTML comments
+	Metadata    SlideMetadata // Parsed frontmatter
+	Content     string        // Raw markdown content (without frontmatter)
+	Notes       string        // Speaker notes extracted from HTML comments
+	File        string        // Source file the slide was parsed from
+	StartLine   int           // 1-based line where the slide starts in File
+	ContentLine int           // 1-based line where Content starts in File
+	EndLine     int           // 1-based line where the slide ends in File
+}
+
+// KnownLayouts lists the named layouts understood by the generator
+var KnownLayouts = []string{
+	"50-50",
+	"75-25",
+	"25-75",
+	"50-50-rows",
+	"75-25-rows",
+	"25-75-rows",
+	"grid-3x2",
+	"grid-2x3",
+}
+
+// IsValidLayout reports whether layout is a named layout or custom CSS grid
+// declarations (e.g. "grid-template-columns: 1fr 2fr;")
+func IsValidLayout(layout string) bool {
+	for _, known := range KnownLayouts {
+		if layout == known {
+			return true
+		}
+	}
+	_, err := GridDeclarations(layout)
+	return err == nil
 }
 
 // SlideType represents the detected type of slide
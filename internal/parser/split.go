@@ -0,0 +1,272 @@
+package parser
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Regex to match the start of a raw HTML block that ends on a blank line
+	// (CommonMark HTML block type 6)
+	htmlBlockTagRegex = regexp.MustCompile(`(?i)^</?(address|article|aside|base|basefont|blockquote|body|caption|center|col|colgroup|dd|details|dialog|dir|div|dl|dt|fieldset|figcaption|figure|footer|form|frame|frameset|h1|h2|h3|h4|h5|h6|head|header|hr|html|iframe|legend|li|link|main|menu|menuitem|nav|noframes|ol|optgroup|option|p|param|search|section|summary|table|tbody|td|tfoot|th|thead|title|tr|track|ul)(\s|/?>|$)`)
+
+	// Regex to match the start of a raw HTML block that ends on a closing tag
+	// (CommonMark HTML block type 1)
+	htmlRawTagRegex = regexp.MustCompile(`(?i)^<(pre|script|style|textarea)(\s|>|$)`)
+)
+
+// blockState tracks the Markdown block the splitter is currently inside
+type blockState struct {
+	fenceChar byte   // '`' or '~' while inside a fenced code block, 0 otherwise
+	fenceLen  int    // Length of the opening fence
+	htmlEnd   string // Terminator of the current HTML block, "" if none
+	htmlBlank bool   // True if the current HTML block ends on a blank line
+}
+
+// inBlock reports whether the splitter is inside a code or HTML block
+func (b *blockState) inBlock() bool {
+	return b.fenceChar != 0 || b.htmlEnd != "" || b.htmlBlank
+}
+
+// update advances the block state past the given line
+func (b *blockState) update(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case b.fenceChar != 0:
+		if isClosingFence(trimmed, b.fenceChar, b.fenceLen) {
+			b.fenceChar, b.fenceLen = 0, 0
+		}
+		return
+	case b.htmlBlank:
+		if trimmed == "" {
+			b.htmlBlank = false
+		}
+		return
+	case b.htmlEnd != "":
+		if strings.Contains(strings.ToLower(line), b.htmlEnd) {
+			b.htmlEnd = ""
+		}
+		return
+	}
+
+	if indentWidth(line) >= 4 {
+		// Indented code: nothing in it can open a block
+		return
+	}
+
+	if ch, n, ok := openingFence(trimmed); ok {
+		b.fenceChar, b.fenceLen = ch, n
+		return
+	}
+
+	b.htmlEnd, b.htmlBlank = htmlBlockEnd(trimmed)
+	if b.htmlEnd != "" && strings.Contains(strings.ToLower(trimmed[1:]), b.htmlEnd) {
+		// Block opens and closes on the same line
+		b.htmlEnd = ""
+	}
+}
+
+// section is a chunk of source text that becomes a single slide
+type section struct {
+	content   string // Raw text of the chunk
+	startLine int    // 1-based line of the first non-blank line
+	endLine   int    // 1-based line of the last non-blank line
+}
+
+// splitOnHorizontalRule splits content on standalone horizontal rules (---).
+// Rules inside fenced code, indented code and raw HTML blocks are kept as
+// content so that they do not cut a slide in half.
+func splitOnHorizontalRule(content string) []section {
+	var slides []section
+	var current section
+	var currentSlide strings.Builder
+	var state blockState
+
+	flush := func() {
+		// Save current slide if it has content
+		current.content = currentSlide.String()
+		if strings.TrimSpace(current.content) != "" {
+			slides = append(slides, current)
+		}
+		current = section{}
+		currentSlide.Reset()
+	}
+
+	// Lines may be as long as the content, e.g. a large inline data URI
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	lineNum := 0
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNum++
+
+		// Check if line is a horizontal rule (3 or more dashes, possibly with spaces)
+		if !state.inBlock() && indentWidth(line) < 4 && isHorizontalRule(strings.TrimSpace(line)) {
+			flush()
+			continue
+		}
+
+		state.update(line)
+
+		if strings.TrimSpace(line) != "" {
+			if current.startLine == 0 {
+				current.startLine = lineNum
+			}
+			current.endLine = lineNum
+		}
+
+		// Leading blank lines are dropped so that the chunk starts at startLine
+		if current.startLine != 0 {
+			currentSlide.WriteString(line)
+			currentSlide.WriteString("\n")
+		}
+	}
+
+	// Add the last slide
+	flush()
+
+	return slides
+}
+
+// codeSegment is a run of whole lines of slide content, either all inside
+// code blocks or all outside them
+type codeSegment struct {
+	text string
+	code bool // Lines of fenced code, fences included, or of indented code
+}
+
+// splitCode splits content into runs of code and other lines, so that
+// comments and markers inside code blocks can be left alone
+func splitCode(content string) []codeSegment {
+	var segments []codeSegment
+	var state blockState
+	prevBlank, prevIndented := true, false
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if line == "" {
+			continue
+		}
+		trimmed := strings.TrimRight(line, "\r\n")
+		blank := strings.TrimSpace(trimmed) == ""
+
+		// Indented code cannot interrupt a paragraph, so it needs a blank
+		// line or more indented code before it
+		indented := !state.inBlock() && !blank && indentWidth(trimmed) >= 4 && (prevBlank || prevIndented)
+		code := state.fenceChar != 0 || indented
+		state.update(trimmed)
+		code = code || state.fenceChar != 0
+
+		if n := len(segments); n > 0 && segments[n-1].code == code {
+			segments[n-1].text += line
+		} else {
+			segments = append(segments, codeSegment{text: line, code: code})
+		}
+		prevBlank = blank
+		prevIndented = indented || (prevIndented && blank)
+	}
+	return segments
+}
+
+// isHorizontalRule checks if a line is a horizontal rule
+func isHorizontalRule(line string) bool {
+	// Must be at least 3 dashes, with optional spaces
+	if len(line) < 3 {
+		return false
+	}
+
+	// Check if it's only dashes and spaces
+	for _, ch := range line {
+		if ch != '-' && ch != ' ' {
+			return false
+		}
+	}
+
+	// Count dashes
+	dashCount := strings.Count(line, "-")
+	return dashCount >= 3
+}
+
+// openingFence checks if a trimmed line opens a fenced code block and
+// returns the fence character and length
+func openingFence(line string) (byte, int, bool) {
+	if len(line) < 3 || (line[0] != '`' && line[0] != '~') {
+		return 0, 0, false
+	}
+
+	ch := line[0]
+	n := 0
+	for n < len(line) && line[n] == ch {
+		n++
+	}
+	if n < 3 {
+		return 0, 0, false
+	}
+
+	// Backtick fences may not have backticks in their info string
+	if ch == '`' && strings.ContainsRune(line[n:], '`') {
+		return 0, 0, false
+	}
+
+	return ch, n, true
+}
+
+// isClosingFence checks if a trimmed line closes a fence opened with
+// at least n characters ch
+func isClosingFence(line string, ch byte, n int) bool {
+	if len(line) < n {
+		return false
+	}
+	for i := 0; i < len(line); i++ {
+		if line[i] != ch {
+			return false
+		}
+	}
+	return true
+}
+
+// htmlBlockEnd returns how a raw HTML block starting on the given trimmed
+// line is terminated: either a closing marker or a blank line
+func htmlBlockEnd(line string) (string, bool) {
+	switch {
+	case !strings.HasPrefix(line, "<"):
+		return "", false
+	case strings.HasPrefix(line, "<!--"):
+		return "-->", false
+	case strings.HasPrefix(line, "<![CDATA["):
+		return "]]>", false
+	case strings.HasPrefix(line, "<?"):
+		return "?>", false
+	case len(line) > 2 && line[1] == '!' && line[2] >= 'A' && line[2] <= 'Z':
+		return ">", false
+	}
+
+	if m := htmlRawTagRegex.FindStringSubmatch(line); m != nil {
+		return "</" + strings.ToLower(m[1]) + ">", false
+	}
+
+	if htmlBlockTagRegex.MatchString(line) {
+		return "", true
+	}
+
+	return "", false
+}
+
+// indentWidth returns the number of columns of leading whitespace,
+// expanding tabs to the next multiple of 4
+func indentWidth(line string) int {
+	width := 0
+	for _, ch := range line {
+		switch ch {
+		case ' ':
+			width++
+		case '\t':
+			width += 4 - width%4
+		default:
+			return width
+		}
+	}
+	return width
+}